@@ -15,9 +15,12 @@ func AddDefaultTrainCallbacks(ss *sim.Sim) {
 				fnm := ss.WeightsFileName()
 				fmt.Printf("Saving Weights to: %s\n", fnm)
 				ss.Net.SaveWtsJSON(gi.FileName(fnm))
+				ss.Manifest.AddFile(fnm)
 			}
 		},
 	})
+	// Weight snapshots
+	AddSnapshotCallbacks(ss)
 
 	// Weight storage and update delta.
 	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, sim.TrainingCallbacks{
@@ -42,14 +45,11 @@ func AddDefaultTrainCallbacks(ss *sim.Sim) {
 		},
 	})
 
+	// Aggregation of the runs
+	AddRunAggCallbacks(ss)
+
 	// Learning Rate Schedule
-	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, sim.TrainingCallbacks{
-		OnEpochEnd: func() {
-			if ss.Trainer.EvalMode == etime.Train {
-				LrateSched(ss, ss.TrainEnv.Epoch().Cur)
-			}
-		},
-	})
+	AddLrateSchedCallbacks(ss)
 
 	// PCA Stats
 	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, sim.TrainingCallbacks{
@@ -70,12 +70,62 @@ func AddDefaultTrainCallbacks(ss *sim.Sim) {
 		},
 	})
 
-	// First Zero Early Stopping
+	// RSA Stats, on the test patterns
 	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, sim.TrainingCallbacks{
-		RunStopEarly: func() bool {
+		OnEpochStart: func() {
+			if ss.Trainer.EvalMode == etime.Test {
+				ss.RSAStartEpoch()
+			}
+		},
+		OnTrialEnd: func() {
+			if ss.Trainer.EvalMode == etime.Test {
+				ss.RSARecord()
+			}
+		},
+		OnEpochEnd: func() {
+			if ss.Trainer.EvalMode == etime.Test {
+				ss.RSAStats() // before Log
+			}
+		},
+	})
+
+	// Confusion matrix, on the test patterns
+	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, sim.TrainingCallbacks{
+		OnEpochStart: func() {
+			if ss.Trainer.EvalMode == etime.Test {
+				ss.Confusion.Reset()
+			}
+		},
+		OnTrialEnd: func() {
+			if ss.Trainer.EvalMode == etime.Test {
+				ss.ConfusionRecord()
+			}
+		},
+		OnEpochEnd: func() {
+			if ss.Trainer.EvalMode == etime.Test {
+				ss.ConfusionTable()
+			}
+		},
+	})
+
+	// N-gram baseline, on the test trials of a CorpusEnv -- the TrialStatsFunc
+	// records each trial with NGramEvalRecord, before it is logged
+	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, sim.TrainingCallbacks{
+		OnEpochStart: func() {
+			if ss.Trainer.EvalMode == etime.Test {
+				ss.NGramEval.Reset()
+			}
+		},
+	})
+
+	// First Zero Early Stopping
+	ss.EarlyStop.Add(&sim.StopFunc{
+		Reason: "NZeroStop",
+		Func: func() bool {
 			return ss.NZeroStop > 0 && ss.Stats.Int("NZero") >= ss.NZeroStop
 		},
 	})
+	AddEarlyStopCallbacks(ss)
 
 	AddPlusAndMinusPhases(ss)
 
@@ -136,13 +186,57 @@ func AddPlusAndMinusPhases(ss *sim.Sim) {
 	}}
 }
 
-// LrateSched implements the learning rate schedule
-func LrateSched(ss *sim.Sim, epc int) {
-	switch epc {
-	case 40:
-		ss.Net.LrateMod(0.5)
-		fmt.Printf("dropped lrate 0.5 at epoch: %d\n", epc)
-	}
+// AddLrateSchedCallbacks applies ss.LrateSched to the network at the start of
+// every training epoch, and registers it with the params and checkpoints.
+// If the schedule cannot be computed, training is stopped.
+func AddLrateSchedCallbacks(ss *sim.Sim) {
+	ss.Params.AddObject("LrateSched", &ss.LrateSched)
+	ss.CheckpointSavers = append(ss.CheckpointSavers, ss.LrateSched.CheckpointSaver())
+	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, sim.TrainingCallbacks{
+		Name: "LrateSched",
+		OnEpochStart: func() {
+			if ss.Trainer.EvalMode == etime.Train {
+				epc := ss.TrainEnv.Epoch().Cur
+				dt := ss.Logs.Table(etime.Train, etime.Epoch)
+				prv := ss.LrateSched.Mult
+				mult, err := ss.LrateSched.Epoch(epc, dt.CellFloat(ss.LrateSched.Stat, dt.Rows-1))
+				if err != nil {
+					fmt.Println(err)
+					ss.GUI.StopNow = true
+					return
+				}
+				ss.Net.LrateSched(mult)
+				if mult != prv {
+					fmt.Printf("lrate multiplier %g at epoch: %d\n", mult, epc)
+				}
+			}
+		},
+	})
+}
+
+// AddSnapshotCallbacks saves the best score so far of ss.Snapshots, which the
+// Sim saves the weight snapshots with, in checkpoints.
+func AddSnapshotCallbacks(ss *sim.Sim) {
+	ss.CheckpointSavers = append(ss.CheckpointSavers, ss.Snapshots.CheckpointSaver())
+}
+
+// AddRunAggCallbacks saves the learning curves of the runs so far, which
+// ss.RunAgg aggregates at the end of every run, in checkpoints.
+func AddRunAggCallbacks(ss *sim.Sim) {
+	ss.CheckpointSavers = append(ss.CheckpointSavers, ss.RunAgg.CheckpointSaver())
+}
+
+// AddEarlyStopCallbacks stops training runs according to the ss.EarlyStop rules,
+// and saves their state in checkpoints.
+func AddEarlyStopCallbacks(ss *sim.Sim) {
+	ss.CheckpointSavers = append(ss.CheckpointSavers, ss.EarlyStop.CheckpointSaver())
+	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, sim.TrainingCallbacks{
+		Name: "EarlyStop",
+		RunStopEarly: func() bool {
+			// the stats are those of training epochs
+			return ss.Trainer.EvalMode == etime.Train && ss.EarlyStop.Check(ss)
+		},
+	})
 }
 
 // AddSimpleCallbacks is used by RA25 and one2many.
@@ -153,8 +247,6 @@ func AddSimpleCallbacks(ss *sim.Sim) {
 			if ss.Trainer.EvalMode == etime.Train {
 				if (ss.TestInterval > 0) && ((ss.TrainEnv.Epoch().Cur+1)%ss.TestInterval == 0) {
 					ss.TestAll()
-					ss.Trainer.EvalMode = etime.Train // Important to set these back because TestAll sets them to Test.
-					ss.Trainer.CurEnv = &ss.TrainEnv
 				}
 			}
 		},
@@ -0,0 +1,364 @@
+package sim
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow/go/arrow"
+	"github.com/apache/arrow/go/arrow/array"
+	"github.com/apache/arrow/go/arrow/ipc"
+	"github.com/apache/arrow/go/arrow/memory"
+	"github.com/emer/emergent/elog"
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// ArrowBatchRows is the number of rows in each record batch of an ArrowLog.
+var ArrowBatchRows = 1000
+
+// ArrowLog writes the rows of a log table to an Arrow IPC file, as they are
+// logged. Scalar columns are stored as Arrow columns of the same type, and tensor
+// columns as fixed size lists of their values, with the shape of the cells in the
+// "shape" metadata of the field (e.g., "5,5"), and the names of the dimensions in
+// "dims". Rows are written in batches of ArrowBatchRows, and the file is only
+// complete once it is closed.
+type ArrowLog struct {
+	File   *os.File             `desc:"the file being written"`
+	Schema *arrow.Schema        `desc:"the schema made from the columns of the table"`
+	Rows   int                  `desc:"number of rows written so far"`
+	writer *ipc.FileWriter      // writes record batches to File
+	bld    *array.RecordBuilder // builds the next record batch
+	nbatch int                  // rows in the next record batch
+}
+
+// NewArrowLog creates an Arrow IPC file with given name, for the rows of dt.
+func NewArrowLog(fnm string, dt *etable.Table) (*ArrowLog, error) {
+	fields := make([]arrow.Field, len(dt.Cols))
+	for ci, col := range dt.Cols {
+		fields[ci] = arrowField(dt.ColNames[ci], col)
+	}
+	al := &ArrowLog{Schema: arrow.NewSchema(fields, nil)}
+	var err error
+	al.File, err = os.Create(fnm)
+	if err != nil {
+		return nil, err
+	}
+	mem := memory.NewGoAllocator()
+	al.writer, err = ipc.NewFileWriter(al.File, ipc.WithSchema(al.Schema), ipc.WithAllocator(mem))
+	if err != nil {
+		al.File.Close()
+		return nil, err
+	}
+	al.bld = array.NewRecordBuilder(mem, al.Schema)
+	return al, nil
+}
+
+// arrowType returns the Arrow type for the values of an etensor type.
+// Integers are all stored as int64.
+func arrowType(typ etensor.Type) arrow.DataType {
+	switch typ {
+	case etensor.BOOL:
+		return arrow.FixedWidthTypes.Boolean
+	case etensor.FLOAT32:
+		return arrow.PrimitiveTypes.Float32
+	case etensor.FLOAT64:
+		return arrow.PrimitiveTypes.Float64
+	case etensor.STRING:
+		return arrow.BinaryTypes.String
+	}
+	return arrow.PrimitiveTypes.Int64
+}
+
+// arrowField returns the Arrow field for a column of a table.
+func arrowField(name string, col etensor.Tensor) arrow.Field {
+	typ := arrowType(col.DataType())
+	if col.NumDims() == 1 {
+		return arrow.Field{Name: name, Type: typ}
+	}
+	shp := col.Shapes()[1:]
+	shps := make([]string, len(shp))
+	for i, s := range shp {
+		shps[i] = strconv.Itoa(s)
+	}
+	md := arrow.NewMetadata([]string{"shape", "dims"}, []string{strings.Join(shps, ","), strings.Join(col.DimNames()[1:], ",")})
+	return arrow.Field{Name: name, Type: arrow.FixedSizeListOf(int32(cellSize(col)), typ), Metadata: md}
+}
+
+// cellSize returns the number of values in each cell of a table column.
+func cellSize(col etensor.Tensor) int {
+	csz := 1
+	for _, s := range col.Shapes()[1:] {
+		csz *= s
+	}
+	return csz
+}
+
+// AppendRow adds given row of dt to the log, writing a record batch if
+// there are ArrowBatchRows rows to write.
+func (al *ArrowLog) AppendRow(dt *etable.Table, row int) error {
+	for ci, col := range dt.Cols {
+		fb := al.bld.Field(ci)
+		if lb, ok := fb.(*array.FixedSizeListBuilder); ok {
+			csz := cellSize(col)
+			lb.Append(true)
+			vb := lb.ValueBuilder()
+			for i := row * csz; i < (row+1)*csz; i++ {
+				appendArrowVal(vb, col, i)
+			}
+		} else {
+			appendArrowVal(fb, col, row)
+		}
+	}
+	al.nbatch++
+	al.Rows++
+	if al.nbatch >= ArrowBatchRows {
+		return al.writeBatch()
+	}
+	return nil
+}
+
+// appendArrowVal appends the value at index i of col to the builder for it.
+func appendArrowVal(b array.Builder, col etensor.Tensor, i int) {
+	switch bt := b.(type) {
+	case *array.BooleanBuilder:
+		bt.Append(col.FloatVal1D(i) != 0)
+	case *array.Float32Builder:
+		bt.Append(float32(col.FloatVal1D(i)))
+	case *array.Float64Builder:
+		bt.Append(col.FloatVal1D(i))
+	case *array.StringBuilder:
+		bt.Append(col.StringVal1D(i))
+	case *array.Int64Builder:
+		bt.Append(int64(col.FloatVal1D(i)))
+	}
+}
+
+// writeBatch writes the rows appended since the last batch, if any.
+func (al *ArrowLog) writeBatch() error {
+	if al.nbatch == 0 {
+		return nil
+	}
+	rec := al.bld.NewRecord()
+	defer rec.Release()
+	al.nbatch = 0
+	return al.writer.Write(rec)
+}
+
+// Close writes any remaining rows and the footer of the file, and closes it.
+func (al *ArrowLog) Close() error {
+	err := al.writeBatch()
+	if cerr := al.writer.Close(); err == nil {
+		err = cerr
+	}
+	al.bld.Release()
+	if cerr := al.File.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// OpenArrowLog reads an Arrow IPC file written by ArrowLog back into a table,
+// with tensor columns of the shapes in the metadata of their fields.
+func OpenArrowLog(fnm string) (*etable.Table, error) {
+	f, err := os.Open(fnm)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	rdr, err := ipc.NewFileReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("OpenArrowLog: %s: %v", fnm, err)
+	}
+	defer rdr.Close()
+	sc := etable.Schema{}
+	for _, fld := range rdr.Schema().Fields() {
+		sc = append(sc, arrowColumn(fld))
+	}
+	dt := etable.New(sc, 0)
+	for ri := 0; ri < rdr.NumRecords(); ri++ {
+		rec, err := rdr.Record(ri)
+		if err != nil {
+			return nil, fmt.Errorf("OpenArrowLog: %s: %v", fnm, err)
+		}
+		st := dt.Rows
+		dt.SetNumRows(st + int(rec.NumRows()))
+		for ci, arr := range rec.Columns() {
+			col := dt.Cols[ci]
+			if la, ok := arr.(*array.FixedSizeList); ok {
+				csz := cellSize(col)
+				readArrowVals(col, la.ListValues(), st*csz, int(rec.NumRows())*csz)
+			} else {
+				readArrowVals(col, arr, st, int(rec.NumRows()))
+			}
+		}
+	}
+	return dt, nil
+}
+
+// arrowColumn returns the column of a table for an Arrow field written by ArrowLog.
+func arrowColumn(fld arrow.Field) etable.Column {
+	typ := fld.Type
+	col := etable.Column{Name: fld.Name}
+	if lt, ok := typ.(*arrow.FixedSizeListType); ok {
+		typ = lt.Elem()
+		col.CellShape = []int{int(lt.Len())}
+		if i := fld.Metadata.FindKey("shape"); i >= 0 {
+			col.CellShape = nil
+			for _, s := range strings.Split(fld.Metadata.Values()[i], ",") {
+				n, _ := strconv.Atoi(s)
+				col.CellShape = append(col.CellShape, n)
+			}
+		}
+		if i := fld.Metadata.FindKey("dims"); i >= 0 {
+			col.DimNames = strings.Split(fld.Metadata.Values()[i], ",")
+		}
+	}
+	switch typ.ID() {
+	case arrow.BOOL:
+		col.Type = etensor.BOOL
+	case arrow.FLOAT32:
+		col.Type = etensor.FLOAT32
+	case arrow.FLOAT64:
+		col.Type = etensor.FLOAT64
+	case arrow.STRING:
+		col.Type = etensor.STRING
+	default:
+		col.Type = etensor.INT64
+	}
+	return col
+}
+
+// readArrowVals sets the n values of col starting at index st from those of arr.
+func readArrowVals(col etensor.Tensor, arr array.Interface, st, n int) {
+	for i := 0; i < n; i++ {
+		switch at := arr.(type) {
+		case *array.Boolean:
+			if at.Value(i) {
+				col.SetFloat1D(st+i, 1)
+			}
+		case *array.Float32:
+			col.SetFloat1D(st+i, float64(at.Value(i)))
+		case *array.Float64:
+			col.SetFloat1D(st+i, at.Value(i))
+		case *array.String:
+			col.SetString1D(st+i, at.Value(i))
+		case *array.Int64:
+			col.SetFloat1D(st+i, float64(at.Value(i)))
+		}
+	}
+}
+
+// ParseLogScopes parses a comma-separated list of logs, each Mode:Time,
+// e.g., "Train:Epoch,Test:Trial".
+func ParseLogScopes(spec string) ([]etime.ScopeKey, error) {
+	var sks []etime.ScopeKey
+	for _, ms := range strings.Split(spec, ",") {
+		ms = strings.TrimSpace(ms)
+		if ms == "" {
+			continue
+		}
+		mt := strings.SplitN(ms, ":", 2)
+		var mode etime.Modes
+		var time etime.Times
+		if len(mt) != 2 || mode.FromString(mt[0]) != nil || time.FromString(mt[1]) != nil {
+			return nil, fmt.Errorf("ParseLogScopes: %q is not of the form Mode:Time, e.g., Train:Epoch", ms)
+		}
+		sks = append(sks, etime.Scope(mode, time))
+	}
+	return sks, nil
+}
+
+// logFileNames are the names used in the log file names of the logs
+// that are saved by default.
+var logFileNames = map[etime.ScopeKey]string{
+	etime.Scope(etime.Train, etime.Epoch): "epc",
+	etime.Scope(etime.Test, etime.Epoch):  "testepc",
+	etime.Scope(etime.Train, etime.Run):   "run",
+	etime.Scope(etime.Test, etime.Trial):  "testtrial",
+}
+
+// ConfigArrowLogs creates Arrow IPC files for the logs given by the -arrow
+// flag, named like the .tsv logs but with an .arrow extension.
+func (ss *Sim) ConfigArrowLogs() {
+	if ss.CmdArgs.arrowLogs == "" {
+		return
+	}
+	var sks []etime.ScopeKey
+	if ss.CmdArgs.arrowLogs == "all" {
+		for sk, lt := range ss.Logs.Tables {
+			if lt.File != nil {
+				sks = append(sks, sk)
+			}
+		}
+	} else {
+		var err error
+		if sks, err = ParseLogScopes(ss.CmdArgs.arrowLogs); err != nil {
+			fmt.Println(err)
+			return
+		}
+	}
+	if elog.LogDir != "" {
+		os.MkdirAll(elog.LogDir, 0755)
+	}
+	for _, sk := range sks {
+		lognm, has := logFileNames[sk]
+		if !has {
+			mode, time := sk.ModeAndTimeStr()
+			lognm = strings.ToLower(mode + time)
+		}
+		fnm := strings.TrimSuffix(ss.LogFileName(lognm), ".tsv") + ".arrow"
+		if err := ss.SetArrowLog(sk, filepath.Join(elog.LogDir, fnm)); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// SetArrowLog saves the log for given scope to the given Arrow IPC file,
+// from the next row that is logged on, see ArrowLog.
+func (ss *Sim) SetArrowLog(sk etime.ScopeKey, fnm string) error {
+	lt := ss.Logs.TableDetailsScope(sk)
+	if lt == nil {
+		return fmt.Errorf("SetArrowLog: there is no %s log", sk)
+	}
+	al, err := NewArrowLog(fnm, lt.Table)
+	if err != nil {
+		return err
+	}
+	if ss.ArrowLogs == nil {
+		ss.ArrowLogs = make(map[etime.ScopeKey]*ArrowLog)
+	}
+	if prv, has := ss.ArrowLogs[sk]; has {
+		prv.Close()
+	}
+	ss.ArrowLogs[sk] = al
+	fmt.Printf("Saving log to: %s\n", fnm)
+	return nil
+}
+
+// logArrowRow appends given row of the log for mode, time to its ArrowLog, if it has one.
+func (ss *Sim) logArrowRow(mode etime.Modes, time etime.Times, row int) {
+	al, has := ss.ArrowLogs[etime.Scope(mode, time)]
+	if !has {
+		return
+	}
+	if err := al.AppendRow(ss.Logs.Table(mode, time), row); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// CloseLogFiles closes all the open log files, including ArrowLogs.
+func (ss *Sim) CloseLogFiles() {
+	ss.addLogFiles()
+	ss.Logs.CloseLogFiles()
+	for sk, al := range ss.ArrowLogs {
+		if err := al.Close(); err != nil {
+			fmt.Println(err)
+		}
+		delete(ss.ArrowLogs, sk)
+	}
+	ss.closeCycleRecorders()
+}
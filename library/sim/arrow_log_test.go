@@ -0,0 +1,43 @@
+package sim_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/etime"
+)
+
+func TestArrowLog(t *testing.T) {
+	ss := newTestSim()
+	sk := etime.Scope(etime.Test, etime.Trial)
+	fnm := filepath.Join(t.TempDir(), "testtrial.arrow")
+	if err := ss.SetArrowLog(sk, fnm); err != nil {
+		t.Fatal(err)
+	}
+	ss.TestEpoch()
+	ss.CloseLogFiles()
+
+	want := ss.Logs.Table(etime.Test, etime.Trial)
+	got, err := sim.OpenArrowLog(fnm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Rows != want.Rows || len(got.Cols) != len(want.Cols) {
+		t.Fatalf("expected %d rows and %d columns, got %d and %d", want.Rows, len(want.Cols), got.Rows, len(got.Cols))
+	}
+	for ci, col := range want.Cols {
+		gcol := got.Cols[ci]
+		if fmt.Sprint(gcol.Shapes()) != fmt.Sprint(col.Shapes()) || fmt.Sprint(gcol.DimNames()[1:]) != fmt.Sprint(col.DimNames()[1:]) {
+			t.Errorf("column %s has shape %v %v, expected %v %v", want.ColNames[ci], gcol.Shapes(), gcol.DimNames(), col.Shapes(), col.DimNames())
+			continue
+		}
+		for i := 0; i < col.Len(); i++ {
+			if gcol.StringVal1D(i) != col.StringVal1D(i) {
+				t.Errorf("column %s value %d is %s, expected %s", want.ColNames[ci], i, gcol.StringVal1D(i), col.StringVal1D(i))
+				break
+			}
+		}
+	}
+}
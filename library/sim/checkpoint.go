@@ -0,0 +1,436 @@
+package sim
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+
+	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/elog"
+	"github.com/emer/emergent/etime"
+	"github.com/emer/emergent/ringidx"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// Checkpoint holds everything needed to resume a training run exactly where it
+// left off: the full network state (not just the weights), the counters of both
+// environments and any other state of them (see CheckpointEnv), the stats, the
+// log tables and the state of the random source of the Sim.
+// Checkpoints are only written at the end of a training epoch.
+type Checkpoint struct {
+	Run        int       `desc:"run that was in progress"`
+	TrainEpoch int       `desc:"next training epoch to run"`
+	TrainTrial int       `desc:"training env trial counter"`
+	TestEpoch  int       `desc:"test env epoch counter"`
+	TestTrial  int       `desc:"test env trial counter"`
+	TrainOrder []int     `desc:"presentation order of the training env"`
+	TestOrder  []int     `desc:"presentation order of the testing env"`
+	TrainState []byte    `desc:"state of the training env, if it is a CheckpointEnv"`
+	TestState  []byte    `desc:"state of the testing env, if it is a CheckpointEnv"`
+	Time       axon.Time `desc:"axon timing state"`
+	Interval   int       `desc:"checkpoint interval in epochs that was in effect, so a resumed run saves checkpoints at the same points"`
+	RndSeeds   []int64   `desc:"the per-run random seeds"`
+	RandSeed   int64     `desc:"seed of the Rand of the Sim, as of the start of the run"`
+	RandN      uint64    `desc:"number of values drawn from the Rand of the Sim since it was seeded"`
+	Floats     map[string]float64
+	Ints       map[string]int
+	Strings    map[string]string
+	SlowCtr    int               `desc:"network counter for SlowAdapt"`
+	Layers     []LayerState      `desc:"per-layer neuron state"`
+	Prjns      []PrjnState       `desc:"per-projection synapse state, including the learning rate"`
+	Logs       []LogTableState   `desc:"contents of all log tables"`
+	Extra      map[string][]byte `desc:"state saved by other components via CheckpointSavers"`
+}
+
+// LayerState is the dynamic state of one axon.Layer.
+type LayerState struct {
+	Name    string
+	Neurons []axon.Neuron
+	Pools   []axon.Pool
+	ActAvg  axon.ActAvgVals
+	CosDiff axon.CosDiffStats
+}
+
+// PrjnState is the dynamic state of one axon.Prjn, including the learning rate
+// modulation currently applied to it.
+type PrjnState struct {
+	Name     string
+	Syns     []axon.Synapse
+	GScale   axon.GScaleVals
+	Gidx     ringidx.FIx
+	GBuf     []float32
+	GnmdaBuf []float32
+	Lrate    axon.LrateParams
+}
+
+// LogTableState is the raw contents of one log table, column by column.
+type LogTableState struct {
+	Scope   etime.ScopeKey
+	Rows    int
+	Floats  map[string][]float64
+	Strings map[string][]string
+}
+
+// CheckpointSaver lets other components add their own state to a checkpoint.
+// Save returns the bytes to store under Name, and Load receives them back on resume.
+type CheckpointSaver struct {
+	Name string
+	Save func() ([]byte, error)
+	Load func(b []byte) error
+}
+
+// CheckpointFileName returns the checkpoint file name for the current run.
+// There is one rolling checkpoint file per run.
+func (ss *Sim) CheckpointFileName() string {
+	return ss.Net.Nm + "_" + ss.RunName() + fmt.Sprintf("_%03d", ss.Run.Cur) + ".ckpt.gz"
+}
+
+// SaveCheckpointIfDue writes a checkpoint if one is due at the end of the given
+// training epoch, according to CmdArgs.CheckpointInterval.
+func (ss *Sim) SaveCheckpointIfDue(epc int) {
+	if ss.CmdArgs.CheckpointInterval <= 0 || (epc+1)%ss.CmdArgs.CheckpointInterval != 0 {
+		return
+	}
+	fnm := ss.CheckpointFileName()
+	if err := ss.SaveCheckpoint(fnm, epc+1); err != nil {
+		fmt.Printf("Error saving checkpoint %s: %v\n", fnm, err)
+		return
+	}
+	ss.Manifest.AddFile(fnm)
+}
+
+// SaveCheckpoint writes the complete state of the run to the given file,
+// recording nextEpoch as the training epoch to resume from.
+// The state of ss.Rand is recorded as its seed and the number of values drawn
+// from it since, because math/rand state cannot be serialized directly -- a run
+// that is resumed from this file thus sees exactly the same random sequence
+// as the run that wrote it. Random draws of the network itself from the global
+// source, e.g., for noise, are not restored.
+func (ss *Sim) SaveCheckpoint(filename string, nextEpoch int) error {
+	trnState, err := saveEnvState(ss.TrainEnv)
+	if err != nil {
+		return err
+	}
+	tstState, err := saveEnvState(ss.TestEnv)
+	if err != nil {
+		return err
+	}
+	ck := &Checkpoint{
+		Run:        ss.Run.Cur,
+		TrainEpoch: nextEpoch,
+		TrainTrial: ss.TrainEnv.Trial().Cur,
+		TestEpoch:  ss.TestEnv.Epoch().Cur,
+		TestTrial:  ss.TestEnv.Trial().Cur,
+		TrainOrder: append([]int{}, ss.TrainEnv.Order()...),
+		TestOrder:  append([]int{}, ss.TestEnv.Order()...),
+		TrainState: trnState,
+		TestState:  tstState,
+		Time:       ss.Time,
+		Interval:   ss.CmdArgs.CheckpointInterval,
+		RndSeeds:   ss.CmdArgs.RndSeeds,
+		RandSeed:   ss.randSrc.seed,
+		RandN:      ss.randSrc.n,
+		Floats:     ss.Stats.Floats,
+		Ints:       ss.Stats.Ints,
+		Strings:    ss.Stats.Strings,
+		SlowCtr:    ss.Net.SlowCtr,
+		Extra:      make(map[string][]byte),
+	}
+	ck.Layers = ss.LayerStates()
+	ck.Prjns = ss.PrjnStates(true)
+	for sk, lt := range ss.Logs.Tables {
+		ck.Logs = append(ck.Logs, saveLogTable(sk, lt.Table))
+	}
+	for _, sv := range ss.CheckpointSavers {
+		b, err := sv.Save()
+		if err != nil {
+			return fmt.Errorf("checkpoint %s: %w", sv.Name, err)
+		}
+		ck.Extra[sv.Name] = b
+	}
+
+	tmp := filename + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	gz := gzip.NewWriter(f)
+	err = gob.NewEncoder(gz).Encode(ck)
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+// LoadCheckpoint restores the state saved by SaveCheckpoint. It must be called
+// after the network has been built and the logs configured, and before Train.
+func (ss *Sim) LoadCheckpoint(filename string) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	ck := &Checkpoint{}
+	if err := gob.NewDecoder(gz).Decode(ck); err != nil {
+		return fmt.Errorf("reading checkpoint %s: %w", filename, err)
+	}
+
+	if err := ss.SetLayerStates(ck.Layers); err != nil {
+		return err
+	}
+	if err := ss.SetPrjnStates(ck.Prjns); err != nil {
+		return err
+	}
+	ss.Net.SlowCtr = ck.SlowCtr
+
+	ss.Run.Cur = ck.Run
+	ss.TrainEnv.Epoch().Cur = ck.TrainEpoch
+	ss.TrainEnv.Trial().Cur = ck.TrainTrial
+	ss.TestEnv.Epoch().Cur = ck.TestEpoch
+	ss.TestEnv.Trial().Cur = ck.TestTrial
+	if len(ss.TrainEnv.Order()) == len(ck.TrainOrder) {
+		copy(ss.TrainEnv.Order(), ck.TrainOrder)
+	}
+	if len(ss.TestEnv.Order()) == len(ck.TestOrder) {
+		copy(ss.TestEnv.Order(), ck.TestOrder)
+	}
+	if err := loadEnvState(ss.TrainEnv, ck.TrainState); err != nil {
+		return err
+	}
+	if err := loadEnvState(ss.TestEnv, ck.TestState); err != nil {
+		return err
+	}
+	ss.Time = ck.Time
+	ss.CmdArgs.RndSeeds = ck.RndSeeds
+	if ss.CmdArgs.CheckpointInterval == 0 {
+		ss.CmdArgs.CheckpointInterval = ck.Interval
+	}
+	ss.Stats.Floats = ck.Floats
+	ss.Stats.Ints = ck.Ints
+	ss.Stats.Strings = ck.Strings
+
+	for _, ls := range ck.Logs {
+		lt, ok := ss.Logs.Tables[ls.Scope]
+		if !ok {
+			continue
+		}
+		loadLogTable(ls, lt)
+	}
+	for _, sv := range ss.CheckpointSavers {
+		b, ok := ck.Extra[sv.Name]
+		if !ok {
+			continue
+		}
+		if err := sv.Load(b); err != nil {
+			return fmt.Errorf("checkpoint %s: %w", sv.Name, err)
+		}
+	}
+	ss.randSrc.restore(ck.RandSeed, ck.RandN)
+	fmt.Printf("Resuming run %d at epoch %d from: %s\n", ck.Run, ck.TrainEpoch, filepath.Base(filename))
+	return nil
+}
+
+// saveEnvState returns the state of ev, if it is a CheckpointEnv.
+func saveEnvState(ev Environment) ([]byte, error) {
+	ce, ok := ev.(CheckpointEnv)
+	if !ok {
+		return nil, nil
+	}
+	b, err := ce.SaveState()
+	if err != nil {
+		return nil, fmt.Errorf("checkpoint of env %s: %w", ev.Name(), err)
+	}
+	return b, nil
+}
+
+// loadEnvState restores the state of ev, if it is a CheckpointEnv and there is one.
+func loadEnvState(ev Environment, b []byte) error {
+	ce, ok := ev.(CheckpointEnv)
+	if !ok || b == nil {
+		return nil
+	}
+	if err := ce.LoadState(b); err != nil {
+		return fmt.Errorf("checkpoint of env %s: %w", ev.Name(), err)
+	}
+	return nil
+}
+
+// randSource is the source of the Rand of a Sim. It counts the values drawn
+// since it was seeded, so that its state can be saved in checkpoints, and
+// restored by seeding it again and drawing as many.
+type randSource struct {
+	src  rand.Source64
+	seed int64
+	n    uint64
+}
+
+func newRandSource(seed int64) *randSource {
+	return &randSource{src: rand.NewSource(seed).(rand.Source64), seed: seed}
+}
+
+func (rs *randSource) Seed(seed int64) {
+	rs.src.Seed(seed)
+	rs.seed = seed
+	rs.n = 0
+}
+
+func (rs *randSource) Int63() int64 {
+	rs.n++
+	return rs.src.Int63()
+}
+
+func (rs *randSource) Uint64() uint64 {
+	rs.n++
+	return rs.src.Uint64()
+}
+
+// restore puts the source back in the state it was in after n values were
+// drawn since it was seeded with seed.
+func (rs *randSource) restore(seed int64, n uint64) {
+	rs.Seed(seed)
+	for ; rs.n < n; rs.n++ {
+		rs.src.Uint64()
+	}
+}
+
+// LayerStates returns a copy of the current dynamic state of all layers.
+func (ss *Sim) LayerStates() []LayerState {
+	var lss []LayerState
+	for _, lyi := range ss.Net.Layers {
+		ly := lyi.(axon.AxonLayer).AsAxon()
+		lss = append(lss, LayerState{Name: ly.Nm, Neurons: append([]axon.Neuron(nil), ly.Neurons...),
+			Pools: append([]axon.Pool(nil), ly.Pools...), ActAvg: ly.ActAvg, CosDiff: ly.CosDiff})
+	}
+	return lss
+}
+
+// SetLayerStates restores layer state saved by LayerStates.
+func (ss *Sim) SetLayerStates(lss []LayerState) error {
+	for _, ls := range lss {
+		lyi := ss.Net.LayerByName(ls.Name)
+		if lyi == nil {
+			return fmt.Errorf("layer %s not found in network", ls.Name)
+		}
+		ly := lyi.(axon.AxonLayer).AsAxon()
+		if len(ly.Neurons) != len(ls.Neurons) || len(ly.Pools) != len(ls.Pools) {
+			return fmt.Errorf("saved state of layer %s does not match network size", ls.Name)
+		}
+		copy(ly.Neurons, ls.Neurons)
+		copy(ly.Pools, ls.Pools)
+		ly.ActAvg = ls.ActAvg
+		ly.CosDiff = ls.CosDiff
+	}
+	return nil
+}
+
+// PrjnStates returns a copy of the current dynamic state of all projections,
+// including the synapses only if syns is true.
+func (ss *Sim) PrjnStates(syns bool) []PrjnState {
+	var pss []PrjnState
+	for _, lyi := range ss.Net.Layers {
+		for _, pji := range lyi.(axon.AxonLayer).AsAxon().RcvPrjns {
+			pj := pji.(axon.AxonPrjn).AsAxon()
+			ps := PrjnState{Name: pj.Name(), GScale: pj.GScale, Gidx: pj.Gidx, GBuf: append([]float32(nil), pj.GBuf...),
+				GnmdaBuf: append([]float32(nil), pj.GnmdaBuf...), Lrate: pj.Learn.Lrate}
+			if syns {
+				ps.Syns = append([]axon.Synapse(nil), pj.Syns...)
+			}
+			pss = append(pss, ps)
+		}
+	}
+	return pss
+}
+
+// SetPrjnStates restores projection state saved by PrjnStates.
+// Synapses are left as they are for states saved without them.
+func (ss *Sim) SetPrjnStates(pss []PrjnState) error {
+	prjns := make(map[string]*axon.Prjn)
+	for _, lyi := range ss.Net.Layers {
+		for _, pji := range lyi.(axon.AxonLayer).AsAxon().RcvPrjns {
+			pj := pji.(axon.AxonPrjn).AsAxon()
+			prjns[pj.Name()] = pj
+		}
+	}
+	for _, ps := range pss {
+		pj, ok := prjns[ps.Name]
+		if !ok || len(pj.GBuf) != len(ps.GBuf) || (ps.Syns != nil && len(pj.Syns) != len(ps.Syns)) {
+			return fmt.Errorf("saved state of projection %s does not match network", ps.Name)
+		}
+		if ps.Syns != nil {
+			copy(pj.Syns, ps.Syns)
+		}
+		copy(pj.GBuf, ps.GBuf)
+		copy(pj.GnmdaBuf, ps.GnmdaBuf)
+		pj.GScale = ps.GScale
+		pj.Gidx = ps.Gidx
+		pj.Learn.Lrate = ps.Lrate
+	}
+	return nil
+}
+
+// saveLogTable copies out the raw column values of a log table.
+func saveLogTable(sk etime.ScopeKey, dt *etable.Table) LogTableState {
+	ls := LogTableState{Scope: sk, Rows: dt.Rows, Floats: make(map[string][]float64), Strings: make(map[string][]string)}
+	for ci, col := range dt.Cols {
+		nm := dt.ColNames[ci]
+		if col.DataType() == etensor.STRING {
+			vals := make([]string, col.Len())
+			for i := range vals {
+				vals[i] = col.StringVal1D(i)
+			}
+			ls.Strings[nm] = vals
+		} else {
+			var vals []float64
+			col.Floats(&vals)
+			ls.Floats[nm] = vals
+		}
+	}
+	return ls
+}
+
+// loadLogTable restores the rows saved by saveLogTable, and re-writes them to
+// the log file if one is open, so the file on disk also covers the whole run.
+func loadLogTable(ls LogTableState, lt *elog.LogTable) {
+	dt := lt.Table
+	dt.SetNumRows(ls.Rows)
+	for ci, col := range dt.Cols {
+		nm := dt.ColNames[ci]
+		if vals, ok := ls.Strings[nm]; ok && len(vals) == col.Len() {
+			for i, v := range vals {
+				col.SetString1D(i, v)
+			}
+		} else if vals, ok := ls.Floats[nm]; ok && len(vals) == col.Len() {
+			col.SetFloats(vals)
+		}
+	}
+	lt.ResetIdxViews()
+	writeLogFile(lt)
+}
+
+// writeLogFile writes all the rows of the log table to its file, if one is open.
+func writeLogFile(lt *elog.LogTable) {
+	dt := lt.Table
+	if lt.File == nil || dt.Rows == 0 {
+		return
+	}
+	dt.WriteCSVHeaders(lt.File, etable.Tab)
+	lt.WroteHeaders = true
+	for row := 0; row < dt.Rows; row++ {
+		dt.WriteCSVRow(lt.File, row, etable.Tab)
+	}
+}
@@ -0,0 +1,91 @@
+package sim_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Astera-org/models/library/common"
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/etime"
+)
+
+// weights returns all the synaptic weights of the network of ss.
+func weights(ss *sim.Sim) []float32 {
+	var wts []float32
+	for _, ly := range ss.Net.Layers {
+		for _, pj := range ly.(axon.AxonLayer).AsAxon().RcvPrjns {
+			for _, sy := range pj.(axon.AxonPrjn).AsAxon().Syns {
+				wts = append(wts, sy.Wt)
+			}
+		}
+	}
+	return wts
+}
+
+func TestCheckpointResume(t *testing.T) {
+	inTempDir(t) // checkpoints are saved in the working directory
+	cfg := func(ss *sim.Sim) {
+		ss.CmdArgs.MaxRuns = 1
+		ss.CmdArgs.MaxEpcs = 4
+		ss.CmdArgs.CheckpointInterval = 2
+	}
+	ss := newTestSimWith(cfg)
+	common.AddSimpleCallbacks(ss)
+	ss.TestInterval = 1
+	trl := -1
+	// the checkpoint after 2 epochs is overwritten by the one after 4
+	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, sim.TrainingCallbacks{
+		OnEpochStart: func() {
+			if ss.Trainer.EvalMode != etime.Train || ss.TrainEnv.Epoch().Cur != 2 {
+				return
+			}
+			b, err := os.ReadFile(ss.CheckpointFileName())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile("resume.ckpt.gz", b, 0644); err != nil {
+				t.Fatal(err)
+			}
+			trl = ss.TrainEnv.Trial().Cur
+		},
+	})
+	ss.Train(etime.TimesN)
+
+	rs := newTestSimWith(cfg)
+	common.AddSimpleCallbacks(rs)
+	rs.TestInterval = 1
+	if err := rs.LoadCheckpoint("resume.ckpt.gz"); err != nil {
+		t.Fatal(err)
+	}
+	if rs.TrainEnv.Epoch().Cur != 2 {
+		t.Fatalf("expected to resume at epoch 2, not %d", rs.TrainEnv.Epoch().Cur)
+	}
+	if rs.TrainEnv.Trial().Cur != trl {
+		t.Fatalf("expected to resume at trial %d, not %d", trl, rs.TrainEnv.Trial().Cur)
+	}
+	rs.Train(etime.TimesN)
+
+	wts, rwts := weights(ss), weights(rs)
+	if len(wts) != len(rwts) || len(wts) == 0 {
+		t.Fatalf("expected the same number of weights, got %d and %d", len(wts), len(rwts))
+	}
+	for i := range wts {
+		if wts[i] != rwts[i] {
+			t.Fatalf("weight %d is %g after resuming, and %g without", i, rwts[i], wts[i])
+		}
+	}
+	for _, mode := range []etime.Modes{etime.Train, etime.Test} {
+		dt, rdt := ss.Logs.Table(mode, etime.Epoch), rs.Logs.Table(mode, etime.Epoch)
+		if dt.Rows != 4 || rdt.Rows != dt.Rows {
+			t.Fatalf("%s: expected 4 epochs, got %d and %d after resuming", mode, dt.Rows, rdt.Rows)
+		}
+		for _, col := range []string{"UnitErr", "PctErr", "CosDiff"} {
+			for row := 0; row < dt.Rows; row++ {
+				if v, rv := dt.CellFloat(col, row), rdt.CellFloat(col, row); v != rv {
+					t.Errorf("%s %s of epoch %d is %g after resuming, and %g without", mode, col, row, rv, v)
+				}
+			}
+		}
+	}
+}
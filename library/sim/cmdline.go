@@ -7,6 +7,8 @@ import (
 	"github.com/emer/emergent/etime"
 	"io/ioutil"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/emer/emergent/netview"
 	"github.com/emer/emergent/params"
@@ -29,12 +31,30 @@ type CmdArgs struct {
 	note         string
 	hyperFile    string
 	paramsFile   string
+	fileSets     params.Sets // sets loaded from paramsFile
+	resumeFile   string
+	lrateSched   string
+	stopRules    string
+	searchFile   string
+	arrowLogs    string
+	metricsAddr  string
+	rsaInterval  int
+	rasters      string
+	cycleLog     string
+	snapshots    string
+	split        string
+	aggRun       string
+	aggEpoch     string
+	wtEvol       string
 
 	NoRun        bool `desc:"If true, don't run at all.'"`
 	MaxRuns      int  `desc:"maximum number of model runs to perform (starting from StartRun)"`
 	MaxEpcs      int  `desc:"maximum number of epochs to run per model run"`
 	StartRun     int  `desc:"starting run number -- typically 0 but can be set in command args for parallel runs on a cluster"`
 	PreTrainEpcs int  `desc:"number of epochs to run for pretraining"`
+
+	CheckpointInterval int `desc:"if > 0, save a checkpoint of the run every this many training epochs"`
+	Parallel           int `desc:"if > 1, do this many runs at once, each in its own Sim -- requires Sim.NewSimFunc"`
 }
 
 // ParseArgs updates the Sim object with command line arguments.
@@ -55,7 +75,24 @@ func (ss *Sim) ParseArgs() {
 	flag.BoolVar(&ss.CmdArgs.saveNetData, "netdata", false, "if true, save network activation etc data from testing trials, for later viewing in netview")
 	flag.BoolVar(&ss.CmdArgs.NoGui, "nogui", len(os.Args) > 1, "if not passing any other args and want to run nogui, use nogui")
 	flag.StringVar(&ss.CmdArgs.hyperFile, "hyperFile", "", "Name of the file to output hyperparameter data. If not empty string, program should write and then exit")
-	flag.StringVar(&ss.CmdArgs.paramsFile, "paramsFile", "", "Name of the file to input parameters from.")
+	flag.StringVar(&ss.CmdArgs.paramsFile, "paramsFile", "", "JSON, TOML or YAML file with param sets to add to the compiled-in ones, replacing any with the same name -- the sets to use are still chosen with -params")
+	flag.IntVar(&ss.CmdArgs.CheckpointInterval, "ckpt", 0, "if > 0, save a checkpoint every this many training epochs, which can be continued with -resume")
+	flag.StringVar(&ss.CmdArgs.resumeFile, "resume", "", "checkpoint file to resume a run from, as written with -ckpt")
+	flag.StringVar(&ss.CmdArgs.lrateSched, "lrsched", "", "learning rate schedule policy (step, exp, cosine, warmup, plateau), optionally followed by :Field=Value,... settings, e.g., cosine:MaxEpochs=200,Min=0.05")
+	flag.IntVar(&ss.CmdArgs.Parallel, "parallel", 0, "if > 1, do this many runs at once in separate goroutines, each with its own network, environment, seed and log files")
+	flag.StringVar(&ss.CmdArgs.searchFile, "search", "", "JSON file with the settings of a hyperparameter search (see sim.HyperSearch) to do instead of the usual runs -- the results are saved in the logs")
+	flag.StringVar(&ss.CmdArgs.arrowLogs, "arrow", "", "logs to also save as Arrow IPC files, with tensor columns as fixed size lists -- a comma-separated list of Mode:Time, e.g., Train:Epoch,Test:Trial, or all for all the logs saved as .tsv files")
+	flag.StringVar(&ss.CmdArgs.metricsAddr, "metrics", "", "address to serve the progress of the run on over HTTP, e.g., localhost:9090 -- logged rows are streamed as Server-Sent Events at /events, and the current stats are at /metrics, for Prometheus")
+	flag.IntVar(&ss.CmdArgs.rsaInterval, "rsa", 0, "if > 0, do a representational similarity analysis of the hidden layers over the test patterns every this many training epochs -- it is done when testing, so it should be a multiple of the test interval")
+	flag.StringVar(&ss.CmdArgs.rasters, "rasters", "", "trials to save the spike rasters of, to a gzipped file that can be read with sim.OpenTrialRecords -- Train, Test or all, optionally followed by :Every=N to only do every N epochs, and Trials=N to only do the first N trials of those, e.g., Test:Every=10,Trials=5")
+	flag.StringVar(&ss.CmdArgs.cycleLog, "cyclelog", "", "trials to save the cycle log of, with the average Ge and Act of the layers, to a gzipped file that can be read with sim.OpenTrialRecords -- in the same form as -rasters")
+	flag.StringVar(&ss.CmdArgs.snapshots, "snapshots", "", "when to save snapshots of the weights during training runs, as Field=Value,... settings of sim.WtsSnapshots, e.g., Every=10,FirstZero=true,Best=PctErr -- the initial weights are also saved unless Init=false")
+	flag.StringVar(&ss.CmdArgs.wtEvol, "wtevol", "", "instead of running, analyze the weights snapshots that match this glob pattern, e.g., '*_snap_*.wts.gz', and save the mean, variance, saturation and distance from init of the weights of each projection to the wtevol log file")
+	flag.StringVar(&ss.CmdArgs.split, "split", "", "hold out some of the items of the envs from training, to test generalization, as Field=Value,... settings of sim.PatSplit: Holdout=0.2 for a random 20% in each run, or Folds=5 for 5-fold cross-validation across runs -- the splits are saved in the splits log file, and the test PctErr and generalization gap in the Run log")
+	flag.StringVar(&ss.CmdArgs.aggRun, "aggrun", "", "comma-separated columns of the Train Run log to aggregate across runs, with their mean, SEM and bootstrap confidence interval, in the runagg log file -- defaults to FirstZero,PctCor")
+	flag.StringVar(&ss.CmdArgs.aggEpoch, "aggepoch", "", "comma-separated columns of the Train Epoch log to average across runs into learning curves, with their SEM and bootstrap confidence intervals, in the curves log file -- defaults to PctErr")
+	flag.StringVar(&ss.Expect, "expect", ss.Expect, "acceptance criteria that every run must meet at the end, separated by ;, e.g., FirstZero<=40;PctCor>=0.95 -- if not met, the program exits with a non-zero status. Defaults to those of the model")
+	flag.StringVar(&ss.CmdArgs.stopRules, "stop", "", "early stopping rules, separated by ;, each one of thresh, patience, diverge, or time, followed by :Field=Value,... settings, e.g., patience:Stat=PctErr,Patience=20;time:Minutes=90")
 	flag.Parse()
 	// TODO reformat jsonl to be strings only, causing a read issue
 	if ss.CmdArgs.hyperFile != "" {
@@ -66,9 +103,76 @@ func (ss *Sim) ParseArgs() {
 		return
 	}
 
-	// ToDO from michael to andrew - need to account for paramsFile and extrasheet not always being the same thing - should be separate parameter imo
 	if ss.CmdArgs.paramsFile != "" {
-		ss.ApplyHyperFromCMD(ss.CmdArgs.paramsFile)
+		if err := ss.LoadParamsFile(ss.CmdArgs.paramsFile); err != nil {
+			fmt.Println(err)
+			ss.CmdArgs.NoRun = true
+			return
+		}
+	}
+
+	if err := ss.addStopRules(); err != nil {
+		fmt.Println(err)
+		ss.CmdArgs.NoRun = true
+		return
+	}
+
+	if ss.CmdArgs.lrateSched != "" {
+		var ls LrateSchedule
+		if err := ls.SetFromString(ss.CmdArgs.lrateSched); err != nil {
+			fmt.Println(err)
+			ss.CmdArgs.NoRun = true
+			return
+		}
+	}
+
+	if _, err := ParseExpectations(ss.Expect); err != nil {
+		fmt.Println(err)
+		ss.CmdArgs.NoRun = true
+		return
+	}
+	for _, spec := range []string{ss.CmdArgs.rasters, ss.CmdArgs.cycleLog} {
+		if spec == "" {
+			continue
+		}
+		if _, err := ParseCycleSample(spec); err != nil {
+			fmt.Println(err)
+			ss.CmdArgs.NoRun = true
+			return
+		}
+	}
+
+	if ss.CmdArgs.arrowLogs != "" && ss.CmdArgs.arrowLogs != "all" {
+		if _, err := ParseLogScopes(ss.CmdArgs.arrowLogs); err != nil {
+			fmt.Println(err)
+			ss.CmdArgs.NoRun = true
+			return
+		}
+	}
+
+	if ss.CmdArgs.split != "" {
+		ps, err := ParsePatSplit(ss.CmdArgs.split)
+		if err != nil {
+			fmt.Println(err)
+			ss.CmdArgs.NoRun = true
+			return
+		}
+		ss.Split = ps
+	}
+
+	if ss.CmdArgs.aggRun != "" {
+		ss.RunAgg.RunStats = splitList(ss.CmdArgs.aggRun)
+	}
+	if ss.CmdArgs.aggEpoch != "" {
+		ss.RunAgg.EpochStats = splitList(ss.CmdArgs.aggEpoch)
+	}
+
+	if ss.CmdArgs.snapshots != "" {
+		if _, err := ParseWtsSnapshots(ss.CmdArgs.snapshots); err != nil {
+			fmt.Println(err)
+			ss.CmdArgs.NoRun = true
+			return
+		}
 	}
 
 	if ss.CmdArgs.note != "" {
@@ -94,42 +198,115 @@ func (ss *Sim) ParseArgs() {
 	}
 }
 
-func (ss *Sim) ApplyHyperFromCMD(path string) {
-	ss.CmdArgs.paramsFile = path
-	jsonFile, err := os.Open(ss.CmdArgs.paramsFile)
-	if err != nil {
-		fmt.Println("Params file error: " + err.Error())
-		return
+// addStopRules adds the early stopping rules given by the -stop flag.
+// They are checked by ParseArgs, so the Sims made by NewSimFunc can ignore the error.
+func (ss *Sim) addStopRules() error {
+	if ss.CmdArgs.stopRules == "" {
+		return nil
 	}
-	defer jsonFile.Close()
-	byteValue, _ := ioutil.ReadAll(jsonFile)
-	loadedParams := params.Sets{}
-	json.Unmarshal(byteValue, &loadedParams)
-	if len(loadedParams) == 0 {
-		fmt.Println("Unable to load parameters from file: " + ss.CmdArgs.paramsFile)
-		return
+	rules, err := ParseStopRules(ss.CmdArgs.stopRules)
+	if err != nil {
+		return err
 	}
-	ss.Params.ExtraSets = loadedParams[0].Name // just make them the same
-	ss.Params.Params = append(ss.Params.Params, loadedParams[0])
+	ss.EarlyStop.Add(rules...)
+	return nil
 }
 
-// RunFromArgs uses command line arguments to run the model.
-func (ss *Sim) RunFromArgs() {
+// RunFromArgs uses command line arguments to run the model. It returns an error
+// if the model could not be run, or if it did not meet the expectations in
+// Expect (see -expect), after printing a report of them, so that main can exit
+// with a non-zero status.
+func (ss *Sim) RunFromArgs() error {
 	if ss.CmdArgs.NoRun {
-		return
+		return nil
+	}
+	if err := ss.ValidateParamsFile(); err != nil {
+		return err
+	}
+	if ss.CmdArgs.wtEvol != "" {
+		return ss.SaveWeightEvolution()
+	}
+	if ss.CmdArgs.metricsAddr != "" {
+		ms, err := StartMetricsServer(ss.CmdArgs.metricsAddr)
+		if err != nil {
+			return err
+		}
+		ss.Metrics = ms
+		defer func() {
+			ms.Close()
+			ss.Metrics = nil
+		}()
+	}
+	ss.Manifest = NewManifest(ss)
+	ss.saveManifest()
+	ss.saveSplits()
+	defer func() {
+		ss.Manifest.End = time.Now()
+		ss.saveManifest()
+	}()
+	if ss.CmdArgs.searchFile != "" {
+		if err := ss.RunSearch(); err != nil {
+			return err
+		}
+		return ss.reportExpectations()
+	}
+	if ss.CmdArgs.Parallel > 1 {
+		if ss.NewSimFunc != nil && ss.CmdArgs.resumeFile == "" {
+			if err := ss.RunParallel(ss.CmdArgs.Parallel); err != nil {
+				return err
+			}
+			return ss.reportExpectations()
+		}
+		fmt.Println("Parallel runs are not possible for this sim or when resuming, doing them one at a time")
 	}
 	ss.Init()
+	ss.saveManifest() // with the applied params
+	if err := ss.LrateSched.Validate(ss.Logs.Table(etime.Train, etime.Epoch)); err != nil {
+		return err
+	}
 
 	fmt.Printf("Running %d Runs starting at %d\n", ss.CmdArgs.MaxRuns, ss.CmdArgs.StartRun)
 	ss.Run.Set(ss.CmdArgs.StartRun)
 	ss.Run.Max = ss.CmdArgs.StartRun + ss.CmdArgs.MaxRuns
 	ss.NewRun()
+	if ss.CmdArgs.resumeFile != "" {
+		if err := ss.LoadCheckpoint(ss.CmdArgs.resumeFile); err != nil {
+			return fmt.Errorf("Unable to resume: %v", err)
+		}
+	}
 	ss.Train(etime.TimesN) // Train all Runs
 
-	ss.Logs.CloseLogFiles()
+	ss.CloseLogFiles()
 
 	if ss.CmdArgs.saveNetData {
 		ndfn := ss.Net.Nm + "_" + ss.RunName() + ".netdata.gz"
 		ss.CmdArgs.NetData.SaveJSON(gi.FileName(ndfn))
+		ss.Manifest.AddFile(ndfn)
+	}
+	return ss.reportExpectations()
+}
+
+// reportExpectations prints the report of CheckExpectations, if there are any
+// expectations, and returns its error.
+func (ss *Sim) reportExpectations() error {
+	if ss.Expect == "" {
+		return nil
+	}
+	report, err := ss.CheckExpectations()
+	fmt.Print(report)
+	if err == nil {
+		fmt.Println("All expectations were met")
+	}
+	return err
+}
+
+// splitList splits a comma-separated list, trimming the spaces around the items.
+func splitList(list string) []string {
+	var items []string
+	for _, it := range strings.Split(list, ",") {
+		if it = strings.TrimSpace(it); it != "" {
+			items = append(items, it)
+		}
 	}
+	return items
 }
@@ -0,0 +1,186 @@
+package sim
+
+import (
+	"math"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/gi/gi"
+)
+
+// Confusion is a confusion matrix of the test trials of a classification
+// model, counting the responses given for each target class. The target is
+// the TrialName of the env, and the response is the TrlClosest stat, the name
+// of the pattern closest to the output. It is accumulated over a test epoch,
+// at the end of which the per-class Precision and Recall, and their means,
+// are logged at Test Epoch, and the matrix is saved as the Confusion misc
+// log table, and to a file along with the test trial log.
+type Confusion struct {
+	ClassCol string          `desc:"column of the Pats with the names of the classes -- the first string column if empty, which is usually the one given to ClosestPat"`
+	Classes  []string        `inactive:"+" desc:"names of the classes, in order"`
+	Counts   etensor.Float64 `view:"no-inline" desc:"number of trials for each target class (row) and response class (col)"`
+	Other    etensor.Float64 `view:"no-inline" desc:"number of trials for each target class with a response that is not one of the classes"`
+
+	idx map[string]int // index of each class
+}
+
+// Init sets the classes, and resets the counts.
+func (cf *Confusion) Init(classes []string) {
+	cf.Classes = classes
+	cf.idx = make(map[string]int, len(classes))
+	for i, c := range classes {
+		cf.idx[c] = i
+	}
+	n := len(classes)
+	cf.Counts.SetShape([]int{n, n}, nil, []string{"Target", "Response"})
+	cf.Other.SetShape([]int{n}, nil, []string{"Target"})
+	cf.Reset()
+}
+
+// Reset sets all the counts to zero.
+func (cf *Confusion) Reset() {
+	cf.Counts.SetZeros()
+	cf.Other.SetZeros()
+}
+
+// Incr counts a trial with given target and response classes.
+// Trials with a target that is not one of the classes are ignored.
+func (cf *Confusion) Incr(target, response string) {
+	ti, ok := cf.idx[target]
+	if !ok {
+		return
+	}
+	if ri, ok := cf.idx[response]; ok {
+		cf.Counts.Values[ti*len(cf.Classes)+ri]++
+	} else {
+		cf.Other.Values[ti]++
+	}
+}
+
+// Precision returns the proportion of the responses of class ci that were
+// correct, NaN if there were none.
+func (cf *Confusion) Precision(ci int) float64 {
+	n := len(cf.Classes)
+	sum := 0.0
+	for ti := 0; ti < n; ti++ {
+		sum += cf.Counts.Values[ti*n+ci]
+	}
+	if sum == 0 {
+		return math.NaN()
+	}
+	return cf.Counts.Values[ci*n+ci] / sum
+}
+
+// Recall returns the proportion of the trials with target class ci that got
+// the correct response, NaN if there were none.
+func (cf *Confusion) Recall(ci int) float64 {
+	n := len(cf.Classes)
+	sum := cf.Other.Values[ci]
+	for ri := 0; ri < n; ri++ {
+		sum += cf.Counts.Values[ci*n+ri]
+	}
+	if sum == 0 {
+		return math.NaN()
+	}
+	return cf.Counts.Values[ci*n+ci] / sum
+}
+
+// Scores returns the Precision and Recall of each class.
+func (cf *Confusion) Scores() (prec, rec []float64) {
+	n := len(cf.Classes)
+	prec = make([]float64, n)
+	rec = make([]float64, n)
+	for ci := 0; ci < n; ci++ {
+		prec[ci] = cf.Precision(ci)
+		rec[ci] = cf.Recall(ci)
+	}
+	return
+}
+
+// Table returns the counts as a table, with a row for each target class,
+// and a column for each response class, plus Other.
+func (cf *Confusion) Table() *etable.Table {
+	n := len(cf.Classes)
+	sch := etable.Schema{{"Target", etensor.STRING, nil, nil}}
+	for _, c := range cf.Classes {
+		sch = append(sch, etable.Column{c, etensor.FLOAT64, nil, nil})
+	}
+	sch = append(sch, etable.Column{"Other", etensor.FLOAT64, nil, nil})
+	dt := etable.New(sch, n)
+	dt.SetMetaData("name", "Confusion")
+	for ti, c := range cf.Classes {
+		dt.SetCellString("Target", ti, c)
+		for ri := 0; ri < n; ri++ {
+			dt.Cols[1+ri].SetFloat1D(ti, cf.Counts.Values[ti*n+ri])
+		}
+		dt.Cols[1+n].SetFloat1D(ti, cf.Other.Values[ti])
+	}
+	return dt
+}
+
+// ConfusionClasses returns the unique names in the ClassCol of the Pats,
+// in order, or nil if there are none.
+func (ss *Sim) ConfusionClasses() []string {
+	if ss.Pats == nil {
+		return nil
+	}
+	var col etensor.Tensor
+	if ss.Confusion.ClassCol != "" {
+		col = ss.Pats.ColByName(ss.Confusion.ClassCol)
+	} else {
+		for _, c := range ss.Pats.Cols {
+			if c.DataType() == etensor.STRING {
+				col = c
+				break
+			}
+		}
+	}
+	if col == nil || col.DataType() != etensor.STRING {
+		return nil
+	}
+	var classes []string
+	has := map[string]bool{}
+	for i := 0; i < col.Len(); i++ {
+		c := col.StringVal1D(i)
+		if !has[c] {
+			has[c] = true
+			classes = append(classes, c)
+		}
+	}
+	return classes
+}
+
+// ConfusionRecord counts the current test trial in the confusion matrix.
+func (ss *Sim) ConfusionRecord() {
+	ss.Confusion.Incr(ss.CurrentEnvironment().TrialName().Cur, ss.Stats.String("TrlClosest"))
+}
+
+// ConfusionTable saves the confusion matrix at the end of a test epoch, in the
+// Confusion misc log table, and to a file if the test trial log is saved.
+func (ss *Sim) ConfusionTable() {
+	if len(ss.Confusion.Classes) == 0 {
+		return
+	}
+	dt := ss.Confusion.Table()
+	ss.Logs.MiscTables["Confusion"] = dt
+	if ss.CmdArgs.saveTrialLog {
+		fnm := ss.LogFileName("confusion")
+		dt.SaveCSV(gi.FileName(fnm), etable.Tab, etable.Headers)
+		ss.Manifest.AddFile(fnm)
+	}
+}
+
+// meanNoNaN returns the mean of the values that are not NaN, NaN if there are none.
+func meanNoNaN(vals []float64) float64 {
+	sum, n := 0.0, 0
+	for _, v := range vals {
+		if !math.IsNaN(v) {
+			sum += v
+			n++
+		}
+	}
+	if n == 0 {
+		return math.NaN()
+	}
+	return sum / float64(n)
+}
@@ -0,0 +1,40 @@
+package sim_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/emer/emergent/etime"
+)
+
+func TestConfusion(t *testing.T) {
+	ss := newTestSim()
+	ss.TestAll()
+	cf := &ss.Confusion
+	n := len(cf.Classes)
+	if n == 0 {
+		t.Fatal("no classes in the confusion matrix")
+	}
+	cor, tot := 0.0, 0.0
+	for ti := 0; ti < n; ti++ {
+		for ri := 0; ri < n; ri++ {
+			tot += cf.Counts.Value([]int{ti, ri})
+		}
+		tot += cf.Other.Value1D(ti)
+		cor += cf.Counts.Value([]int{ti, ti})
+	}
+	if int(tot) != ss.TestEnv.Trial().Max {
+		t.Errorf("confusion matrix has %g trials, expected %d", tot, ss.TestEnv.Trial().Max)
+	}
+	dt := ss.Logs.Table(etime.Test, etime.Epoch)
+	if pcterr := dt.CellFloat("PctErr", dt.Rows-1); math.Abs(cor/tot-(1-pcterr)) > 1e-6 {
+		t.Errorf("confusion matrix has %g correct of %g, but PctErr is %g", cor, tot, pcterr)
+	}
+	if prec := dt.CellTensor("Precision", dt.Rows-1); prec.Len() != n {
+		t.Errorf("expected %d precision values, got %d", n, prec.Len())
+	}
+	ct := ss.Logs.MiscTables["Confusion"]
+	if ct == nil || ct.Rows != n || ct.CellString("Target", 0) != cf.Classes[0] {
+		t.Errorf("confusion table was not saved")
+	}
+}
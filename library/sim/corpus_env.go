@@ -7,11 +7,13 @@ package sim
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"math/rand"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/emer/emergent/env"
@@ -26,41 +28,63 @@ import (
 // For input, a simple bag-of-words is used, with words encoded as localist 1-hot
 // units (requiring a large input layer) or using random distributed vectors in a
 // lower-dimensional space.
+// The corpus is read as a stream (see SentenceReader), and only the vocabulary
+// and the NGrams of its words are kept, so with a VocabFile the memory used is
+// bounded by MaxVocab and not by the size of the corpus -- except for the
+// SentOffs in Sequence mode, one int per sentence.
+// The words of each trial are a random walk through the NGrams, which moves on
+// with StartTrial, as LoopTrial calls it, or with Step.
 type CorpusEnv struct {
-	Nm          string             `desc:"name of this environment"`
-	Dsc         string             `desc:"description of this environment"`
-	Words       []string           `desc:"full list of words used for activating state units according to index"`
-	WordMap     map[string]int     `desc:"map of words onto index in Words list"`
-	FreqMap     map[string]float64 `desc:"map of words onto frequency in entire corpus, normalized"`
-	Corpus      []string           `desc:"entire corpus as one long list of words"`
-	Sentences   [][]string         `desc:"full list of sentences"`
-	SentOffs    []int              `desc:"offsets into corpus for each sentence"`
-	NGrams      NGramMap           `desc:"normalized frequency of a word given n-words-1 of context"`
-	WordReps    etensor.Float32    `desc:"map of words into random distributed vector encodings"`
-	CurWords    []string           `desc:"The current words of context"`
-	CurNextWord string             `desc:"The current successor word"`
-	Input       etensor.Float32    `desc:"current window activation state"`
-	Output      etensor.Float32    `desc:"successor word target activation state"`
+	Nm           string             `desc:"name of this environment"`
+	Dsc          string             `desc:"description of this environment"`
+	CorpusFile   string             `desc:"corpus file -- plain text with one sentence per line, or JSON with a Sentences list of lists of words, either of them optionally gzipped (.gz) -- see SentenceReader"`
+	MaxSentences int                `desc:"if > 0, only this many sentences are read from the corpus"`
+	Words        []string           `desc:"full list of words used for activating state units according to index"`
+	WordMap      map[string]int     `desc:"map of words onto index in Words list"`
+	FreqMap      map[string]float64 `desc:"map of words onto frequency in entire corpus, normalized"`
+	NGrams       NGramMap           `desc:"normalized frequency of a word given n-words-1 of context"`
+	NGramCounts  NGramMap           `view:"-" desc:"counts of each word given n-words-1 of context, of all the successors, from which the NGrams are made -- see NGramEval"`
+	WordReps     etensor.Float32    `desc:"map of words into distributed vector encodings, as made according to Encoding"`
+	CurWords     []string           `desc:"The current words of context"`
+	CurNextWord  string             `desc:"The current successor word"`
+	Input        etensor.Float32    `desc:"current window activation state"`
+	Output       etensor.Float32    `desc:"successor word target activation state"`
 
 	NContext       int `desc:"number of words in context (ngram -1)"`
 	NSuccessor     int `desc:"max number of successors in the ngram map"`
 	NRandomizeWord int `desc:"Every this many ticks, reseed the current word"`
 
-	Localist   bool       `desc:"use localist 1-hot encoding of words -- else random dist vectors"`
-	DistPctAct float64    `desc:"distributed representations of words: target percent activity total for WindowSize words all on at same time"`
-	DropOut    bool       `desc:"randomly drop out the highest-frequency inputs"`
-	UseUNK     bool       `desc:"use an UNK token for unknown words -- otherwise just skip"`
-	InputSize  evec.Vec2i `desc:"size of input layer state"`
-	MaxVocab   int        `desc:"maximum number of words representable -- InputSize.X*Y"`
-	VocabFile  string     `desc:"location of the generated vocabulary file"`
-	CorpStart  int        `inactive:"+" desc:"for this processor (MPI), starting index into Corpus"`
-	CorpEnd    int        `inactive:"+" desc:"for this processor (MPI), ending index into Corpus"`
-
-	Run   env.Ctr `view:"inline" desc:"current run of model as provided during Init"`
-	Epoch env.Ctr `view:"inline" desc:"epoch is arbitrary increment of number of times through trial.Max steps"`
-	Trial env.Ctr `view:"inline" desc:"trial is the network training step counter"`
-	Tick  env.Ctr `view:"inline" desc:"tick counts steps through the Corpus"`
-	Block env.Ctr `view:"inline" desc:"block counts iterations through the entire Corpus"`
+	Sequence   bool  `desc:"sequence mode: present the words of the corpus one per trial, in order, with the next word of the sentence as the Output target, instead of a random walk through the NGrams -- the Input is the current word and up to NContext-1 words before it in the sentence, and SeqStart and SeqEnd mark the first and last trials of each sentence"`
+	NSeqTrials int   `inactive:"+" desc:"number of trials in a pass through the corpus in Sequence mode -- the words that have a next word in their sentence"`
+	SentIdx    int   `inactive:"+" desc:"[Sequence] index of the current sentence in the corpus, which is also the GroupName of the trial"`
+	WordIdx    int   `inactive:"+" desc:"[Sequence] index of the current word in the words of the sentence that are in the vocabulary"`
+	SentOffs   []int `inactive:"+" view:"-" desc:"[Sequence] index of the first trial of each sentence of the corpus in a pass through it, by SentIdx, plus NSeqTrials at the end -- the trials of sentence i are SentOffs[i] up to SentOffs[i+1], none for the sentences with less than 2 words in the vocabulary"`
+
+	Localist   bool         `desc:"use localist 1-hot encoding of words -- else random dist vectors"`
+	DistPctAct float64      `desc:"distributed representations of words: target percent activity total for WindowSize words all on at same time"`
+	DropOut    bool         `desc:"randomly drop out the highest-frequency inputs"`
+	UseUNK     bool         `desc:"use an UNK token for unknown words -- otherwise just skip"`
+	InputSize  evec.Vec2i   `desc:"size of input layer state"`
+	MaxVocab   int          `desc:"maximum number of words representable -- InputSize.X*Y if 0"`
+	VocabFile  string       `desc:"vocabulary file, with the words of the corpus and their frequencies, as JSON -- if it exists, the vocabulary is read from it instead of being counted from the corpus, and otherwise the counted vocabulary is saved to it. Not used if empty"`
+	Tokenizer  Tokenizer    `view:"-" desc:"if set, splits the words of the corpus into tokens, e.g., subwords, which are then the words of the env, in its vocabulary, NGrams and WordReps"`
+	BPEFile    string       `desc:"if set and Tokenizer is nil, the Tokenizer is a BPE with the merges in this file -- if it does not exist, they are learned from the corpus, up to MaxVocab tokens, and saved to it. The VocabFile is then of the tokens"`
+	Encoding   WordEncoding `desc:"how the WordReps are made -- random patterns if the Method is empty"`
+
+	RunCtr   env.Ctr          `view:"inline" desc:"current run of model as provided during Init"`
+	EpochCtr env.Ctr          `view:"inline" desc:"epoch is arbitrary increment of number of times through trial.Max steps"`
+	TrialCtr env.Ctr          `view:"inline" desc:"trial is the network training step counter"`
+	Tick     env.Ctr          `view:"inline" desc:"tick counts steps through the Corpus"`
+	Block    env.Ctr          `view:"inline" desc:"block counts iterations through the entire Corpus"`
+	TrialNm  env.CurPrvString `desc:"the current context words, as the name of the trial"`
+	GroupNm  env.CurPrvString `desc:"not used -- the trials have no groups"`
+	Rand     *rand.Rand       `view:"-" desc:"if set, the random source of the walk and the drop out -- otherwise the global one"`
+
+	contexts []string // keys of NGrams, sorted, to pick random contexts from
+
+	seqReader *SentenceReader // [Sequence] reader of the corpus
+	seqSent   []string        // [Sequence] words of the current sentence that are in the vocabulary
+	seqRead   int             // [Sequence] number of sentences read in this pass through the corpus
 }
 
 // NGramMap stores a normalized frequency of a word given n-words-1 of context
@@ -120,14 +144,126 @@ func (ngm *NGramMap) Normalize() {
 
 var epsilon = 1e-7
 
-func (ev *CorpusEnv) Name() string { return ev.Nm }
-func (ev *CorpusEnv) Desc() string { return ev.Dsc }
+func (ev *CorpusEnv) SetName(name string)          { ev.Nm = name }
+func (ev *CorpusEnv) SetDesc(desc string)          { ev.Dsc = desc }
+func (ev *CorpusEnv) Name() string                 { return ev.Nm }
+func (ev *CorpusEnv) Desc() string                 { return ev.Dsc }
+func (ev *CorpusEnv) Run() *env.Ctr                { return &ev.RunCtr }
+func (ev *CorpusEnv) Epoch() *env.Ctr              { return &ev.EpochCtr }
+func (ev *CorpusEnv) Trial() *env.Ctr              { return &ev.TrialCtr }
+func (ev *CorpusEnv) TrialName() *env.CurPrvString { return &ev.TrialNm }
+func (ev *CorpusEnv) GroupName() *env.CurPrvString { return &ev.GroupNm }
+func (ev *CorpusEnv) CurTrialName() string         { return ev.TrialNm.Cur }
+func (ev *CorpusEnv) InputAndOutputLayers() []string {
+	return []string{"Input", "Output"}
+}
+
+// The trials of a corpus are a random walk, with no order or table.
+func (ev *CorpusEnv) Order() []int         { return nil }
+func (ev *CorpusEnv) Sequential() bool     { return false }
+func (ev *CorpusEnv) SetSequential(s bool) {}
+func (ev *CorpusEnv) NameCol() string      { return "" }
+func (ev *CorpusEnv) SetNameCol(s string)  {}
+func (ev *CorpusEnv) GroupCol() string     { return "" }
+func (ev *CorpusEnv) SetGroupCol(s string) {}
+func (ev *CorpusEnv) AssignTable(s string) {}
+
+// SetRand sets the random source of the walk and the drop out.
+func (ev *CorpusEnv) SetRand(rnd *rand.Rand) { ev.Rand = rnd }
+
+func (ev *CorpusEnv) randFloat64() float64 {
+	if ev.Rand != nil {
+		return ev.Rand.Float64()
+	}
+	return rand.Float64()
+}
+
+func (ev *CorpusEnv) randIntn(n int) int {
+	if ev.Rand != nil {
+		return ev.Rand.Intn(n)
+	}
+	return rand.Intn(n)
+}
+
+// corpusState is the state of a CorpusEnv that is saved in checkpoints.
+type corpusState struct {
+	CurWords    []string
+	CurNextWord string
+	Tick        env.Ctr
+	Block       env.Ctr
+	TrialNm     env.CurPrvString
+	SentIdx     int
+	WordIdx     int
+	SeqSent     []string
+	SeqRead     int
+	SeqOpen     bool
+}
+
+// SaveState returns the position of the env in the corpus and its current
+// words, for checkpoints.
+func (ev *CorpusEnv) SaveState() ([]byte, error) {
+	return json.Marshal(&corpusState{
+		CurWords:    ev.CurWords,
+		CurNextWord: ev.CurNextWord,
+		Tick:        ev.Tick,
+		Block:       ev.Block,
+		TrialNm:     ev.TrialNm,
+		SentIdx:     ev.SentIdx,
+		WordIdx:     ev.WordIdx,
+		SeqSent:     ev.seqSent,
+		SeqRead:     ev.seqRead,
+		SeqOpen:     ev.seqReader != nil,
+	})
+}
+
+// LoadState restores the state saved by SaveState. In Sequence mode, the
+// corpus is opened again and read up to the sentence it was at.
+func (ev *CorpusEnv) LoadState(b []byte) error {
+	var st corpusState
+	if err := json.Unmarshal(b, &st); err != nil {
+		return fmt.Errorf("CorpusEnv %s: %w", ev.Nm, err)
+	}
+	if ev.seqReader != nil {
+		ev.seqReader.Close()
+		ev.seqReader = nil
+	}
+	if st.SeqOpen {
+		sr, err := OpenSentences(ev.CorpusFile)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < st.SeqRead; i++ {
+			if _, err := sr.Next(); err != nil {
+				sr.Close()
+				return fmt.Errorf("CorpusEnv %s: resuming at sentence %d of %s: %w", ev.Nm, st.SeqRead, ev.CorpusFile, err)
+			}
+		}
+		ev.seqReader = sr
+	}
+	ev.CurWords = st.CurWords
+	ev.CurNextWord = st.CurNextWord
+	ev.Tick = st.Tick
+	ev.Block = st.Block
+	ev.TrialNm = st.TrialNm
+	ev.SentIdx = st.SentIdx
+	ev.WordIdx = st.WordIdx
+	ev.seqSent = st.SeqSent
+	ev.seqRead = st.SeqRead
+	return nil
+}
 
-// Validate initializes matrix and labels to given size
+// Validate checks that the NGrams have been made from the corpus.
 func (ev *CorpusEnv) Validate() error {
+	if ev.Sequence && ev.NSeqTrials == 0 {
+		return fmt.Errorf("CorpusEnv %s: no sequences -- the corpus %q was not loaded, or has no sentences of 2 words in the vocabulary", ev.Nm, ev.CorpusFile)
+	}
+	if !ev.Sequence && ev.NContext > 0 && len(ev.contexts) == 0 {
+		return fmt.Errorf("CorpusEnv %s: no ngrams -- the corpus %q was not loaded, or has no sentences of %d words in the vocabulary", ev.Nm, ev.CorpusFile, ev.NContext+1)
+	}
 	return nil
 }
 
+// State returns the Input or Output state of the current trial.
 func (ev *CorpusEnv) State(element string) etensor.Tensor {
 	switch element {
 	case "Input":
@@ -139,28 +275,41 @@ func (ev *CorpusEnv) State(element string) etensor.Tensor {
 }
 
 func (ev *CorpusEnv) Init(run int) {
-	ev.Run.Scale = env.Run     //a full training of the network scale
-	ev.Epoch.Scale = env.Epoch //a set of trials
-	ev.Trial.Scale = env.Trial //a single example/ row/ state
-	ev.Run.Init()
-	ev.Epoch.Init()
-	ev.Trial.Init()
-	ev.Run.Cur = run
-	ev.Trial.Cur = 0 // init state -- key so that first Step() = 0
+	ev.RunCtr.Scale = env.Run     //a full training of the network scale
+	ev.EpochCtr.Scale = env.Epoch //a set of trials
+	ev.TrialCtr.Scale = env.Trial //a single example/ row/ state
+	ev.RunCtr.Init()
+	ev.EpochCtr.Init()
+	ev.TrialCtr.Init()
+	ev.RunCtr.Cur = run
+	ev.TrialCtr.Cur = 0 // init state -- key so that first Step() = 0
+	ev.CurWords = make([]string, ev.NContext)
+	ev.CurNextWord = ""
+	if ev.seqReader != nil { // the sequences start over from the start of the corpus
+		ev.seqReader.Close()
+		ev.seqReader = nil
+	}
+	ev.seqSent = nil
+	ev.SentIdx = -1
+	ev.WordIdx = 0
 }
 
+// Config sets the parameters of the env and loads the corpus from inputfile.
+// VocabFile and MaxSentences, if they are used, must be set before.
 func (ev *CorpusEnv) Config(inputfile string, inputsize evec.Vec2i, localist bool, ncontext, ntopsuccessors, nrandomizeword int) {
 	ev.InputSize = inputsize //the shape of the tensor
 	ev.Localist = localist
-	//ev.MaxVocab = ev.InputSize.X * ev.InputSize.Y
-	ev.MaxVocab = 25 //TODO: make this logical
+	if ev.MaxVocab == 0 {
+		ev.MaxVocab = ev.InputSize.X * ev.InputSize.Y
+	}
 	ev.UseUNK = false
-	ev.VocabFile = "stored_vocab_cbt_train.json" //subset of words
 	ev.NContext = ncontext
 	ev.NSuccessor = ntopsuccessors
 	ev.NRandomizeWord = nrandomizeword
 
-	ev.LoadFmFile(inputfile) // load the corpus
+	if err := ev.LoadFmFile(inputfile); err != nil { // load the corpus
+		fmt.Println(err)
+	}
 
 	ev.Input.SetShape([]int{ev.InputSize.Y, ev.InputSize.X}, nil, []string{"Y", "X"})
 	ev.Output.SetShape([]int{ev.InputSize.Y, ev.InputSize.X}, nil, []string{"Y", "X"})
@@ -170,14 +319,8 @@ func (ev *CorpusEnv) Config(inputfile string, inputsize evec.Vec2i, localist boo
 
 }
 
-// JsonData is the full original corpus, in sentence form
-type JsonData struct {
-	Vocab     []string
-	Freqs     []int
-	Sentences [][]string
-}
-
-// JsonVocab is the map-based encoding of just the vocabulary and frequency
+// JsonVocab is the map-based encoding of just the vocabulary and frequency,
+// as saved in the VocabFile
 type JsonVocab struct {
 	Vocab map[string]int
 	Freqs map[string]float64
@@ -195,144 +338,240 @@ func (ev *CorpusEnv) NormalizeFreqs() {
 	}
 }
 
+// LimitVocabulary keeps only the MaxVocab most frequent words, and renumbers
+// them in the WordMap, keeping their order.
 func (ev *CorpusEnv) LimitVocabulary() {
-	freqs := make([]float64, len(ev.FreqMap))
-	idx := 0
-	for _, freq := range ev.FreqMap {
-		freqs[idx] = freq
-		idx++
-	}
-
-	sort.Sort(sort.Reverse(sort.Float64Slice(freqs)))
-
-	if len(freqs) <= ev.MaxVocab {
+	if ev.MaxVocab <= 0 || len(ev.Words) <= ev.MaxVocab {
 		return
 	}
-	threshold := freqs[ev.MaxVocab]
+	byFreq := append([]string(nil), ev.Words...)
+	sort.SliceStable(byFreq, func(i, j int) bool {
+		return ev.FreqMap[byFreq[i]] > ev.FreqMap[byFreq[j]]
+	})
+	keep := make(map[string]bool, ev.MaxVocab)
+	for _, word := range byFreq[:ev.MaxVocab] {
+		keep[word] = true
+	}
+	if ev.UseUNK {
+		keep["[UNK]"] = true
+	}
 
-	newWords := make([]string, 0)
+	newWords := make([]string, 0, len(keep))
 	for _, word := range ev.Words {
-		if ev.FreqMap[word] > threshold {
+		if keep[word] {
 			newWords = append(newWords, word)
+		} else {
+			delete(ev.FreqMap, word)
 		}
 	}
 	ev.Words = newWords
+	ev.WordMap = make(map[string]int, len(ev.Words))
+	for i, word := range ev.Words {
+		ev.WordMap[word] = i
+	}
+}
 
-	newSentences := make([][]string, 0)
-	for _, sent := range ev.Sentences {
-		newSent := make([]string, 0)
-		for _, word := range sent {
-			if ev.FreqMap[word] > threshold {
-				newSent = append(newSent, word)
-			}
-		}
-		if len(newSent) >= ev.NContext+1 {
-			if len(newSent) >= ev.NContext+1 {
-				newSentences = append(newSentences, newSent)
-			}
+// vocabWords returns the words of the sentence that are in the vocabulary,
+// or [UNK] for the others if UseUNK.
+func (ev *CorpusEnv) vocabWords(sent []string) []string {
+	words := make([]string, 0, len(sent))
+	for _, word := range sent {
+		if _, ok := ev.WordMap[word]; ok {
+			words = append(words, word)
+		} else if ev.UseUNK {
+			words = append(words, "[UNK]")
 		}
 	}
-	ev.Sentences = newSentences
+	return words
 }
 
-func (ev *CorpusEnv) CreateNGrams() {
-	ev.NGrams = make(NGramMap, len(ev.Words))
-
-	for _, sentence := range ev.Sentences {
-		size := len(sentence)
-		for idx, _ := range sentence {
-			if idx >= size-(ev.NContext+1) {
-				break
-			}
+// CreateNGrams makes the NGrams from the sentences of the CorpusFile, with
+// the words not in the vocabulary left out, so NGrams jump over uncommon words.
+// It also counts the NSeqTrials and, in Sequence mode, records the SentOffs,
+// and keeps all the counts in NGramCounts.
+func (ev *CorpusEnv) CreateNGrams() error {
+	ev.NGramCounts = make(NGramMap, len(ev.Words))
+	ev.NSeqTrials = 0
+	ev.SentOffs = nil
+	err := ev.readSentences(func(sent []string) {
+		sentence := ev.vocabWords(sent)
+		if ev.Sequence {
+			ev.SentOffs = append(ev.SentOffs, ev.NSeqTrials)
+		}
+		if len(sentence) > 1 {
+			ev.NSeqTrials += len(sentence) - 1
+		}
+		for idx := 0; idx+ev.NContext < len(sentence); idx++ {
 			context := strings.Join(sentence[idx:idx+ev.NContext], " ")
 			successor := sentence[idx+ev.NContext]
-			ev.NGrams.Add(context, successor)
+			ev.NGramCounts.Add(context, successor)
 		}
+	})
+	if ev.Sequence {
+		ev.SentOffs = append(ev.SentOffs, ev.NSeqTrials)
+	}
+	ev.NGrams = make(NGramMap, len(ev.NGramCounts))
+	for context, counts := range ev.NGramCounts {
+		freqmap := make(map[string]float64, len(counts))
+		for successor, n := range counts {
+			freqmap[successor] = n
+		}
+		ev.NGrams[context] = freqmap
 	}
 	ev.NGrams.TopNSuccessors(ev.NSuccessor)
 	ev.NGrams.Normalize()
+	ev.contexts = make([]string, 0, len(ev.NGrams))
+	for context := range ev.NGrams {
+		ev.contexts = append(ev.contexts, context)
+	}
+	sort.Strings(ev.contexts)
+	return err
 }
 
-func (ev *CorpusEnv) LoadFmFile(filename string) error {
-	file, err := os.Open(filename)
+// readSentences calls fun with each sentence of the CorpusFile, up to
+// MaxSentences of them, as tokens if there is a Tokenizer.
+func (ev *CorpusEnv) readSentences(fun func(sent []string)) error {
+	sr, err := OpenSentences(ev.CorpusFile)
 	if err != nil {
-		fmt.Println("Error opening file:", err)
 		return err
 	}
-	defer file.Close()
-
-	byteValue, _ := ioutil.ReadAll(file)
-	var data JsonData
-	if err := json.Unmarshal(byteValue, &data); err != nil {
-		return err
-	}
-	ev.Words = data.Vocab
-	ev.Sentences = data.Sentences
-	ev.SentOffs = make([]int, len(ev.Sentences)+1)
-	ev.SentOffs[0] = 0
-	for i := 1; i <= len(ev.Sentences); i++ {
-		ev.SentOffs[i] = ev.SentOffs[i-1] + len(ev.Sentences[i-1])
+	defer sr.Close()
+	for n := 0; ev.MaxSentences <= 0 || n < ev.MaxSentences; n++ {
+		sent, err := sr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("CorpusEnv %s: %w", ev.CorpusFile, err)
+		}
+		if ev.Tokenizer != nil {
+			sent = ev.Tokenizer.Tokens(sent)
+		}
+		fun(sent)
 	}
+	return nil
+}
 
+// countVocab makes the vocabulary from the words of the corpus, in order of
+// first appearance, with their normalized frequencies.
+func (ev *CorpusEnv) countVocab() error {
+	ev.Words = nil
 	ev.WordMap = make(map[string]int)
 	ev.FreqMap = make(map[string]float64)
-	_, err = os.Stat(ev.VocabFile)
-	if os.IsNotExist(err) {
-		fmt.Println("Building new vocabulary")
-
-		if ev.UseUNK {
-			ev.WordMap["[UNK]"] = 0
-			ev.FreqMap["[UNK]"] = 0
-		}
-		for i, w := range ev.Words {
-			ev.WordMap[w] = len(ev.WordMap)
-			ev.FreqMap[w] = float64(data.Freqs[i])
+	if ev.UseUNK {
+		ev.Words = append(ev.Words, "[UNK]")
+		ev.WordMap["[UNK]"] = 0
+		ev.FreqMap["[UNK]"] = 0
+	}
+	err := ev.readSentences(func(sent []string) {
+		for _, w := range sent {
+			if _, has := ev.WordMap[w]; !has {
+				ev.WordMap[w] = len(ev.Words)
+				ev.Words = append(ev.Words, w)
+			}
+			ev.FreqMap[w]++
 		}
-		ev.NormalizeFreqs()
+	})
+	ev.NormalizeFreqs()
+	return err
+}
 
-		var jobj JsonVocab
-		jobj.Vocab = ev.WordMap
-		jobj.Freqs = ev.FreqMap
-		jenc, _ := json.MarshalIndent(jobj, "", " ")
-		_ = ioutil.WriteFile(ev.VocabFile, jenc, 0644)
+// OpenVocab loads the vocabulary from the given JsonVocab file.
+func (ev *CorpusEnv) OpenVocab(filename string) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var jobj JsonVocab
+	if err := json.Unmarshal(b, &jobj); err != nil {
+		return fmt.Errorf("OpenVocab %s: %w", filename, err)
+	}
+	ev.WordMap = jobj.Vocab
+	ev.FreqMap = jobj.Freqs
+	ev.Words = make([]string, 0, len(ev.WordMap))
+	for w := range ev.WordMap {
+		ev.Words = append(ev.Words, w)
+	}
+	sort.Slice(ev.Words, func(i, j int) bool { return ev.WordMap[ev.Words[i]] < ev.WordMap[ev.Words[j]] })
+	for i, w := range ev.Words { // in case the indexes have gaps
+		ev.WordMap[w] = i
+	}
+	return nil
+}
 
-	} else {
-		fmt.Println("Loading existing vocabulary")
+// SaveVocab saves the vocabulary to the given file, as JsonVocab.
+func (ev *CorpusEnv) SaveVocab(filename string) error {
+	jobj := JsonVocab{Vocab: ev.WordMap, Freqs: ev.FreqMap}
+	jenc, err := json.MarshalIndent(jobj, "", " ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filename, jenc, 0644)
+}
 
-		vocab, err := os.Open(ev.VocabFile)
+// configTokenizer sets the Tokenizer to a BPE if there is a BPEFile, with the
+// merges learned from the corpus if the file does not exist.
+func (ev *CorpusEnv) configTokenizer() error {
+	if ev.Tokenizer != nil || ev.BPEFile == "" {
+		return nil
+	}
+	if _, err := os.Stat(ev.BPEFile); err == nil {
+		fmt.Println("Loading BPE merges from:", ev.BPEFile)
+		bp, err := OpenBPE(ev.BPEFile)
 		if err != nil {
-			fmt.Println("Error opening vocabulary:", err)
 			return err
 		}
-		defer vocab.Close()
-
-		var jobj JsonVocab
-		byteValue, _ := ioutil.ReadAll(vocab)
-		if err := json.Unmarshal(byteValue, &jobj); err != nil {
-			fmt.Println(err)
-			return err
+		ev.Tokenizer = bp
+		return nil
+	}
+	fmt.Println("Learning BPE merges from:", ev.CorpusFile)
+	counts := map[string]int{}
+	err := ev.readSentences(func(sent []string) {
+		for _, w := range sent {
+			counts[w]++
 		}
-		ev.WordMap = jobj.Vocab
-		ev.FreqMap = jobj.Freqs
+	})
+	if err != nil {
+		return err
 	}
-
-	// Limit the vocabulary before creating the NGrams, so that NGrams will jump over uncommon words
-	ev.LimitVocabulary()
-	ev.CreateNGrams()
-	return nil
+	bp, err := TrainBPE(counts, ev.MaxVocab)
+	if err != nil {
+		return err
+	}
+	ev.Tokenizer = bp
+	return bp.Save(ev.BPEFile)
 }
 
-// SentToCorpus makes the Corpus out of the Sentences
-func (ev *CorpusEnv) SentToCorpus() {
-	ev.Corpus = make([]string, 0, len(ev.SentOffs)-1)
-	for si := 0; si < len(ev.Sentences); si++ {
-		for wi := 0; wi < len(ev.Sentences[si]); wi++ {
-			w := ev.LookUpWord(ev.Sentences[si][wi])
-			if w != "" {
-				ev.Corpus = append(ev.Corpus, w)
+// LoadFmFile reads the corpus from the given file into the vocabulary and the
+// NGrams, as a stream, in up to three passes -- one to learn the BPE merges,
+// if they are used and the BPEFile does not exist, one to count the words,
+// unless the VocabFile exists, and one to make the NGrams. The corpus file is
+// kept in CorpusFile. See SentenceReader for the formats of the file.
+func (ev *CorpusEnv) LoadFmFile(filename string) error {
+	ev.CorpusFile = filename
+	if err := ev.configTokenizer(); err != nil {
+		return err
+	}
+	if _, err := os.Stat(ev.VocabFile); ev.VocabFile != "" && err == nil {
+		fmt.Println("Loading existing vocabulary from:", ev.VocabFile)
+		if err := ev.OpenVocab(ev.VocabFile); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println("Building new vocabulary from:", filename)
+		if err := ev.countVocab(); err != nil {
+			return err
+		}
+		if ev.VocabFile != "" {
+			if err := ev.SaveVocab(ev.VocabFile); err != nil {
+				fmt.Println(err)
 			}
 		}
 	}
+
+	// Limit the vocabulary before creating the NGrams, so that NGrams will jump over uncommon words
+	ev.LimitVocabulary()
+	return ev.CreateNGrams()
 }
 
 func (ev *CorpusEnv) ConfigWordReps() {
@@ -345,7 +584,24 @@ func (ev *CorpusEnv) ConfigWordReps() {
 
 	ev.WordReps.SetShape([]int{nwords, ev.InputSize.Y, ev.InputSize.X}, nil, []string{"Y", "X"})
 
-	fname := fmt.Sprintf("word_reps_%dx%d_on%d_mind%d_localist%t.json", ev.InputSize.Y, ev.InputSize.X, nper, mindif, ev.Localist)
+	if !ev.Encoding.IsRandom() {
+		non := ev.Encoding.NOn
+		if non <= 0 {
+			non = nper
+		}
+		if non <= 0 {
+			non = 4
+		}
+		fmt.Printf("ConfigWordReps: %s  nwords: %d  nin: %d  non: %d\n", ev.Encoding.Method, nwords, nin, non)
+		embs, err := ev.Encoding.Embeddings(ev)
+		if err == nil {
+			ev.Encoding.Binarize(&ev.WordReps, ev.Words, embs, non)
+			return
+		}
+		fmt.Println(err, "-- using random word reps instead")
+	}
+
+	fname := fmt.Sprintf("word_reps_%dw_%dx%d_on%d_mind%d_localist%t.json", nwords, ev.InputSize.Y, ev.InputSize.X, nper, mindif, ev.Localist)
 
 	_, err := os.Stat(fname)
 	if os.IsNotExist(err) {
@@ -378,28 +634,6 @@ func (ev *CorpusEnv) ConfigWordReps() {
 	}
 }
 
-// CorpusPosToSentIdx returns the sentence, idx of given corpus position
-func (ev *CorpusEnv) CorpusPosToSentIdx(pos int) []int {
-	idx := make([]int, 2)
-	var i, j, curr int
-	i = 0
-	j = len(ev.SentOffs) - 1
-	for {
-		curr = (i + j) / 2
-		if pos < ev.SentOffs[curr] {
-			j = curr - 1
-		} else {
-			i = curr + 1
-		}
-		if i >= j {
-			idx[0] = curr
-			idx[1] = pos - ev.SentOffs[idx[0]]
-			break
-		}
-	}
-	return idx
-}
-
 // String returns the current state as a string
 func (ev *CorpusEnv) String() string {
 	curr := make([]string, len(ev.CurWords))
@@ -453,7 +687,7 @@ func (ev *CorpusEnv) LookUpWord(word string) string {
 			ans = ""
 		}
 	} else if ev.DropOut {
-		samp := rand.Float64()
+		samp := ev.randFloat64()
 		if ev.FreqMap[word]-samp > epsilon {
 			ans = ""
 		}
@@ -461,57 +695,161 @@ func (ev *CorpusEnv) LookUpWord(word string) string {
 	return ans
 }
 
-func (ev *CorpusEnv) Step() bool {
-	ev.Epoch.Same() // good idea to just reset all non-inner-most counters at start
+// Step advances the trial counter and the walk through the NGrams.
+func (ev *CorpusEnv) Step() {
+	ev.EpochCtr.Same() // good idea to just reset all non-inner-most counters at start
+	if ev.TrialCtr.Incr() {
+		ev.EpochCtr.Incr()
+	}
+	ev.nextWords()
+}
+
+// StartTrial moves on to the words of the next trial, without touching the
+// counters, which the Sim sets itself. LoopTrial calls it.
+func (ev *CorpusEnv) StartTrial() {
+	ev.nextWords()
+}
+
+// nextWords moves the context on to the current successor, or to a random
+// context every NRandomizeWord ticks and when the context has no successors,
+// and picks a random successor of it, by frequency.
+func (ev *CorpusEnv) nextWords() {
 	ev.Block.Same() // good idea to just reset all non-inner-most counters at start
 	if ev.Tick.Incr() {
 		ev.Block.Incr()
 	}
-	if ev.Trial.Incr() {
-		ev.Epoch.Incr()
+	if ev.Sequence {
+		ev.nextSeqWord()
+		return
 	}
-
-	// TODO randomly walk words
-	// if cur words are empty, pick a random one from the ngrams keys
-	// if tick % 100 is 0, pick a random one
-	// if the current words do not appear in ngram map, pick a random one
-	_, ok := ev.NGrams[strings.Join(ev.CurWords, " ")]
-	if len(ev.CurWords) == 0 || ev.Tick.Cur%ev.NRandomizeWord == 0 || !ok {
-		// TODO Optimize this
-		ridx := rand.Intn(len(ev.NGrams))
-		idx := 0
-		for context, _ := range ev.NGrams {
-			if idx == ridx {
-				ev.CurWords = strings.Split(context, " ")
-				break
-			}
-			idx++
-		}
+	if len(ev.contexts) == 0 {
 		ev.CurNextWord = ""
+		ev.RenderWords()
+		return
 	}
 	// cycle the current words
 	if ev.CurNextWord != "" {
 		ev.CurWords = append(ev.CurWords[1:], ev.CurNextWord)
 		ev.CurNextWord = ""
 	}
-	// pick a random successor from the ngram map, using weighted random
-	possiblechoices := ev.NGrams[strings.Join(ev.CurWords, " ")]
-	rando := rand.Float64()
+	successors, ok := ev.NGrams[strings.Join(ev.CurWords, " ")]
+	if !ok || (ev.NRandomizeWord > 0 && ev.Tick.Cur%ev.NRandomizeWord == 0) {
+		context := ev.contexts[ev.randIntn(len(ev.contexts))]
+		ev.CurWords = strings.Split(context, " ")
+		successors = ev.NGrams[context]
+	}
+	// pick a random successor from the ngram map, using weighted random, in
+	// sorted order so it only depends on the random seed
+	words := make([]string, 0, len(successors))
+	for word := range successors {
+		words = append(words, word)
+	}
+	sort.Strings(words)
+	rando := ev.randFloat64()
 	summo := 0.0
-	for word, freq := range possiblechoices {
-		summo += freq
+	for _, word := range words {
+		summo += successors[word]
+		ev.CurNextWord = word
 		if summo >= rando {
-			ev.CurNextWord = word
 			break
 		}
 	}
-	if ev.CurNextWord == "" {
-		// OH NO ERROR! TODO HOW DO WE ERROR??! :( this should never happen
-		return false
-	}
+	ev.TrialNm.Set(strings.Join(ev.CurWords, " "))
+	ev.RenderWords()
+}
 
+// nextSeqWord moves on to the next word of the corpus in Sequence mode.
+func (ev *CorpusEnv) nextSeqWord() {
+	ev.WordIdx++
+	if ev.WordIdx+1 >= len(ev.seqSent) {
+		if err := ev.nextSentence(); err != nil {
+			fmt.Println(err)
+			ev.CurWords = ev.CurWords[:0]
+			ev.CurNextWord = ""
+			ev.RenderWords()
+			return
+		}
+		ev.WordIdx = 0
+	}
+	nctx := ev.NContext
+	if nctx < 1 {
+		nctx = 1
+	}
+	st := ev.WordIdx + 1 - nctx
+	if st < 0 {
+		st = 0
+	}
+	ev.CurWords = append(ev.CurWords[:0], ev.seqSent[st:ev.WordIdx+1]...)
+	ev.CurNextWord = ev.seqSent[ev.WordIdx+1]
+	ev.TrialNm.Set(strings.Join(ev.CurWords, " "))
+	ev.GroupNm.Set(strconv.Itoa(ev.SentIdx))
 	ev.RenderWords()
-	return true
+}
+
+// nextSentence reads the next sentence of the corpus with at least two words
+// in the vocabulary, going back to the start of the corpus, and to the next
+// Block, at the end of it, or after MaxSentences.
+func (ev *CorpusEnv) nextSentence() error {
+	for wraps := 0; ; {
+		if ev.seqReader != nil && ev.MaxSentences > 0 && ev.seqRead >= ev.MaxSentences {
+			ev.seqReader.Close()
+			ev.seqReader = nil
+		}
+		if ev.seqReader == nil {
+			if wraps++; wraps > 2 {
+				return fmt.Errorf("CorpusEnv %s: no sentences of 2 words in the vocabulary in %s", ev.Nm, ev.CorpusFile)
+			}
+			sr, err := OpenSentences(ev.CorpusFile)
+			if err != nil {
+				return err
+			}
+			if ev.SentIdx >= 0 {
+				ev.Block.Incr()
+			}
+			ev.seqReader = sr
+			ev.seqRead = 0
+			ev.SentIdx = -1
+		}
+		sent, err := ev.seqReader.Next()
+		if err == io.EOF {
+			ev.seqReader.Close()
+			ev.seqReader = nil
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("CorpusEnv %s: %w", ev.CorpusFile, err)
+		}
+		ev.seqRead++
+		ev.SentIdx++
+		if ev.Tokenizer != nil {
+			sent = ev.Tokenizer.Tokens(sent)
+		}
+		if words := ev.vocabWords(sent); len(words) > 1 {
+			ev.seqSent = words
+			return nil
+		}
+	}
+}
+
+// SeqStart returns whether the current trial is the first of a sentence, in
+// Sequence mode.
+func (ev *CorpusEnv) SeqStart() bool {
+	return ev.Sequence && ev.WordIdx == 0 && len(ev.seqSent) > 0
+}
+
+// SeqEnd returns whether the current trial is the last of a sentence, in
+// Sequence mode, whose target is the last word.
+func (ev *CorpusEnv) SeqEnd() bool {
+	return ev.Sequence && len(ev.seqSent) > 0 && ev.WordIdx+2 == len(ev.seqSent)
+}
+
+// SeqTrial returns the index of the current trial in a pass through the
+// corpus, in Sequence mode, according to the SentOffs, or -1 if there is none.
+func (ev *CorpusEnv) SeqTrial() int {
+	if !ev.Sequence || len(ev.seqSent) == 0 || ev.SentIdx < 0 || ev.SentIdx >= len(ev.SentOffs) {
+		return -1
+	}
+	return ev.SentOffs[ev.SentIdx] + ev.WordIdx
 }
 
 func (ev *CorpusEnv) Action(element string, input etensor.Tensor) {
@@ -521,14 +859,18 @@ func (ev *CorpusEnv) Action(element string, input etensor.Tensor) {
 func (ev *CorpusEnv) Counter(scale env.TimeScales) (cur, prv int, chg bool) {
 	switch scale {
 	case env.Run:
-		return ev.Run.Query()
+		return ev.RunCtr.Query()
 	case env.Epoch:
-		return ev.Epoch.Query()
+		return ev.EpochCtr.Query()
 	case env.Trial:
-		return ev.Trial.Query()
+		return ev.TrialCtr.Query()
 	}
 	return -1, -1, false
 }
 
-// Compile-time check that implements Env interface
-var _ env.Env = (*CorpusEnv)(nil)
+// Compile-time check that implements Environment and SequenceEnv interfaces
+var _ Environment = (*CorpusEnv)(nil)
+var _ SequenceEnv = (*CorpusEnv)(nil)
+var _ TrialStarter = (*CorpusEnv)(nil)
+var _ CheckpointEnv = (*CorpusEnv)(nil)
+var _ RandEnv = (*CorpusEnv)(nil)
@@ -0,0 +1,142 @@
+package sim_test
+
+import (
+	"compress/gzip"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/evec"
+)
+
+func TestCorpusEnv(t *testing.T) {
+	inTempDir(t)
+
+	text := "The cat sat on the mat.\nThe dog sat on the log!\n\nA cat saw the dog.\n"
+	f, _ := os.Create("corpus.txt.gz")
+	gz := gzip.NewWriter(f)
+	gz.Write([]byte(text))
+	gz.Close()
+	f.Close()
+	jtext := `{"Vocab": ["ignored"], "Sentences": [["the", "cat", "sat", "on", "the", "mat"], ["the", "dog", "sat", "on", "the", "log"], ["a", "cat", "saw", "the", "dog"]]}`
+	os.WriteFile("corpus.json", []byte(jtext), 0644)
+
+	var nctx int
+	for i, fnm := range []string{"corpus.txt.gz", "corpus.json"} {
+		ev := sim.CorpusEnv{VocabFile: fnm + ".vocab"}
+		ev.Config(fnm, evec.Vec2i{5, 5}, false, 1, 3, 10)
+		if err := ev.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if len(ev.Words) != 9 || ev.Words[ev.WordMap["the"]] != "the" {
+			t.Errorf("%s: wrong vocabulary %v", fnm, ev.Words)
+		}
+		if _, has := ev.NGrams["on"]["the"]; !has || len(ev.NGrams["sat"]) != 1 {
+			t.Errorf("%s: wrong ngrams %v", fnm, ev.NGrams)
+		}
+		if _, err := os.Stat(ev.VocabFile); err != nil {
+			t.Errorf("%s: vocabulary not saved: %v", fnm, err)
+		}
+		if i == 0 {
+			nctx = len(ev.NGrams)
+		} else if len(ev.NGrams) != nctx {
+			t.Errorf("%s: %d ngram contexts, not %d as from text", fnm, len(ev.NGrams), nctx)
+		}
+
+		ev.Init(0)
+		ev.StartTrial()
+		first := ev.CurTrialName()
+		if _, has := ev.NGrams[first][ev.CurNextWord]; !has {
+			t.Errorf("%s: %q does not follow %q", fnm, ev.CurNextWord, first)
+		}
+		if ev.State("Output"); ev.CurTrialName() != first {
+			t.Errorf("%s: the words changed within the trial", fnm)
+		}
+		tick := ev.Tick.Cur
+		if ev.StartTrial(); ev.Tick.Cur != tick+1 {
+			t.Errorf("%s: the words did not move on with StartTrial", fnm)
+		}
+	}
+
+	// a smaller vocabulary from the saved file, with the indexes renumbered
+	ev := sim.CorpusEnv{VocabFile: "corpus.json.vocab", MaxVocab: 4}
+	ev.Config("corpus.txt.gz", evec.Vec2i{5, 5}, false, 1, 3, 10)
+	if len(ev.Words) != 4 || ev.WordMap["the"] >= 4 {
+		t.Errorf("wrong limited vocabulary %v %v", ev.Words, ev.WordMap)
+	}
+	for ctx, succ := range ev.NGrams {
+		for w := range succ {
+			if _, has := ev.WordMap[w]; !has {
+				t.Errorf("ngram %s %s is not in the vocabulary", ctx, w)
+			}
+		}
+	}
+}
+
+func TestSequence(t *testing.T) {
+	inTempDir(t)
+	os.WriteFile("corpus.txt", []byte("the cat sat\nhi\nthe dog ran away\n"), 0644)
+
+	ev := sim.CorpusEnv{Sequence: true}
+	ev.Config("corpus.txt", evec.Vec2i{5, 5}, false, 2, 3, 10)
+	if err := ev.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if ev.NSeqTrials != 5 {
+		t.Errorf("%d trials in the corpus, not 5", ev.NSeqTrials)
+	}
+	if offs := []int{0, 2, 2, 5}; !reflect.DeepEqual(ev.SentOffs, offs) {
+		t.Errorf("sentence offsets %v, not %v", ev.SentOffs, offs)
+	}
+	ev.Init(0)
+	want := []struct {
+		words, next, group string
+		start, end         bool
+	}{
+		{"the", "cat", "0", true, false},
+		{"the cat", "sat", "0", false, true},
+		{"the", "dog", "2", true, false}, // the sentence of 1 word is skipped
+		{"the dog", "ran", "2", false, false},
+		{"dog ran", "away", "2", false, true},
+		{"the", "cat", "0", true, false}, // back to the start of the corpus
+	}
+	var state []byte
+	for i, w := range want {
+		ev.StartTrial()
+		if ev.CurTrialName() != w.words || ev.CurNextWord != w.next || ev.GroupName().Cur != w.group || ev.SeqStart() != w.start || ev.SeqEnd() != w.end {
+			t.Errorf("trial %d: %q -> %q in %s, start %v, end %v, not %+v", i, ev.CurTrialName(), ev.CurNextWord, ev.GroupName().Cur, ev.SeqStart(), ev.SeqEnd(), w)
+		}
+		if ev.SeqTrial() != i%ev.NSeqTrials {
+			t.Errorf("trial %d is trial %d of the corpus", i, ev.SeqTrial())
+		}
+		if i == 2 {
+			var err error
+			if state, err = ev.SaveState(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	// a copy of the env resumes from the state saved in the middle of the
+	// last sentence, and goes on to the start of the corpus like ev
+	rv := sim.CorpusEnv{Sequence: true}
+	rv.Config("corpus.txt", evec.Vec2i{5, 5}, false, 2, 3, 10)
+	rv.Init(0)
+	if err := rv.LoadState(state); err != nil {
+		t.Fatal(err)
+	}
+	for i := 3; i < len(want); i++ {
+		rv.StartTrial()
+		if w := want[i]; rv.CurTrialName() != w.words || rv.CurNextWord != w.next || rv.GroupName().Cur != w.group {
+			t.Errorf("trial %d after resuming: %q -> %q in %s, not %+v", i, rv.CurTrialName(), rv.CurNextWord, rv.GroupName().Cur, w)
+		}
+	}
+	if ev.Block.Cur != 1 {
+		t.Errorf("block %d after a pass through the corpus, not 1", ev.Block.Cur)
+	}
+	ev.Init(1)
+	if ev.StartTrial(); ev.CurTrialName() != "the" || !ev.SeqStart() {
+		t.Errorf("Init did not go back to the start of the corpus")
+	}
+}
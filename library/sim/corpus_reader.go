@@ -0,0 +1,130 @@
+package sim
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// SentenceReader reads the sentences of a corpus file one at a time, so that
+// corpora larger than memory can be used. The file is plain text, with one
+// sentence per line, or JSON, with a Sentences list of lists of words, as in
+// {"Sentences": [["the", "cat"], ...]} -- any other fields are skipped. Either
+// one can be gzipped, with a .gz extension after the .txt or .json one.
+// The words of plain text are lower cased, without leading and trailing
+// punctuation.
+type SentenceReader struct {
+	f    *os.File
+	gz   *gzip.Reader
+	scan *bufio.Scanner // plain text
+	dec  *json.Decoder  // JSON
+}
+
+// OpenSentences opens a corpus file for reading its sentences.
+func OpenSentences(fnm string) (*SentenceReader, error) {
+	f, err := os.Open(fnm)
+	if err != nil {
+		return nil, err
+	}
+	sr := &SentenceReader{f: f}
+	var r io.Reader = bufio.NewReader(f)
+	base := fnm
+	if filepath.Ext(fnm) == ".gz" {
+		if sr.gz, err = gzip.NewReader(r); err != nil {
+			f.Close()
+			return nil, fmt.Errorf("OpenSentences %s: %w", fnm, err)
+		}
+		r = sr.gz
+		base = strings.TrimSuffix(fnm, ".gz")
+	}
+	if filepath.Ext(base) != ".json" {
+		sr.scan = bufio.NewScanner(r)
+		sr.scan.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		return sr, nil
+	}
+	sr.dec = json.NewDecoder(r)
+	if err := sr.startJSON(); err != nil {
+		sr.Close()
+		return nil, fmt.Errorf("OpenSentences %s: %w", fnm, err)
+	}
+	return sr, nil
+}
+
+// startJSON skips to the start of the Sentences list.
+func (sr *SentenceReader) startJSON() error {
+	if tok, err := sr.dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("not a JSON object")
+	}
+	for sr.dec.More() {
+		tok, err := sr.dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == "Sentences" {
+			if tok, err = sr.dec.Token(); err != nil {
+				return err
+			} else if tok != json.Delim('[') {
+				return fmt.Errorf("Sentences is not a list")
+			}
+			return nil
+		}
+		var skip json.RawMessage
+		if err := sr.dec.Decode(&skip); err != nil {
+			return err
+		}
+	}
+	return fmt.Errorf("no Sentences")
+}
+
+// Next returns the words of the next sentence, and io.EOF after the last one.
+// Empty lines of plain text are skipped.
+func (sr *SentenceReader) Next() ([]string, error) {
+	if sr.dec != nil {
+		if !sr.dec.More() {
+			return nil, io.EOF
+		}
+		var sent []string
+		if err := sr.dec.Decode(&sent); err != nil {
+			return nil, err
+		}
+		return sent, nil
+	}
+	for sr.scan.Scan() {
+		if sent := TextWords(sr.scan.Text()); len(sent) > 0 {
+			return sent, nil
+		}
+	}
+	if err := sr.scan.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// Close closes the file.
+func (sr *SentenceReader) Close() error {
+	if sr.gz != nil {
+		sr.gz.Close()
+	}
+	return sr.f.Close()
+}
+
+// TextWords splits a line of text into lower cased words, without leading
+// and trailing punctuation.
+func TextWords(line string) []string {
+	var words []string
+	for _, w := range strings.Fields(strings.ToLower(line)) {
+		w = strings.TrimFunc(w, func(r rune) bool { return !unicode.IsLetter(r) && !unicode.IsDigit(r) })
+		if w != "" {
+			words = append(words, w)
+		}
+	}
+	return words
+}
@@ -0,0 +1,265 @@
+package sim
+
+import (
+	"compress/gzip"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/emer/emergent/elog"
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etensor"
+)
+
+// CycleSample selects the trials whose within-trial dynamics are recorded
+// with the -rasters and -cyclelog flags.
+type CycleSample struct {
+	Mode   etime.Modes `desc:"mode of the trials to record, Train or Test, or AllModes for both"`
+	Every  int         `desc:"record every this many training epochs, starting with the first -- tests are in the training epoch they are done in"`
+	Trials int         `desc:"number of trials to record at the start of each recorded epoch, all of them if 0"`
+}
+
+// ParseCycleSample parses a sample given as a mode (Train, Test, or all),
+// optionally followed by a colon and comma-separated Field=Value settings,
+// e.g., "Test:Every=10,Trials=5".
+func ParseCycleSample(spec string) (CycleSample, error) {
+	cs := CycleSample{Mode: etime.AllModes, Every: 1}
+	ps := strings.SplitN(spec, ":", 2)
+	if mode := strings.TrimSpace(ps[0]); mode != "all" {
+		if err := cs.Mode.FromString(mode); err != nil || (cs.Mode != etime.Train && cs.Mode != etime.Test) {
+			return cs, fmt.Errorf("ParseCycleSample: mode %q is not Train, Test, or all", mode)
+		}
+	}
+	if len(ps) == 1 {
+		return cs, nil
+	}
+	if err := parseSpec(ps[1], &cs); err != nil {
+		return cs, fmt.Errorf("ParseCycleSample: %v", err)
+	}
+	if cs.Every < 1 {
+		return cs, fmt.Errorf("ParseCycleSample: Every must be at least 1")
+	}
+	return cs, nil
+}
+
+// Has returns whether the trial of given mode, epoch and trial is in the sample.
+func (cs *CycleSample) Has(mode etime.Modes, epc, trl int) bool {
+	if cs.Mode != etime.AllModes && cs.Mode != mode {
+		return false
+	}
+	return epc%cs.Every == 0 && (cs.Trials <= 0 || trl < cs.Trials)
+}
+
+// TrialRecord is the within-trial dynamics of one trial, as recorded in the
+// files written with -rasters and -cyclelog.
+type TrialRecord struct {
+	Mode      string
+	Run       int
+	Epoch     int `desc:"training epoch, also for the trials of tests"`
+	Trial     int
+	TrialName string
+	Tensors   map[string]RecTensor `desc:"for rasters, the spikes of each layer, by [Nrn, Cyc], and for the cycle log, each column, by [Cyc, cell shape...]"`
+}
+
+// RecTensor is a tensor as it is saved in a TrialRecord.
+type RecTensor struct {
+	Shape  []int
+	Names  []string
+	Values []float32
+}
+
+// Tensor returns the tensor of given name, or nil if there is none.
+func (tr *TrialRecord) Tensor(name string) *etensor.Float32 {
+	rt, has := tr.Tensors[name]
+	if !has {
+		return nil
+	}
+	return etensor.NewFloat32Shape(etensor.NewShape(rt.Shape, nil, rt.Names), rt.Values)
+}
+
+// CycleRecorder writes the TrialRecords of a sample of trials to a gzipped
+// file of gob encoded records, which can be read with OpenTrialRecords.
+type CycleRecorder struct {
+	Sample CycleSample `desc:"trials to record"`
+	File   string      `desc:"file name"`
+
+	f   *os.File
+	gz  *gzip.Writer
+	enc *gob.Encoder
+}
+
+// NewCycleRecorder makes a recorder of given sample to file fnm.
+func NewCycleRecorder(fnm string, sample CycleSample) (*CycleRecorder, error) {
+	f, err := os.Create(fnm)
+	if err != nil {
+		return nil, fmt.Errorf("NewCycleRecorder: %w", err)
+	}
+	cr := &CycleRecorder{Sample: sample, File: fnm, f: f}
+	cr.gz = gzip.NewWriter(f)
+	cr.enc = gob.NewEncoder(cr.gz)
+	return cr, nil
+}
+
+// Write adds a record to the file.
+func (cr *CycleRecorder) Write(tr *TrialRecord) error {
+	return cr.enc.Encode(tr)
+}
+
+// Close finishes the file.
+func (cr *CycleRecorder) Close() error {
+	err := cr.gz.Close()
+	if cerr := cr.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// TrialRecordReader reads the records of a file written by a CycleRecorder, in order.
+type TrialRecordReader struct {
+	f   *os.File
+	gz  *gzip.Reader
+	dec *gob.Decoder
+}
+
+// OpenTrialRecords opens a file written with -rasters or -cyclelog for reading.
+func OpenTrialRecords(fnm string) (*TrialRecordReader, error) {
+	f, err := os.Open(fnm)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("OpenTrialRecords %s: %w", fnm, err)
+	}
+	return &TrialRecordReader{f: f, gz: gz, dec: gob.NewDecoder(gz)}, nil
+}
+
+// Next returns the next record, and io.EOF after the last one.
+func (rr *TrialRecordReader) Next() (*TrialRecord, error) {
+	tr := &TrialRecord{}
+	if err := rr.dec.Decode(tr); err != nil {
+		return nil, err
+	}
+	return tr, nil
+}
+
+// Close closes the file.
+func (rr *TrialRecordReader) Close() error {
+	rr.gz.Close()
+	return rr.f.Close()
+}
+
+// ReadTrialRecord returns the record of given mode, run, epoch and trial from
+// a file written with -rasters or -cyclelog, e.g., to get the spike raster of
+// a layer with rec.Tensor(layerName).
+func ReadTrialRecord(fnm string, mode etime.Modes, run, epc, trl int) (*TrialRecord, error) {
+	rr, err := OpenTrialRecords(fnm)
+	if err != nil {
+		return nil, err
+	}
+	defer rr.Close()
+	for {
+		tr, err := rr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("ReadTrialRecord: %s has no record of %s run %d, epoch %d, trial %d", fnm, mode, run, epc, trl)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("ReadTrialRecord %s: %w", fnm, err)
+		}
+		if tr.Mode == mode.String() && tr.Run == run && tr.Epoch == epc && tr.Trial == trl {
+			return tr, nil
+		}
+	}
+}
+
+// ConfigCycleRecorders opens the files for the -rasters and -cyclelog flags.
+func (ss *Sim) ConfigCycleRecorders() {
+	open := func(spec, lognm string) *CycleRecorder {
+		if spec == "" {
+			return nil
+		}
+		cs, err := ParseCycleSample(spec)
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		if elog.LogDir != "" {
+			os.MkdirAll(elog.LogDir, 0755)
+		}
+		fnm := filepath.Join(elog.LogDir, strings.TrimSuffix(ss.LogFileName(lognm), ".tsv")+".gob.gz")
+		cr, err := NewCycleRecorder(fnm, cs)
+		if err != nil {
+			fmt.Println(err)
+			return nil
+		}
+		fmt.Printf("Saving %s to: %s\n", lognm, fnm)
+		return cr
+	}
+	ss.RasterRecs = open(ss.CmdArgs.rasters, "rasters")
+	ss.CycleLogRecs = open(ss.CmdArgs.cycleLog, "cyclelog")
+}
+
+// recording returns whether cr records the current trial.
+func (ss *Sim) recording(cr *CycleRecorder) bool {
+	if cr == nil {
+		return false
+	}
+	// the test env counts its own epochs from 0 in every test
+	return cr.Sample.Has(ss.Trainer.EvalMode, ss.TrainEnv.Epoch().Cur, ss.CurrentEnvironment().Trial().Cur)
+}
+
+// newTrialRecord returns an empty record for the current trial.
+func (ss *Sim) newTrialRecord() *TrialRecord {
+	env := ss.CurrentEnvironment()
+	return &TrialRecord{Mode: ss.Trainer.EvalMode.String(), Run: ss.Run.Cur, Epoch: ss.TrainEnv.Epoch().Cur,
+		Trial: env.Trial().Cur, TrialName: env.TrialName().Cur, Tensors: map[string]RecTensor{}}
+}
+
+// RecordTrialDynamics writes the spike rasters and the cycle log of the trial
+// that just ended, if it is in the sample of the -rasters and -cyclelog flags.
+func (ss *Sim) RecordTrialDynamics() {
+	if ss.recording(ss.RasterRecs) {
+		tr := ss.newTrialRecord()
+		for _, lnm := range ss.Stats.Rasters {
+			sr := ss.Stats.F32Tensor("Raster_" + lnm)
+			tr.Tensors[lnm] = RecTensor{Shape: sr.Shapes(), Names: sr.DimNames(), Values: append([]float32(nil), sr.Values...)}
+		}
+		if err := ss.RasterRecs.Write(tr); err != nil {
+			fmt.Println(err)
+		}
+	}
+	if ss.recording(ss.CycleLogRecs) {
+		tr := ss.newTrialRecord()
+		dt := ss.Logs.Table(ss.Trainer.EvalMode, etime.Cycle)
+		for ci, col := range dt.Cols {
+			if col.DataType() == etensor.STRING {
+				continue
+			}
+			vals := make([]float32, col.Len())
+			for i := range vals {
+				vals[i] = float32(col.FloatVal1D(i))
+			}
+			tr.Tensors[dt.ColNames[ci]] = RecTensor{Shape: col.Shapes(), Names: col.DimNames(), Values: vals}
+		}
+		if err := ss.CycleLogRecs.Write(tr); err != nil {
+			fmt.Println(err)
+		}
+	}
+}
+
+// closeCycleRecorders closes the files of the -rasters and -cyclelog flags.
+func (ss *Sim) closeCycleRecorders() {
+	for _, cr := range []*CycleRecorder{ss.RasterRecs, ss.CycleLogRecs} {
+		if cr == nil {
+			continue
+		}
+		if err := cr.Close(); err != nil {
+			fmt.Println(err)
+		}
+	}
+	ss.RasterRecs, ss.CycleLogRecs = nil, nil
+}
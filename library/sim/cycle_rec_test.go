@@ -0,0 +1,100 @@
+package sim_test
+
+import (
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/etime"
+)
+
+func TestCycleRecorders(t *testing.T) {
+	ss := newTestSim()
+	dir := t.TempDir()
+	rfnm := filepath.Join(dir, "rasters.gob.gz")
+	cfnm := filepath.Join(dir, "cyclelog.gob.gz")
+	var err error
+	sample := sim.CycleSample{Mode: etime.Test, Every: 1, Trials: 2}
+	if ss.RasterRecs, err = sim.NewCycleRecorder(rfnm, sample); err != nil {
+		t.Fatal(err)
+	}
+	if ss.CycleLogRecs, err = sim.NewCycleRecorder(cfnm, sample); err != nil {
+		t.Fatal(err)
+	}
+	ss.Step(etime.Train, etime.Trial) // not in the sample
+	ss.TestEpoch()
+	ss.CloseLogFiles()
+
+	rr, err := sim.OpenTrialRecords(rfnm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nrec := 0
+	for ; ; nrec++ {
+		if _, err := rr.Next(); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	rr.Close()
+	if nrec != 2 {
+		t.Errorf("expected 2 raster records, got %d", nrec)
+	}
+
+	rec, err := sim.ReadTrialRecord(rfnm, etime.Test, 0, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, lnm := range ss.Net.LayersByClass("Hidden") {
+		sr := rec.Tensor(lnm)
+		if sr == nil || sr.Dim(0) != ss.Net.LayerByName(lnm).Shape().Len() || sr.Dim(1) != cyclesPerTrial(ss) {
+			t.Fatalf("%s raster is missing or has the wrong shape", lnm)
+		}
+		nspk := 0.0
+		for _, v := range sr.Values {
+			nspk += float64(v)
+		}
+		if nspk == 0 {
+			t.Errorf("%s has no spikes in its raster", lnm)
+		}
+	}
+
+	rec, err = sim.ReadTrialRecord(cfnm, etime.Test, 0, 0, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cyc := rec.Tensor("Cycle")
+	if cyc == nil || cyc.Len() != cyclesPerTrial(ss) || cyc.Values[cyc.Len()-1] != float32(cyclesPerTrial(ss)-1) {
+		t.Fatalf("cycle log record does not have the cycles of one trial")
+	}
+	if act := rec.Tensor("Hidden1 Act.Avg"); act == nil || act.Len() != cyc.Len() {
+		t.Errorf("cycle log record does not have Hidden1 Act.Avg")
+	}
+	if _, err := sim.ReadTrialRecord(cfnm, etime.Train, 0, 0, 0); err == nil {
+		t.Errorf("expected no record of a Train trial")
+	}
+}
+
+func TestCycleSampleTrainEpoch(t *testing.T) {
+	ss := newTestSim()
+	rfnm := filepath.Join(t.TempDir(), "rasters.gob.gz")
+	var err error
+	if ss.RasterRecs, err = sim.NewCycleRecorder(rfnm, sim.CycleSample{Mode: etime.Test, Every: 2, Trials: 1}); err != nil {
+		t.Fatal(err)
+	}
+	// the tests are sampled by the training epoch they are done in
+	ss.TrainEnv.Epoch().Cur = 1
+	ss.TestEpoch()
+	ss.TrainEnv.Epoch().Cur = 2
+	ss.TestEpoch()
+	ss.CloseLogFiles()
+
+	if _, err := sim.ReadTrialRecord(rfnm, etime.Test, 0, 1, 0); err == nil {
+		t.Errorf("expected no record of the test in training epoch 1")
+	}
+	if _, err := sim.ReadTrialRecord(rfnm, etime.Test, 0, 2, 0); err != nil {
+		t.Errorf("expected a record of the test in training epoch 2: %v", err)
+	}
+}
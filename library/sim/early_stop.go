@@ -0,0 +1,233 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/emer/emergent/etime"
+)
+
+// StopRule is one early stopping criterion, checked at the end of every
+// training epoch. Check returns a non-empty reason if the run should stop now.
+// Rules are saved in checkpoints as JSON, so any state they keep across epochs
+// should be in exported fields.
+type StopRule interface {
+	Check(ss *Sim) string
+	Reset()
+}
+
+// EarlyStop holds the early stopping rules for a run, any one of which can end it.
+type EarlyStop struct {
+	Rules  []StopRule `desc:"rules that are checked in order at the end of each training epoch"`
+	Reason string     `inactive:"+" desc:"reason the last run was stopped early, empty if it ran to the end"`
+}
+
+// Add adds rules to the list.
+func (es *EarlyStop) Add(rules ...StopRule) {
+	es.Rules = append(es.Rules, rules...)
+}
+
+// Reset resets the state of all rules at the start of a new run.
+func (es *EarlyStop) Reset() {
+	es.Reason = ""
+	for _, rl := range es.Rules {
+		rl.Reset()
+	}
+}
+
+// Check checks all the rules, returning true and recording the Reason
+// if any one of them says to stop.
+func (es *EarlyStop) Check(ss *Sim) bool {
+	for _, rl := range es.Rules {
+		if reason := rl.Check(ss); reason != "" {
+			es.Reason = reason
+			fmt.Printf("Stopping run %d at epoch %d: %s\n", ss.Run.Cur, ss.TrainEnv.Epoch().Cur, reason)
+			return true
+		}
+	}
+	return false
+}
+
+// CheckpointSaver returns a saver that stores the state of the rules in checkpoints.
+func (es *EarlyStop) CheckpointSaver() CheckpointSaver {
+	return CheckpointSaver{
+		Name: "EarlyStop",
+		Save: func() ([]byte, error) { return json.Marshal(es.Rules) },
+		Load: func(b []byte) error {
+			var rls []json.RawMessage
+			if err := json.Unmarshal(b, &rls); err != nil {
+				return err
+			}
+			if len(rls) != len(es.Rules) {
+				return fmt.Errorf("checkpoint has %d early stopping rules, sim has %d", len(rls), len(es.Rules))
+			}
+			for i, rl := range es.Rules {
+				if err := json.Unmarshal(rls[i], rl); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// StatVal returns the current value of the named stat for early stopping:
+// from Stats if it is there, otherwise from the last row of the train epoch log.
+func (ss *Sim) StatVal(name string) float64 {
+	if val, has := ss.Stats.Floats[name]; has {
+		return val
+	}
+	if val, has := ss.Stats.Ints[name]; has {
+		return float64(val)
+	}
+	dt := ss.Logs.Table(etime.Train, etime.Epoch)
+	return dt.CellFloat(name, dt.Rows-1)
+}
+
+// StopThresh stops when Stat crosses Thresh.
+type StopThresh struct {
+	Stat   string  `desc:"name of the stat, see StatVal"`
+	Thresh float64 `desc:"threshold value"`
+	Above  bool    `desc:"stop when Stat is >= Thresh -- otherwise when it is <= Thresh"`
+}
+
+func (sr *StopThresh) Reset() {}
+
+func (sr *StopThresh) Check(ss *Sim) string {
+	val := ss.StatVal(sr.Stat)
+	if (sr.Above && val >= sr.Thresh) || (!sr.Above && val <= sr.Thresh) {
+		return fmt.Sprintf("%s reached %g", sr.Stat, sr.Thresh)
+	}
+	return ""
+}
+
+// StopPatience stops when Stat has not improved for Patience epochs.
+type StopPatience struct {
+	Stat     string  `desc:"name of the stat, see StatVal"`
+	Patience int     `desc:"number of epochs without improvement after which to stop -- at least 1"`
+	MinDelta float64 `desc:"minimum change in Stat that counts as an improvement"`
+	Maximize bool    `desc:"higher values of Stat are better -- otherwise lower is better"`
+
+	Best float64 `inactive:"+" desc:"best value of Stat so far"`
+	Wait int     `inactive:"+" desc:"number of epochs since Best last improved"`
+}
+
+func (sr *StopPatience) Reset() {
+	sr.Best = math.MaxFloat64
+	if sr.Maximize {
+		sr.Best = -math.MaxFloat64
+	}
+	sr.Wait = 0
+}
+
+func (sr *StopPatience) Check(ss *Sim) string {
+	val := ss.StatVal(sr.Stat)
+	if (sr.Maximize && val > sr.Best+sr.MinDelta) || (!sr.Maximize && val < sr.Best-sr.MinDelta) {
+		sr.Best = val
+		sr.Wait = 0
+		return ""
+	}
+	sr.Wait++
+	if sr.Wait >= sr.Patience {
+		return fmt.Sprintf("%s did not improve for %d epochs", sr.Stat, sr.Patience)
+	}
+	return ""
+}
+
+// StopDiverge stops when Stat becomes NaN or infinite, or goes above Max.
+type StopDiverge struct {
+	Stat string  `desc:"name of the stat, see StatVal"`
+	Max  float64 `desc:"if > 0, stop when Stat is above this value"`
+}
+
+func (sr *StopDiverge) Reset() {}
+
+func (sr *StopDiverge) Check(ss *Sim) string {
+	val := ss.StatVal(sr.Stat)
+	if math.IsNaN(val) || math.IsInf(val, 0) {
+		return fmt.Sprintf("%s is %g", sr.Stat, val)
+	}
+	if sr.Max > 0 && val > sr.Max {
+		return fmt.Sprintf("%s diverged above %g", sr.Stat, sr.Max)
+	}
+	return ""
+}
+
+// StopWallClock stops when the run has taken more than Minutes of wall-clock time.
+// The clock restarts when a run is resumed from a checkpoint.
+type StopWallClock struct {
+	Minutes float64 `desc:"time budget for each run, in minutes"`
+
+	start time.Time
+}
+
+func (sr *StopWallClock) Reset() {
+	sr.start = time.Now()
+}
+
+func (sr *StopWallClock) Check(ss *Sim) string {
+	if sr.start.IsZero() {
+		sr.start = time.Now()
+	}
+	if time.Since(sr.start).Minutes() > sr.Minutes {
+		return fmt.Sprintf("wall-clock budget of %g minutes used", sr.Minutes)
+	}
+	return ""
+}
+
+// StopFunc wraps a custom stopping function, which is called with no arguments.
+type StopFunc struct {
+	Reason string      `desc:"reason recorded when Func returns true"`
+	Func   func() bool `json:"-" view:"-" desc:"returns true to stop"`
+}
+
+func (sr *StopFunc) Reset() {}
+
+func (sr *StopFunc) Check(ss *Sim) string {
+	if sr.Func() {
+		return sr.Reason
+	}
+	return ""
+}
+
+// ParseStopRules makes rules from a semicolon-separated list, where each rule is
+// its kind (thresh, patience, diverge, or time) followed by a colon and
+// comma-separated Field=Value settings, e.g.,
+// "patience:Stat=PctErr,Patience=20;diverge:Stat=UnitErr;time:Minutes=90"
+func ParseStopRules(spec string) ([]StopRule, error) {
+	var rules []StopRule
+	for _, rs := range strings.Split(spec, ";") {
+		rs = strings.TrimSpace(rs)
+		if rs == "" {
+			continue
+		}
+		ps := strings.SplitN(rs, ":", 2)
+		var rl StopRule
+		switch strings.TrimSpace(ps[0]) {
+		case "thresh":
+			rl = &StopThresh{}
+		case "patience":
+			rl = &StopPatience{}
+		case "diverge":
+			rl = &StopDiverge{}
+		case "time":
+			rl = &StopWallClock{}
+		default:
+			return nil, fmt.Errorf("ParseStopRules: unknown rule: %q", ps[0])
+		}
+		if len(ps) == 2 {
+			if err := parseSpec(ps[1], rl); err != nil {
+				return nil, fmt.Errorf("ParseStopRules: %v", err)
+			}
+		}
+		if sp, ok := rl.(*StopPatience); ok && sp.Patience < 1 {
+			return nil, fmt.Errorf("ParseStopRules: Patience of %q must be at least 1", rs)
+		}
+		rl.Reset()
+		rules = append(rules, rl)
+	}
+	return rules, nil
+}
@@ -0,0 +1,35 @@
+package sim_test
+
+import (
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/etime"
+)
+
+func TestEarlyStopTrainOnly(t *testing.T) {
+	ss := newTestSim()
+	rules, err := sim.ParseStopRules("thresh:Stat=UnitErr,Thresh=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ss.EarlyStop.Add(rules...)
+	// testing is done in a run of its own, which the rules do not stop
+	ss.TestAll()
+	if ss.EarlyStop.Reason != "" {
+		t.Errorf("testing was stopped early: %s", ss.EarlyStop.Reason)
+	}
+	ss.Train(etime.Run)
+	if ss.EarlyStop.Reason == "" || ss.Logs.Table(etime.Train, etime.Epoch).Rows != 1 {
+		t.Errorf("expected the training run to be stopped after 1 epoch")
+	}
+
+	if _, err := sim.ParseStopRules("thresh:Stat=UnitErr;never"); err == nil {
+		t.Errorf("expected an error for an unknown rule")
+	}
+	for _, bad := range []string{"patience:Stat=PctErr", "patience:Stat=PctErr,Patience=0"} {
+		if _, err := sim.ParseStopRules(bad); err == nil {
+			t.Errorf("expected an error for a Patience below 1 in %q", bad)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package sim
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/emer/emergent/etime"
+)
+
+// Expectation is an acceptance criterion for a model, that a stat in the Train
+// Run log must meet at the end of every run, e.g., FirstZero <= 40.
+type Expectation struct {
+	Stat string  `desc:"name of the column of the Train Run log"`
+	Op   string  `desc:"comparison: <, <=, >, >=, ==, or !="`
+	Val  float64 `desc:"value to compare the stat to"`
+}
+
+// expectOps are the comparisons, longer ones first so they are found first.
+var expectOps = []string{"<=", ">=", "==", "!=", "<", ">"}
+
+func (ex *Expectation) String() string {
+	return fmt.Sprintf("%s %s %g", ex.Stat, ex.Op, ex.Val)
+}
+
+// Met returns whether given value of the stat meets the expectation.
+// FirstZero and LastZero are -1 if they were never reached, which never does.
+func (ex *Expectation) Met(val float64) bool {
+	if val < 0 && (ex.Stat == "FirstZero" || ex.Stat == "LastZero") {
+		return false
+	}
+	switch ex.Op {
+	case "<":
+		return val < ex.Val
+	case "<=":
+		return val <= ex.Val
+	case ">":
+		return val > ex.Val
+	case ">=":
+		return val >= ex.Val
+	case "==":
+		return val == ex.Val
+	case "!=":
+		return val != ex.Val
+	}
+	return false
+}
+
+// ParseExpectations makes expectations from a semicolon-separated list, each
+// one a stat, a comparison and a value, e.g., "FirstZero <= 40; PctCor >= 0.95"
+func ParseExpectations(spec string) ([]Expectation, error) {
+	var exps []Expectation
+	for _, es := range strings.Split(spec, ";") {
+		es = strings.TrimSpace(es)
+		if es == "" {
+			continue
+		}
+		var ex Expectation
+		for _, op := range expectOps {
+			if i := strings.Index(es, op); i > 0 {
+				ex.Stat = strings.TrimSpace(es[:i])
+				ex.Op = op
+				val, err := strconv.ParseFloat(strings.TrimSpace(es[i+len(op):]), 64)
+				if err != nil {
+					return nil, fmt.Errorf("ParseExpectations: %q does not have a number to compare to", es)
+				}
+				ex.Val = val
+				break
+			}
+		}
+		if ex.Op == "" || ex.Stat == "" {
+			return nil, fmt.Errorf("ParseExpectations: %q is not of the form Stat <= Value", es)
+		}
+		exps = append(exps, ex)
+	}
+	return exps, nil
+}
+
+// CheckExpectations checks the expectations in Expect against every run in the
+// Train Run log, returning a pass / fail report, and an error if any of them
+// were not met, or there were no runs to check.
+func (ss *Sim) CheckExpectations() (string, error) {
+	exps, err := ParseExpectations(ss.Expect)
+	if err != nil {
+		return "", err
+	}
+	dt := ss.Logs.Table(etime.Train, etime.Run)
+	if dt == nil || dt.Rows == 0 {
+		return "", fmt.Errorf("CheckExpectations: there are no runs in the Train Run log")
+	}
+	var b strings.Builder
+	nfail := 0
+	for _, ex := range exps {
+		if dt.ColByName(ex.Stat) == nil {
+			fmt.Fprintf(&b, "FAIL\t%s\tno %s in the Train Run log\n", ex.String(), ex.Stat)
+			nfail++
+			continue
+		}
+		for row := 0; row < dt.Rows; row++ {
+			val := dt.CellFloat(ex.Stat, row)
+			res := "PASS"
+			if !ex.Met(val) {
+				res = "FAIL"
+				nfail++
+			}
+			fmt.Fprintf(&b, "%s\t%s\trun %d: %s = %g\n", res, ex.String(), int(dt.CellFloat("Run", row)), ex.Stat, val)
+		}
+	}
+	if nfail > 0 {
+		return b.String(), fmt.Errorf("%d expectations were not met", nfail)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,42 @@
+package sim_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+)
+
+func TestExpectations(t *testing.T) {
+	if _, err := sim.ParseExpectations("FirstZero 40"); err == nil {
+		t.Errorf("expected an error for an expectation without a comparison")
+	}
+	exps, err := sim.ParseExpectations("FirstZero<=40; PctCor >= 0.95")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(exps) != 2 || exps[0].Op != "<=" || exps[1].Stat != "PctCor" || exps[1].Val != 0.95 {
+		t.Errorf("expectations were not parsed correctly: %v", exps)
+	}
+	if exps[0].Met(-1) {
+		t.Errorf("a FirstZero that was never reached should not meet %v", exps[0])
+	}
+
+	inTempDir(t)
+	ss := newTestSim()
+	ss.CmdArgs.MaxRuns = 1
+	ss.CmdArgs.MaxEpcs = 2
+	ss.Expect = "Run == 0; PctCor >= 0.5"
+	if err := ss.RunFromArgs(); err != nil {
+		t.Errorf("expectations should have been met: %v", err)
+	}
+	ss.Expect = "PctCor >= 0.99"
+	if _, err := ss.CheckExpectations(); err == nil {
+		t.Errorf("the test model should not be fully correct after 2 epochs")
+	}
+	ss.Expect = "PctCor > 1; NoSuchStat < 1"
+	report, err := ss.CheckExpectations()
+	if err == nil || strings.Count(report, "FAIL") != 2 {
+		t.Errorf("expected 2 failed expectations, got error %v and report:\n%s", err, report)
+	}
+}
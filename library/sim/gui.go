@@ -5,12 +5,15 @@ import (
 	"github.com/emer/emergent/etime"
 
 	"github.com/emer/emergent/egui"
+	"github.com/emer/etable/etview"
 	"github.com/goki/gi/gi"
+	"github.com/goki/gi/giv"
 	"github.com/goki/ki/ki"
 	"github.com/goki/mat32"
 )
 
 func GuiRun(TheSim *Sim, window *gi.Window) {
+	TheSim.Manifest = NewManifest(TheSim)
 	TheSim.Init()
 	//window  //:= TheSim.ConfigGui(appname, title, about)
 	window.StartEventLoop()
@@ -186,6 +189,20 @@ func (ss *Sim) ConfigGui(appname, title, about string) *gi.Window {
 			ss.GUI.UpdatePlot(etime.Train, etime.Run)
 		},
 	})
+	ss.GUI.AddToolbarItem(egui.ToolbarItem{Label: "View RSA",
+		Icon:    "file-sheet",
+		Tooltip: "Shows the similarity matrices of the last representational similarity analysis of the hidden layers over the test patterns -- see the -rsa flag",
+		Active:  egui.ActiveStopped,
+		Func: func() {
+			for _, lnm := range ss.RSALayers() {
+				sm := ss.Stats.SimMat("RSA_" + lnm)
+				if sm.Mat == nil {
+					continue
+				}
+				etview.SimMatGridDialog(ss.GUI.ViewPort, sm, giv.DlgOpts{Title: "RSA " + lnm}, nil, nil)
+			}
+		},
+	})
 	////////////////////////////////////////////////
 	ss.GUI.ToolBar.AddSeparator("misc")
 	ss.GUI.AddToolbarItem(egui.ToolbarItem{Label: "DefineSimVariables Seed",
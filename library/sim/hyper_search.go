@@ -0,0 +1,386 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+
+	"github.com/emer/emergent/elog"
+	"github.com/emer/emergent/etime"
+	"github.com/emer/emergent/params"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/gi/gi"
+)
+
+// SearchParam is one dimension of a hyperparameter search space: a parameter
+// in the param sets, identified as for params.Sets.SetString, and the values to
+// try for it, either listed in Vals, or in the range from Min to Max.
+type SearchParam struct {
+	Set   string   `desc:"name of the param set -- Base if empty"`
+	Sheet string   `desc:"name of the sheet in the set, e.g., Network"`
+	Sel   string   `desc:"Sel of the selector in the sheet, e.g., #Output"`
+	Param string   `desc:"path of the parameter, e.g., Layer.Inhib.Layer.Gi"`
+	Vals  []string `desc:"values to try -- if set, Min and Max are not used"`
+	Min   float64  `desc:"lowest value in the range"`
+	Max   float64  `desc:"highest value in the range"`
+	Log   bool     `desc:"values are spaced evenly on a log scale -- Min must be > 0"`
+	Int   bool     `desc:"values are rounded to integers"`
+	Steps int      `desc:"[grid] number of values from Min to Max, inclusive -- 3 if 0"`
+}
+
+// Name returns the name used for the parameter in the results table.
+func (sp *SearchParam) Name() string {
+	return sp.Sel + ":" + sp.Param
+}
+
+// format formats value v in the range.
+func (sp *SearchParam) format(v float64) string {
+	if sp.Int {
+		return strconv.Itoa(int(math.Round(v)))
+	}
+	return strconv.FormatFloat(v, 'g', 6, 64)
+}
+
+// Grid returns the values to try in a grid search.
+func (sp *SearchParam) Grid() []string {
+	if len(sp.Vals) > 0 {
+		return sp.Vals
+	}
+	n := sp.Steps
+	if n <= 0 {
+		n = 3
+	}
+	if n == 1 {
+		return []string{sp.format(sp.Min)}
+	}
+	vals := make([]string, n)
+	for i := range vals {
+		vals[i] = sp.format(sp.at(float64(i) / float64(n-1)))
+	}
+	return vals
+}
+
+// Random returns a random value, using rnd.
+func (sp *SearchParam) Random(rnd *rand.Rand) string {
+	if len(sp.Vals) > 0 {
+		return sp.Vals[rnd.Intn(len(sp.Vals))]
+	}
+	return sp.format(sp.at(rnd.Float64()))
+}
+
+// at returns the value at proportion pct of the way from Min to Max.
+func (sp *SearchParam) at(pct float64) float64 {
+	if sp.Log {
+		return math.Exp(math.Log(sp.Min) + pct*(math.Log(sp.Max)-math.Log(sp.Min)))
+	}
+	return sp.Min + pct*(sp.Max-sp.Min)
+}
+
+// HyperSearch searches for the param values that give the best value of an
+// objective stat, training a new Sim made with Sim.NewSimFunc for each trial
+// in the same process. Strategy is one of:
+//   - grid: every combination of the SearchParam.Grid values
+//   - random: Trials random samples from the space
+//   - halving: successive halving -- Trials random samples are trained for
+//     MinEpochs, then the best 1/Eta of them are trained again for Eta times as
+//     many epochs, and so on until one is left or Epochs is reached.
+//
+// It can be configured from a JSON file with the -search command line flag.
+type HyperSearch struct {
+	Strategy   string        `desc:"search strategy: grid, random, or halving"`
+	Space      []SearchParam `desc:"the parameters to search over"`
+	Objective  string        `desc:"name of the stat to optimize, read with Sim.StatVal at the end of each run, e.g., LastZero"`
+	Maximize   bool          `desc:"higher values of the objective are better -- otherwise lower is better"`
+	NotReached float64       `desc:"objective value used when the stat is -1, meaning it was not reached, as for FirstZero and LastZero -- 2 x epochs if 0"`
+	Trials     int           `def:"20" desc:"[random, halving] number of sampled param combinations"`
+	Runs       int           `def:"1" desc:"number of runs for each trial, over which the objective is averaged"`
+	Epochs     int           `desc:"max number of epochs for each run -- MaxEpcs from the command line if 0"`
+	MinEpochs  int           `def:"10" desc:"[halving] number of epochs in the first round"`
+	Eta        int           `def:"3" desc:"[halving] proportion of trials dropped, and factor by which epochs increase, in each round"`
+	Seed       int64         `desc:"random seed for sampling params, separate from the seeds of the runs"`
+
+	Results *etable.Table `view:"no-inline" desc:"one row for each trial in each round, with the param values and objective"`
+
+	runLogs []*etable.Table // Train Run log of the runs of each row of Results
+}
+
+func (hs *HyperSearch) Defaults() {
+	hs.Strategy = "random"
+	hs.Trials = 20
+	hs.Runs = 1
+	hs.MinEpochs = 10
+	hs.Eta = 3
+}
+
+// OpenJSON loads the search settings from given JSON file, on top of the Defaults.
+func (hs *HyperSearch) OpenJSON(filename string) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	hs.Defaults()
+	return json.Unmarshal(b, hs)
+}
+
+// searchTrial is one combination of param values, in order of Space.
+type searchTrial struct {
+	idx    int
+	vals   []string
+	obj    float64
+	runLog *etable.Table // Train Run log of the runs of its last round
+}
+
+// Run does the search for ss, which must have NewSimFunc, and returns the
+// index in Results of the best trial.
+func (hs *HyperSearch) Run(ss *Sim) (int, error) {
+	if ss.NewSimFunc == nil {
+		return -1, fmt.Errorf("HyperSearch: the sim has no NewSimFunc to make the trial Sims")
+	}
+	if len(hs.Space) == 0 {
+		return -1, fmt.Errorf("HyperSearch: the search space is empty")
+	}
+	for i := range hs.Space {
+		if hs.Space[i].Set == "" {
+			hs.Space[i].Set = "Base"
+		}
+	}
+	epochs := hs.Epochs
+	if epochs <= 0 {
+		epochs = ss.CmdArgs.MaxEpcs
+	}
+	hs.configResults()
+	rnd := rand.New(rand.NewSource(hs.Seed))
+	var trials []*searchTrial
+	switch hs.Strategy {
+	case "grid":
+		trials = hs.gridTrials()
+	case "random", "halving":
+		for i := 0; i < hs.Trials; i++ {
+			tr := &searchTrial{idx: i}
+			for si := range hs.Space {
+				tr.vals = append(tr.vals, hs.Space[si].Random(rnd))
+			}
+			trials = append(trials, tr)
+		}
+	default:
+		return -1, fmt.Errorf("HyperSearch: unknown strategy: %q", hs.Strategy)
+	}
+	if hs.Strategy != "halving" {
+		return hs.runRound(ss, trials, 0, epochs)
+	}
+
+	eta := hs.Eta
+	if eta < 2 {
+		eta = 2
+	}
+	nepc := hs.MinEpochs
+	for rung := 0; ; rung++ {
+		if nepc > epochs || len(trials) == 1 {
+			nepc = epochs
+		}
+		best, err := hs.runRound(ss, trials, rung, nepc)
+		if err != nil || nepc == epochs {
+			return best, err
+		}
+		sort.SliceStable(trials, func(i, j int) bool { return hs.better(trials[i].obj, trials[j].obj) })
+		nkeep := len(trials) / eta
+		if nkeep < 1 {
+			nkeep = 1
+		}
+		trials = trials[:nkeep]
+		nepc *= eta
+	}
+}
+
+// gridTrials returns every combination of the grid values of the Space.
+func (hs *HyperSearch) gridTrials() []*searchTrial {
+	trials := []*searchTrial{{}}
+	for si := range hs.Space {
+		var nxt []*searchTrial
+		for _, tr := range trials {
+			for _, v := range hs.Space[si].Grid() {
+				vals := append(append([]string{}, tr.vals...), v)
+				nxt = append(nxt, &searchTrial{vals: vals})
+			}
+		}
+		trials = nxt
+	}
+	for i, tr := range trials {
+		tr.idx = i
+	}
+	return trials
+}
+
+// better returns true if objective value a is better than b.
+func (hs *HyperSearch) better(a, b float64) bool {
+	if hs.Maximize {
+		return a > b
+	}
+	return a < b
+}
+
+// runRound runs all the trials for given number of epochs, adding their results,
+// and returns the row in Results of the best one.
+func (hs *HyperSearch) runRound(ss *Sim, trials []*searchTrial, rung, epochs int) (int, error) {
+	best := -1
+	for _, tr := range trials {
+		obj, err := hs.runTrial(ss, tr, epochs)
+		if err != nil {
+			return best, err
+		}
+		tr.obj = obj
+		dt := hs.Results
+		row := dt.Rows
+		dt.SetNumRows(row + 1)
+		dt.SetCellFloat("Trial", row, float64(tr.idx))
+		dt.SetCellFloat("Round", row, float64(rung))
+		dt.SetCellFloat("Epochs", row, float64(epochs))
+		for si := range hs.Space {
+			dt.SetCellString(hs.Space[si].Name(), row, tr.vals[si])
+		}
+		dt.SetCellFloat(hs.Objective, row, obj)
+		hs.runLogs = append(hs.runLogs, tr.runLog)
+		fmt.Printf("Search trial %d, round %d, %d epochs: %s = %g\n", tr.idx, rung, epochs, hs.Objective, obj)
+		if best < 0 || hs.better(obj, dt.CellFloat(hs.Objective, best)) {
+			best = row
+		}
+	}
+	return best, nil
+}
+
+// runTrial trains a new Sim with the param values of tr for given number of
+// epochs, and returns the objective averaged over runs.
+func (hs *HyperSearch) runTrial(ss *Sim, tr *searchTrial, epochs int) (float64, error) {
+	sets, err := hs.trialSets(ss.Params.Params, tr.vals)
+	if err != nil {
+		return 0, err
+	}
+	runs := hs.Runs
+	if runs < 1 {
+		runs = 1
+	}
+	args := ss.CmdArgs.subArgs()
+	args.StartRun = 0
+	args.MaxRuns = runs
+	args.MaxEpcs = epochs
+	args.saveEpcLog = false
+	args.saveRunLog = false
+	args.saveTrialLog = false
+	args.arrowLogs = ""
+	args.rasters = ""
+	args.cycleLog = ""
+	args.snapshots = ""
+	args.SaveWts = false
+
+	// NewSimFunc shares the param sets of ss, so they are swapped for those of
+	// the trial while it is made.
+	orig := ss.Params.Params
+	ss.Params.Params = sets
+	ws := ss.NewSimFunc(args)
+	ss.Params.Params = orig
+
+	ws.addStopRules()
+	ws.Init()
+	ws.TrainEnv.Epoch().Max = epochs // in case the params set MaxEpcs after the env was configured
+	ws.Run.Max = runs
+	notReached := hs.NotReached
+	if notReached == 0 {
+		notReached = float64(2 * epochs)
+	}
+	sum := 0.0
+	for run := 0; run < runs; run++ {
+		ws.Step(etime.Train, etime.Run)
+		val := ws.StatVal(hs.Objective)
+		if val == -1 {
+			val = notReached
+		}
+		sum += val
+	}
+	tr.runLog = ws.Logs.Table(etime.Train, etime.Run)
+	return sum / float64(runs), nil
+}
+
+// RunLog returns the Train Run log of the runs of given row of Results.
+func (hs *HyperSearch) RunLog(row int) *etable.Table {
+	if row < 0 || row >= len(hs.runLogs) {
+		return nil
+	}
+	return hs.runLogs[row]
+}
+
+// trialSets returns a copy of sets with the param values of a trial.
+func (hs *HyperSearch) trialSets(sets params.Sets, vals []string) (params.Sets, error) {
+	b, err := json.Marshal(sets)
+	if err != nil {
+		return nil, err
+	}
+	var cp params.Sets
+	if err := json.Unmarshal(b, &cp); err != nil {
+		return nil, err
+	}
+	for si, sp := range hs.Space {
+		if err := cp.SetString(sp.Set, sp.Sheet, sp.Sel, sp.Param, vals[si]); err != nil {
+			return nil, err
+		}
+	}
+	return cp, nil
+}
+
+// configResults makes the Results table.
+func (hs *HyperSearch) configResults() {
+	sch := etable.Schema{
+		{"Trial", etensor.INT64, nil, nil},
+		{"Round", etensor.INT64, nil, nil},
+		{"Epochs", etensor.INT64, nil, nil},
+	}
+	for si := range hs.Space {
+		sch = append(sch, etable.Column{hs.Space[si].Name(), etensor.STRING, nil, nil})
+	}
+	sch = append(sch, etable.Column{hs.Objective, etensor.FLOAT64, nil, nil})
+	hs.Results = etable.New(sch, 0)
+	hs.runLogs = nil
+	hs.Results.SetMetaData("name", "HyperSearch")
+}
+
+// RunSearch does the hyperparameter search in the JSON file given by the
+// -search flag, and saves the results in the log directory. The Train Run log
+// of ss is then that of the runs of the best trial, against which RunFromArgs
+// checks the expectations.
+func (ss *Sim) RunSearch() error {
+	var hs HyperSearch
+	if err := hs.OpenJSON(ss.CmdArgs.searchFile); err != nil {
+		return fmt.Errorf("Unable to open search file: %v", err)
+	}
+	best, err := hs.Run(ss)
+	if err != nil {
+		fmt.Println(err)
+	}
+	if hs.Results == nil || hs.Results.Rows == 0 {
+		return err
+	}
+	if elog.LogDir != "" {
+		os.MkdirAll(elog.LogDir, 0755)
+	}
+	fnm := filepath.Join(elog.LogDir, ss.LogFileName("search"))
+	if err := hs.Results.SaveCSV(gi.FileName(fnm), etable.Tab, etable.Headers); err != nil {
+		fmt.Println(err)
+	}
+	if best >= 0 {
+		fmt.Printf("Best search trial: %d, %s = %g, results in %s\n", int(hs.Results.CellFloat("Trial", best)), hs.Objective, hs.Results.CellFloat(hs.Objective, best), fnm)
+		for si := range hs.Space {
+			fmt.Printf("\t%s = %s\n", hs.Space[si].Name(), hs.Results.CellString(hs.Space[si].Name(), best))
+		}
+		dt := ss.Logs.Table(etime.Train, etime.Run)
+		dt.SetNumRows(0)
+		dt.AppendRows(hs.RunLog(best))
+		ss.Logs.TableDetails(etime.Train, etime.Run).ResetIdxViews()
+	}
+	return err
+}
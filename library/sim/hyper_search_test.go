@@ -0,0 +1,33 @@
+package sim_test
+
+import (
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+)
+
+func TestHyperSearchGrid(t *testing.T) {
+	ss := newTestSim()
+	hs := sim.HyperSearch{}
+	hs.Defaults()
+	hs.Strategy = "grid"
+	hs.Objective = "UnitErr"
+	hs.Epochs = 2
+	hs.Space = []sim.SearchParam{{Sheet: "Network", Sel: "#Output", Param: "Layer.Inhib.Layer.Gi", Vals: []string{"0.8", "1.0"}}}
+	best, err := hs.Run(ss)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hs.Results.Rows != 2 {
+		t.Fatalf("expected 2 search results, got %d", hs.Results.Rows)
+	}
+	if best < 0 || best >= hs.Results.Rows {
+		t.Fatalf("best search result %d is out of range", best)
+	}
+	if rl := hs.RunLog(best); rl == nil || rl.Rows != hs.Runs {
+		t.Errorf("expected the run log of the %d runs of the best trial", hs.Runs)
+	}
+	if val, _ := ss.Params.Params.ParamVal("Base", "Network", "#Output", "Layer.Inhib.Layer.Gi"); val != "0.9" {
+		t.Errorf("search changed the params of the sim: Gi = %s", val)
+	}
+}
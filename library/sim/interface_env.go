@@ -1,6 +1,8 @@
 package sim
 
 import (
+	"math/rand"
+
 	"github.com/emer/emergent/env"
 	"github.com/emer/etable/etensor"
 )
@@ -21,8 +23,13 @@ type Environment interface {
 	// State reports what the state of inputs are for a particular layer (e.g. visual or auditory input). It also returns the correct output in a supervised learning task.
 	State(layerName string) etensor.Tensor
 
-	// TODO Add a function for reporting agent output to the world
-	// AgentAction(string) // Maybe something like this?
+	// Action reports the activity of an output layer of the agent to the world. It is
+	// called by ThetaCyc at the start of a theta phase with SendAction, for every
+	// Target layer, after which the world is stepped, and its State applied to the
+	// network again, as in axon.SendActionAndStep. Environments for purely
+	// supervised tasks, whose trials are stepped by the Sim, can ignore it, and
+	// are used with phases without SendAction.
+	Action(layerName string, act etensor.Tensor)
 
 	// TODO Decide whether these should be moved off the interface and into implementing classes.
 	Order() []int
@@ -54,3 +61,45 @@ type Environment interface {
 	// TODO Counter should be removed.
 	Counter(scale env.TimeScales) (cur, prv int, chg bool)
 }
+
+// EpochStarter is implemented by environments that do something at the start
+// of each epoch, such as TableEnv, which shuffles its trials. LoopEpoch calls it.
+type EpochStarter interface {
+	StartEpoch()
+}
+
+// TrialStarter is implemented by environments that move on to their next
+// state at the start of each trial, such as CorpusEnv, as the Sim sets their
+// counters itself instead of calling Step. LoopTrial calls it before applying
+// the inputs of the trial, and TestItem before applying those of the item.
+type TrialStarter interface {
+	StartTrial()
+}
+
+// RandEnv is implemented by environments that draw random numbers, such as
+// TableEnv, which shuffles its trials. NewRun sets their source to ss.Rand,
+// instead of the global one, so that runs in parallel are reproducible.
+type RandEnv interface {
+	SetRand(rnd *rand.Rand)
+}
+
+// CheckpointEnv is implemented by environments with state beyond their counters
+// and Order, such as the position of CorpusEnv in its corpus. It is saved in
+// checkpoints, and restored when a run is resumed.
+type CheckpointEnv interface {
+	SaveState() ([]byte, error)
+	LoadState(b []byte) error
+}
+
+// SequenceEnv is implemented by environments whose trials come in sequences,
+// such as the sentences of CorpusEnv in Sequence mode. LoopTrial clears the
+// activity of the network at the start of each sequence, so that it does not
+// carry over from the previous one, and calls the OnSeqStart and OnSeqEnd
+// TrainingCallbacks at its first and last trials.
+type SequenceEnv interface {
+	// SeqStart returns whether the current trial is the first of a sequence.
+	SeqStart() bool
+
+	// SeqEnd returns whether the current trial is the last of a sequence.
+	SeqEnd() bool
+}
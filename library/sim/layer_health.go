@@ -0,0 +1,42 @@
+package sim
+
+import (
+	"github.com/emer/axon/axon"
+)
+
+// HogThr and DeadThr are the long-term average activity (ActAvg) over and under
+// which a unit counts as a hog or dead unit, in the per-layer health stats.
+var (
+	HogThr  = float32(0.3)
+	DeadThr = float32(0.01)
+)
+
+// HogDead computes the proportion of the units in given layer name, of those
+// that are not off, with ActAvg over HogThr and under DeadThr, and the max
+// GeM (minus phase Ge) of the layer, as the running average ActAvg.AvgMaxGeM
+// that axon adapts the GScale of the projections with. A layer with many hog
+// or dead units, or very weak or strong excitation, usually means the params
+// need tuning.
+func (ss *Sim) HogDead(lnm string) (hog, dead, geMax float64) {
+	ly := ss.Net.LayerByName(lnm).(axon.AxonLayer).AsAxon()
+	geMax = float64(ly.ActAvg.AvgMaxGeM)
+	n := 0
+	for ni := range ly.Neurons {
+		nrn := &ly.Neurons[ni]
+		if nrn.IsOff() {
+			continue
+		}
+		n++
+		if nrn.ActAvg > HogThr {
+			hog += 1
+		} else if nrn.ActAvg < DeadThr {
+			dead += 1
+		}
+	}
+	if n == 0 {
+		return
+	}
+	hog /= float64(n)
+	dead /= float64(n)
+	return
+}
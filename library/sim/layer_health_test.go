@@ -0,0 +1,32 @@
+package sim_test
+
+import (
+	"testing"
+
+	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/etime"
+)
+
+func TestLayerHealth(t *testing.T) {
+	ss := newTestSim()
+	ss.Step(etime.Train, etime.Epoch)
+	dt := ss.Logs.Table(etime.Train, etime.Epoch)
+	for _, lnm := range ss.Net.LayersByClass("Hidden") {
+		for _, nm := range []string{"_ActAvg", "_Hog", "_Dead"} {
+			v := dt.CellFloat(lnm+nm, 0)
+			if v < 0 || v > 1 {
+				t.Errorf("%s%s = %g, expected a proportion", lnm, nm, v)
+			}
+		}
+		if gm := dt.CellFloat(lnm+"_GeMax", 0); gm <= 0 {
+			t.Errorf("%s_GeMax = %g, expected the hidden layer to have some excitation", lnm, gm)
+		}
+		hog, dead, geMax := ss.HogDead(lnm)
+		if dt.CellFloat(lnm+"_Hog", 0) != hog || dt.CellFloat(lnm+"_Dead", 0) != dead || dt.CellFloat(lnm+"_GeMax", 0) != geMax {
+			t.Errorf("%s health was logged as %g, %g, %g, but is %g, %g, %g", lnm, dt.CellFloat(lnm+"_Hog", 0), dt.CellFloat(lnm+"_Dead", 0), dt.CellFloat(lnm+"_GeMax", 0), hog, dead, geMax)
+		}
+		if ly := ss.Net.LayerByName(lnm).(axon.AxonLayer).AsAxon(); geMax != float64(ly.ActAvg.AvgMaxGeM) {
+			t.Errorf("%s GeMax %g is not the running average AvgMaxGeM %g", lnm, geMax, ly.ActAvg.AvgMaxGeM)
+		}
+	}
+}
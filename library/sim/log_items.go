@@ -1,6 +1,8 @@
 package sim
 
 import (
+	"math"
+
 	"github.com/emer/axon/axon"
 	"github.com/emer/emergent/elog"
 	"github.com/emer/emergent/emer"
@@ -21,6 +23,8 @@ func (ss *Sim) InitStats() {
 	ss.Stats.SetFloat("TrlCorrel", 0.0)
 	ss.Stats.SetFloat("TrlUnitErr", 0.0)
 	ss.Stats.SetFloat("TrlCosDiff", 0.0)
+	ss.Stats.SetFloat("TrlNetCE", math.NaN())
+	ss.Stats.SetFloat("TrlNGramCE", math.NaN())
 	ss.Stats.SetInt("FirstZero", -1) // critical to reset to -1
 	ss.Stats.SetInt("LastZero", -1)  // critical to reset to -1
 	ss.Stats.SetInt("NZero", 0)
@@ -90,6 +94,22 @@ func (ss *Sim) ConfigLogItems() {
 			etime.Scope(etime.Train, etime.Run): func(ctx *elog.Context) {
 				ctx.SetStatInt("LastZero")
 			}}})
+	ss.Logs.AddItem(&elog.Item{
+		Name: "StopReason",
+		Type: etensor.STRING,
+		Plot: elog.DFalse,
+		Write: elog.WriteMap{
+			etime.Scope(etime.Train, etime.Run): func(ctx *elog.Context) {
+				ctx.SetString(ss.EarlyStop.Reason)
+			}}})
+	ss.Logs.AddItem(&elog.Item{
+		Name: "Lrate",
+		Type: etensor.FLOAT64,
+		Plot: elog.DFalse,
+		Write: elog.WriteMap{
+			etime.Scope(etime.Train, etime.Epoch): func(ctx *elog.Context) {
+				ctx.SetFloat32(ss.LrateSched.Mult)
+			}}})
 	ss.Logs.AddItem(&elog.Item{
 		Name: "UnitErr",
 		Type: etensor.FLOAT64,
@@ -100,12 +120,7 @@ func (ss *Sim) ConfigLogItems() {
 			}, etime.Scope(etime.AllModes, etime.Epoch): func(ctx *elog.Context) {
 				ctx.SetAgg(ctx.Mode, etime.Trial, agg.AggMean)
 			}, etime.Scope(etime.AllModes, etime.Run): func(ctx *elog.Context) {
-				if ctx.Row == 0 {
-					ctx.SetFloat64(0)
-					return
-				}
-				ix := ctx.LastNRows(ctx.Mode, etime.Epoch, 5)
-				ctx.SetFloat64(agg.Mean(ix, ctx.Item.Name)[0])
+				ctx.SetFloat64(ss.LastEpochsMean(ctx.Mode, ctx.Item.Name, 5))
 			}}})
 	ss.Logs.AddItem(&elog.Item{
 		Name: "Err",
@@ -138,12 +153,7 @@ func (ss *Sim) ConfigLogItems() {
 			}, etime.Scope(etime.Test, etime.Epoch): func(ctx *elog.Context) {
 				ctx.SetAggItem(ctx.Mode, etime.Trial, "Err", agg.AggMean)
 			}, etime.Scope(etime.AllModes, etime.Run): func(ctx *elog.Context) {
-				if ctx.Row == 0 {
-					ctx.SetFloat64(0)
-					return
-				}
-				ix := ctx.LastNRows(ctx.Mode, etime.Epoch, 5) // cached
-				ctx.SetFloat64(agg.Mean(ix, ctx.Item.Name)[0])
+				ctx.SetFloat64(ss.LastEpochsMean(ctx.Mode, ctx.Item.Name, 5))
 			}}})
 	ss.Logs.AddItem(&elog.Item{
 		Name:   "PctCor",
@@ -154,13 +164,136 @@ func (ss *Sim) ConfigLogItems() {
 			etime.Scope(etime.AllModes, etime.Epoch): func(ctx *elog.Context) {
 				ctx.SetFloat64(1 - ctx.ItemFloatScope(ctx.Scope, "PctErr"))
 			}, etime.Scope(etime.AllModes, etime.Run): func(ctx *elog.Context) {
-				if ctx.Row == 0 {
-					ctx.SetFloat64(0)
-					return
-				}
-				ix := ctx.LastNRows(ctx.Mode, etime.Epoch, 5) // cached
-				ctx.SetFloat64(agg.Mean(ix, ctx.Item.Name)[0])
+				ctx.SetFloat64(ss.LastEpochsMean(ctx.Mode, ctx.Item.Name, 5))
 			}}})
+	// generalization to the held-out items, in the final test of each run -- see PatSplit
+	if ss.Split.On() {
+		ss.Logs.AddItem(&elog.Item{
+			Name:  "Fold",
+			Type:  etensor.INT64,
+			Plot:  elog.DFalse,
+			Range: minmax.F64{Min: -1},
+			Write: elog.WriteMap{
+				etime.Scope(etime.Train, etime.Run): func(ctx *elog.Context) {
+					ctx.SetInt(ss.Split.Fold(ss.Run.Cur))
+				}}})
+		ss.Logs.AddItem(&elog.Item{
+			Name:   "TestPctErr",
+			Type:   etensor.FLOAT64,
+			FixMax: elog.DTrue,
+			Range:  minmax.F64{Max: 1},
+			Write: elog.WriteMap{
+				etime.Scope(etime.Train, etime.Run): func(ctx *elog.Context) {
+					dt := ss.Logs.Table(etime.Test, etime.Epoch)
+					if dt.Rows == 0 {
+						ctx.SetFloat64(math.NaN())
+						return
+					}
+					ctx.SetFloat64(dt.CellFloat("PctErr", dt.Rows-1))
+				}}})
+		ss.Logs.AddItem(&elog.Item{
+			Name: "GenGap",
+			Type: etensor.FLOAT64,
+			Write: elog.WriteMap{
+				etime.Scope(etime.Train, etime.Run): func(ctx *elog.Context) {
+					// held-out test error minus training error, both at the end of the run
+					trn := ss.Logs.Table(etime.Train, etime.Epoch)
+					tst := ss.Logs.Table(etime.Test, etime.Epoch)
+					if trn.Rows == 0 || tst.Rows == 0 {
+						ctx.SetFloat64(math.NaN())
+						return
+					}
+					ctx.SetFloat64(tst.CellFloat("PctErr", tst.Rows-1) - trn.CellFloat("PctErr", trn.Rows-1))
+				}}})
+	}
+	// precision and recall of each class over the test trials -- see Confusion
+	ss.Confusion.Init(ss.ConfusionClasses())
+	if ncls := len(ss.Confusion.Classes); ncls > 0 {
+		ss.Logs.AddItem(&elog.Item{
+			Name:      "Precision",
+			Type:      etensor.FLOAT64,
+			CellShape: []int{ncls},
+			Plot:      elog.DFalse,
+			Range:     minmax.F64{Max: 1},
+			Write: elog.WriteMap{
+				etime.Scope(etime.Test, etime.Epoch): func(ctx *elog.Context) {
+					prec, _ := ss.Confusion.Scores()
+					ctx.SetTensor(etensor.NewFloat64Shape(etensor.NewShape([]int{ncls}, nil, nil), prec))
+				}}})
+		ss.Logs.AddItem(&elog.Item{
+			Name:      "Recall",
+			Type:      etensor.FLOAT64,
+			CellShape: []int{ncls},
+			Plot:      elog.DFalse,
+			Range:     minmax.F64{Max: 1},
+			Write: elog.WriteMap{
+				etime.Scope(etime.Test, etime.Epoch): func(ctx *elog.Context) {
+					_, rec := ss.Confusion.Scores()
+					ctx.SetTensor(etensor.NewFloat64Shape(etensor.NewShape([]int{ncls}, nil, nil), rec))
+				}}})
+		ss.Logs.AddItem(&elog.Item{
+			Name:   "MeanPrecision",
+			Type:   etensor.FLOAT64,
+			FixMax: elog.DTrue,
+			Range:  minmax.F64{Max: 1},
+			Write: elog.WriteMap{
+				etime.Scope(etime.Test, etime.Epoch): func(ctx *elog.Context) {
+					prec, _ := ss.Confusion.Scores()
+					ctx.SetFloat64(meanNoNaN(prec))
+				}}})
+		ss.Logs.AddItem(&elog.Item{
+			Name:   "MeanRecall",
+			Type:   etensor.FLOAT64,
+			FixMax: elog.DTrue,
+			Range:  minmax.F64{Max: 1},
+			Write: elog.WriteMap{
+				etime.Scope(etime.Test, etime.Epoch): func(ctx *elog.Context) {
+					_, rec := ss.Confusion.Scores()
+					ctx.SetFloat64(meanNoNaN(rec))
+				}}})
+	}
+	// cross-entropy, perplexity and top-k accuracy of the next word predictions
+	// of the network and the n-gram baseline -- see NGramEval
+	if _, ok := ss.TestEnv.(*CorpusEnv); ok {
+		for _, src := range []string{"Net", "NGram"} {
+			src := src
+			means := func() (ce, topk float64) {
+				netCE, ngramCE, netTopK, ngramTopK := ss.NGramEval.Means()
+				if src == "Net" {
+					return netCE, netTopK
+				}
+				return ngramCE, ngramTopK
+			}
+			ss.Logs.AddItem(&elog.Item{
+				Name: src + "CE",
+				Type: etensor.FLOAT64,
+				Write: elog.WriteMap{
+					etime.Scope(etime.Test, etime.Trial): func(ctx *elog.Context) {
+						ctx.SetFloat64(ss.Stats.Float("Trl" + src + "CE"))
+					}, etime.Scope(etime.Test, etime.Epoch): func(ctx *elog.Context) {
+						ce, _ := means()
+						ctx.SetFloat64(ce)
+					}}})
+			ss.Logs.AddItem(&elog.Item{
+				Name: src + "PPL",
+				Type: etensor.FLOAT64,
+				Write: elog.WriteMap{
+					etime.Scope(etime.Test, etime.Epoch): func(ctx *elog.Context) {
+						ce, _ := means()
+						ctx.SetFloat64(math.Exp(ce))
+					}}})
+			ss.Logs.AddItem(&elog.Item{
+				Name:   src + "TopK",
+				Type:   etensor.FLOAT64,
+				FixMax: elog.DTrue,
+				Range:  minmax.F64{Max: 1},
+				Write: elog.WriteMap{
+					etime.Scope(etime.Test, etime.Epoch): func(ctx *elog.Context) {
+						_, topk := means()
+						ctx.SetFloat64(topk)
+					}}})
+		}
+	}
 	ss.Logs.AddItem(&elog.Item{
 		Name:   "CosDiff",
 		Type:   etensor.FLOAT64,
@@ -172,12 +305,7 @@ func (ss *Sim) ConfigLogItems() {
 			}, etime.Scope(etime.AllModes, etime.Epoch): func(ctx *elog.Context) {
 				ctx.SetAgg(ctx.Mode, etime.Trial, agg.AggMean)
 			}, etime.Scope(etime.Train, etime.Run): func(ctx *elog.Context) {
-				if ctx.Row == 0 {
-					ctx.SetFloat64(0)
-					return
-				}
-				ix := ctx.LastNRows(etime.Train, etime.Epoch, 5) // cached
-				ctx.SetFloat64(agg.Mean(ix, ctx.Item.Name)[0])
+				ctx.SetFloat64(ss.LastEpochsMean(etime.Train, ctx.Item.Name, 5))
 			}}})
 	ss.Logs.AddItem(&elog.Item{
 		Name:   "Correl",
@@ -190,12 +318,7 @@ func (ss *Sim) ConfigLogItems() {
 			}, etime.Scope(etime.AllModes, etime.Epoch): func(ctx *elog.Context) {
 				ctx.SetAgg(ctx.Mode, etime.Trial, agg.AggMean)
 			}, etime.Scope(etime.Train, etime.Run): func(ctx *elog.Context) {
-				if ctx.Row == 0 {
-					ctx.SetFloat64(0)
-					return
-				}
-				ix := ctx.LastNRows(etime.Train, etime.Epoch, 5) // cached
-				ctx.SetFloat64(agg.Mean(ix, ctx.Item.Name)[0])
+				ctx.SetFloat64(ss.LastEpochsMean(etime.Train, ctx.Item.Name, 5))
 			}}})
 	ss.Logs.AddItem(&elog.Item{
 		Name: "PerTrlMSec",
@@ -213,6 +336,12 @@ func (ss *Sim) ConfigLogItems() {
 				tmr.ResetStart()
 			}}})
 
+	// the Train Cycle log is only written for -cyclelog, as it is slow
+	cycModes := []etime.Modes{etime.Test}
+	if cs, err := ParseCycleSample(ss.CmdArgs.cycleLog); ss.CmdArgs.cycleLog != "" && err == nil && cs.Mode != etime.Test {
+		cycModes = append(cycModes, etime.Train)
+	}
+
 	// Standard stats for Ge and AvgAct tuning -- for all hidden, output layers
 	layers := ss.Net.LayersByClass("Hidden", "Target")
 	for _, lnm := range layers {
@@ -264,7 +393,7 @@ func (ss *Sim) ConfigLogItems() {
 			Type:  etensor.FLOAT64,
 			Range: minmax.F64{Max: 1},
 			Write: elog.WriteMap{
-				etime.Scope(etime.Test, etime.Cycle): func(ctx *elog.Context) {
+				etime.Scopes(cycModes, []etime.Times{etime.Cycle}): func(ctx *elog.Context) {
 					ly := ctx.Layer(clnm).(axon.AxonLayer).AsAxon()
 					ctx.SetFloat32(ly.Pools[0].Inhib.Ge.Avg)
 				}}})
@@ -273,7 +402,7 @@ func (ss *Sim) ConfigLogItems() {
 			Type:  etensor.FLOAT64,
 			Range: minmax.F64{Max: 1},
 			Write: elog.WriteMap{
-				etime.Scope(etime.Test, etime.Cycle): func(ctx *elog.Context) {
+				etime.Scopes(cycModes, []etime.Times{etime.Cycle}): func(ctx *elog.Context) {
 					ly := ctx.Layer(clnm).(axon.AxonLayer).AsAxon()
 					ctx.SetFloat32(ly.Pools[0].Inhib.Act.Avg)
 				}}})
@@ -325,8 +454,61 @@ func (ss *Sim) ConfigLogItems() {
 		}
 	}
 
-	// hidden activities for PCA analysis, and PCA results
+	// hidden layer health: proportion of hog and dead units, and max Ge -- see HogDead.
+	// _Hog computes all of them, and _Dead and _GeMax read them from the Stats.
 	layers = ss.Net.LayersByClass("Hidden")
+	for _, lnm := range layers {
+		clnm := lnm
+		ss.Logs.AddItem(&elog.Item{
+			Name:   clnm + "_Hog",
+			Type:   etensor.FLOAT64,
+			Plot:   elog.DFalse,
+			FixMax: elog.DTrue,
+			Range:  minmax.F64{Max: 1},
+			Write: elog.WriteMap{
+				etime.Scope(etime.Train, etime.Epoch): func(ctx *elog.Context) {
+					hog, dead, geMax := ss.HogDead(clnm)
+					ctx.Stats.SetFloat(clnm+"_Hog", hog)
+					ctx.Stats.SetFloat(clnm+"_Dead", dead)
+					ctx.Stats.SetFloat(clnm+"_GeMax", geMax)
+					ctx.SetFloat64(hog)
+				}}})
+		ss.Logs.AddItem(&elog.Item{
+			Name:   clnm + "_Dead",
+			Type:   etensor.FLOAT64,
+			Plot:   elog.DFalse,
+			FixMax: elog.DTrue,
+			Range:  minmax.F64{Max: 1},
+			Write: elog.WriteMap{
+				etime.Scope(etime.Train, etime.Epoch): func(ctx *elog.Context) {
+					ctx.SetStatFloat(ctx.Item.Name)
+				}}})
+		ss.Logs.AddItem(&elog.Item{
+			Name: clnm + "_GeMax",
+			Type: etensor.FLOAT64,
+			Plot: elog.DFalse,
+			Write: elog.WriteMap{
+				etime.Scope(etime.Train, etime.Epoch): func(ctx *elog.Context) {
+					ctx.SetStatFloat(ctx.Item.Name)
+				}}})
+	}
+
+	// RSA stats over the test patterns -- see RSA
+	for _, lnm := range ss.RSALayers() {
+		for _, st := range []string{"_RSAWithin", "_RSABetween", "_RSAInput"} {
+			ss.Logs.AddItem(&elog.Item{
+				Name:  lnm + st,
+				Type:  etensor.FLOAT64,
+				Plot:  elog.DFalse,
+				Range: minmax.F64{Min: -1, Max: 1},
+				Write: elog.WriteMap{
+					etime.Scope(etime.Test, etime.Epoch): func(ctx *elog.Context) {
+						ctx.SetStatFloat(ctx.Item.Name)
+					}}})
+		}
+	}
+
+	// hidden activities for PCA analysis, and PCA results
 	for _, lnm := range layers {
 		clnm := lnm
 		cly := ss.Net.LayerByName(clnm)
@@ -2,6 +2,7 @@ package sim
 
 import (
 	"fmt"
+	"math"
 	"github.com/emer/emergent/etime"
 
 	"github.com/emer/axon/axon"
@@ -30,6 +31,8 @@ func (ss *Sim) ConfigLogsFromArgs() {
 		fnm := ss.LogFileName("testtrial")
 		ss.Logs.SetLogFile(etime.Test, etime.Trial, fnm)
 	}
+	ss.ConfigArrowLogs()
+	ss.ConfigCycleRecorders()
 }
 
 func (ss *Sim) ConfigLogs() {
@@ -83,6 +86,10 @@ func (ss *Sim) Log(mode etime.Modes, time etime.Times) {
 	}
 
 	ss.Logs.LogRow(mode, time, row) // also logs to file, etc
+	ss.logArrowRow(mode, time, row)
+	if ss.Metrics != nil {
+		ss.Metrics.Publish(ss, mode, time, row)
+	}
 	if time == etime.Cycle {
 		ss.GUI.UpdateCyclePlot(etime.Test, ss.Time.Cycle)
 	} else {
@@ -91,6 +98,7 @@ func (ss *Sim) Log(mode etime.Modes, time etime.Times) {
 
 	switch {
 	case mode == etime.Train && time == etime.Run:
+		ss.recordCurve()
 		ss.LogRunStats()
 	}
 }
@@ -109,6 +117,10 @@ func (ss *Sim) LogMiddle(mode etime.Modes, time etime.Times) {
 	}
 
 	ss.Logs.LogRow(mode, time, row) // also logs to file, etc
+	ss.logArrowRow(mode, time, row)
+	if ss.Metrics != nil {
+		ss.Metrics.Publish(ss, mode, time, row)
+	}
 	if time == etime.Cycle {
 		ss.GUI.UpdateCyclePlot(etime.Test, ss.Time.Cycle)
 	} else {
@@ -117,6 +129,7 @@ func (ss *Sim) LogMiddle(mode etime.Modes, time etime.Times) {
 
 	switch {
 	case mode == etime.Train && time == etime.Run:
+		ss.recordCurve()
 		ss.LogRunStats()
 	}
 }
@@ -137,7 +150,8 @@ func (ss *Sim) LogTestErrors() {
 	ss.Logs.MiscTables["TestErrorStats"] = allsp.AggsToTable(etable.AddAggName)
 }
 
-// LogRunStats records stats across all runs, at Train Run scope
+// LogRunStats records stats across all runs, at Train Run scope, including
+// those of ss.RunAgg
 func (ss *Sim) LogRunStats() {
 	sk := etime.Scope(etime.Train, etime.Run)
 	lt := ss.Logs.TableDetailsScope(sk)
@@ -146,7 +160,30 @@ func (ss *Sim) LogRunStats() {
 	spl := split.GroupBy(ix, []string{"Params"})
 	split.Desc(spl, "FirstZero")
 	split.Desc(spl, "PctCor")
+	if ss.Split.On() {
+		split.Desc(spl, "GenGap")
+	}
 	ss.Logs.MiscTables["RunStats"] = spl.AggsToTable(etable.AddAggName)
+	ss.AggregateRuns()
+}
+
+// LastEpochsMean returns the mean of column col over the last n rows of the
+// Epoch log of mode, which has the epochs of the current run only, as the
+// value of col at the end of the run -- NaN if there are no epochs.
+func (ss *Sim) LastEpochsMean(mode etime.Modes, col string, n int) float64 {
+	dt := ss.Logs.Table(mode, etime.Epoch)
+	if dt == nil || dt.Rows == 0 {
+		return math.NaN()
+	}
+	st := dt.Rows - n
+	if st < 0 {
+		st = 0
+	}
+	sum := 0.0
+	for r := st; r < dt.Rows; r++ {
+		sum += dt.CellFloat(col, r)
+	}
+	return sum / float64(dt.Rows-st)
 }
 
 // PCAStats computes PCA statistics on recorded hidden activation patterns
@@ -0,0 +1,139 @@
+package sim
+
+import (
+	"fmt"
+
+	"github.com/emer/emergent/etime"
+)
+
+// LoopStack is the position of one evaluation mode (Train or Test) within its
+// nested loops of Run, Epoch, Trial, theta Phase and Cycle. The Epoch and Trial
+// counters are in the Environment for the mode, and the rest is here, so that
+// each mode keeps its own place when switching between them with SetMode,
+// e.g., to test in the middle of a training epoch.
+type LoopStack struct {
+	Mode       etime.Modes  `desc:"evaluation mode of this stack"`
+	Env        *Environment `desc:"environment with the Epoch and Trial counters for this mode"`
+	InRun      bool         `desc:"a run has been started and not yet finished"`
+	InEpoch    bool         `desc:"an epoch has been started and not yet finished"`
+	Phase      int          `desc:"index of the current theta phase in Trainer.Phases"`
+	Cycle      int          `desc:"Time.Cycle of this mode, saved while another mode is current"`
+	PhaseCycle int          `desc:"Time.PhaseCycle of this mode, saved while another mode is current"`
+	PlusPhase  bool         `desc:"Time.PlusPhase of this mode, saved while another mode is current"`
+	Stepped    bool         `desc:"one unit of the stop time scale of the current step has been completed"`
+
+	layers []LayerState // network activity saved while another mode is current, if switched in the middle of a trial
+	prjns  []PrjnState
+}
+
+// ResetTrial discards any partially run trial.
+func (st *LoopStack) ResetTrial() {
+	st.Phase = 0
+	st.Cycle = 0
+	st.PhaseCycle = 0
+	st.PlusPhase = false
+	st.layers = nil
+	st.prjns = nil
+}
+
+// Reset goes back to the start of a run.
+func (st *LoopStack) Reset() {
+	st.InRun = false
+	st.InEpoch = false
+	st.Stepped = false
+	st.ResetTrial()
+}
+
+// Stack returns the loop stack for given mode, making it if needed.
+func (ss *Sim) Stack(mode etime.Modes) *LoopStack {
+	if ss.Trainer.Stacks == nil {
+		ss.Trainer.Stacks = make(map[etime.Modes]*LoopStack)
+	}
+	st, has := ss.Trainer.Stacks[mode]
+	if !has {
+		st = &LoopStack{Mode: mode, Env: &ss.TestEnv}
+		if mode == etime.Train {
+			st.Env = &ss.TrainEnv
+		}
+		ss.Trainer.Stacks[mode] = st
+	}
+	return st
+}
+
+// CurStack returns the loop stack for the current mode.
+func (ss *Sim) CurStack() *LoopStack {
+	return ss.Stack(ss.Trainer.EvalMode)
+}
+
+// SetMode makes mode the current evaluation mode, setting Trainer.EvalMode and
+// CurEnv. The position of the previous mode within its trial is saved, including
+// the network activity if it was in the middle of one, and that of the new mode
+// is restored. Returns the previous mode, so it can be restored in turn.
+func (ss *Sim) SetMode(mode etime.Modes) etime.Modes {
+	prv := ss.Trainer.EvalMode
+	if ss.Trainer.CurEnv != nil {
+		if mode == prv {
+			return prv
+		}
+		old := ss.Stack(prv)
+		old.Cycle = ss.Time.Cycle
+		old.PhaseCycle = ss.Time.PhaseCycle
+		old.PlusPhase = ss.Time.PlusPhase
+		old.layers, old.prjns = nil, nil
+		if ss.Time.Cycle > 0 {
+			old.layers = ss.LayerStates()
+			old.prjns = ss.PrjnStates(false)
+		}
+	}
+	st := ss.Stack(mode)
+	ss.Time.Cycle = st.Cycle
+	ss.Time.PhaseCycle = st.PhaseCycle
+	ss.Time.PlusPhase = st.PlusPhase
+	if st.layers != nil {
+		if err := ss.SetLayerStates(st.layers); err != nil {
+			fmt.Println(err)
+		}
+		if err := ss.SetPrjnStates(st.prjns); err != nil {
+			fmt.Println(err)
+		}
+		st.layers, st.prjns = nil, nil
+	}
+	st.Stepped = false
+	ss.Trainer.EvalMode = mode
+	ss.Trainer.CurEnv = st.Env
+	return prv
+}
+
+// stopping returns true if the current step should stop before starting
+// anything new: the GUI has asked to stop, or the step is done.
+func (ss *Sim) stopping() bool {
+	return ss.GUI.StopNow || ss.CurStack().Stepped
+}
+
+// done records that one unit of given time scale has been completed,
+// which ends the current step if that is its stop scale.
+func (ss *Sim) done(scale, stopScale etime.Times) {
+	if scale == stopScale {
+		ss.CurStack().Stepped = true
+	}
+}
+
+// Step runs the given mode, continuing from where it left off, until one unit of
+// stopScale has been completed, or the GUI stops it. For etime.TimesN, Train
+// runs through all remaining runs and Test through all remaining test epochs.
+// The Train and Test modes each keep their own position, so stepping one does not
+// affect the other.
+func (ss *Sim) Step(mode etime.Modes, stopScale etime.Times) {
+	ss.SetMode(mode)
+	ss.CurStack().Stepped = false
+	if mode == etime.Train {
+		for ; ss.Run.Cur < ss.Run.Max; ss.Run.Cur++ {
+			if !ss.loopRun(stopScale) {
+				break
+			}
+		}
+	} else {
+		ss.loopRun(stopScale)
+	}
+	ss.CurStack().Stepped = false
+}
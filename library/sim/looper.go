@@ -5,9 +5,12 @@ import (
 	"fmt"
 	"github.com/emer/emergent/etime"
 	"log"
+	"time"
 
 	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/emer"
 	_ "github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
 	"github.com/goki/gi/gi"
 )
 
@@ -15,25 +18,43 @@ import (
 // 	    Cycles related to running the Network at different timescales.
 // 		File organized from fastest timescales to slowest, train then test.
 
-// ThetaCyc runs one theta cycle (200 msec) of processing.
+// ThetaCyc runs one theta cycle (200 msec) of processing, continuing from where
+// the current mode left off if it was stopped in the middle of one.
 // External inputs must have already been applied prior to calling,
 // using ApplyExt method on relevant layers (see TrainTrial, TestTrial).
 // If train is true, then learning DWt or WtFmDWt calls are made.
-// Handles netview updating within scope, and calls TrainStats()
-func (ss *Sim) ThetaCyc(stopScale etime.Times) {
+// Handles netview updating within scope, and calls TrainStats().
+// Returns true if the theta cycle was completed.
+func (ss *Sim) ThetaCyc(stopScale etime.Times) bool {
 	train := ss.Trainer.EvalMode == etime.Train
+	st := ss.CurStack()
 
 	if ss.Time.Cycle == 0 {
+		if ss.stopping() {
+			return false
+		}
 		ss.Net.NewState()
 		ss.Time.NewState(etime.Train.String())
 		ss.Trainer.OnThetaStart()
 	}
 
-	for _, phase := range ss.Trainer.Phases {
-		if phase.PhaseStart != nil {
-			phase.PhaseStart()
+	for ; st.Phase < len(ss.Trainer.Phases); st.Phase++ {
+		phase := ss.Trainer.Phases[st.Phase]
+		if ss.Time.PhaseCycle == 0 {
+			if ss.stopping() {
+				return false
+			}
+			if phase.SendAction {
+				ss.SendAction(*ss.Trainer.CurEnv)
+			}
+			if phase.PhaseStart != nil {
+				phase.PhaseStart()
+			}
 		}
-		for ; ss.Time.PhaseCycle < phase.Duration; ss.Time.CycleInc() {
+		for ss.Time.PhaseCycle < phase.Duration {
+			if ss.stopping() {
+				return false
+			}
 
 			ss.Net.Cycle(&ss.Time)
 
@@ -43,20 +64,14 @@ func (ss *Sim) ThetaCyc(stopScale etime.Times) {
 			// Configuring Train/Cycle log items might be slow.
 			ss.Log(ss.Trainer.EvalMode, etime.Cycle)
 
-			if ss.GUI.Active {
+			if ss.GUI.Active || ss.recording(ss.RasterRecs) {
 				ss.RasterRec(ss.Time.Cycle)
 			}
 
 			ss.Trainer.OnMillisecondEnd()
 
-			if stopScale == etime.Cycle {
-				ss.GUI.StopNow = true
-				ss.Time.CycleInc()
-			}
-			if ss.GUI.StopNow == true {
-				return
-			}
-
+			ss.Time.CycleInc()
+			ss.done(etime.Cycle, stopScale)
 		}
 		ss.Time.PhaseCycle = 0
 		if phase.PhaseEnd != nil {
@@ -65,6 +80,7 @@ func (ss *Sim) ThetaCyc(stopScale etime.Times) {
 
 		ss.Trainer.OnEveryPhaseEnd()
 	}
+	st.Phase = 0
 	ss.Time.Cycle = 0
 
 	ss.TrialStatsFunc(ss, train)
@@ -74,6 +90,7 @@ func (ss *Sim) ThetaCyc(stopScale etime.Times) {
 		ss.GUI.UpdatePlot(etime.Test, etime.Cycle) // make sure always updated at end
 	}
 	ss.Trainer.OnThetaEnd()
+	return true
 }
 
 // ApplyInputs applies input patterns from given envirbonment.
@@ -96,53 +113,98 @@ func (ss *Sim) ApplyInputs(env Environment) {
 	}
 }
 
-func (ss *Sim) LoopTrial(stopScale etime.Times) {
-	if (*ss.Trainer.CurEnv).Trial().Cur == -1 {
-		// This is a hack, and it should be initialized at 0
-		(*ss.Trainer.CurEnv).Trial().Cur = 0
+// SendAction reports the minus phase activity (ActM) of each of the Target
+// layers of the network to the environment, with its Action method, and then
+// steps the environment and applies its new State to the network, following
+// axon.SendActionAndStep.
+func (ss *Sim) SendAction(env Environment) {
+	for _, lnm := range ss.Net.LayersByClass(emer.Target.String()) {
+		ly := ss.Net.LayerByName(lnm).(axon.AxonLayer).AsAxon()
+		act := &etensor.Float32{}
+		ly.UnitValsTensor(act, "ActM")
+		env.Action(lnm, act)
 	}
+	env.Step()
+	ss.ApplyInputs(env)
+}
 
-	ss.UpdateNetViewText(true)
-	ss.ApplyInputs(*ss.Trainer.CurEnv)
-
-	ss.ThetaCyc(stopScale)
+// LoopTrial runs the current trial of the current mode, or the rest of it if it
+// was stopped part way through. Returns true if the trial was completed.
+// It does not advance the trial counter -- that is done by LoopEpoch.
+func (ss *Sim) LoopTrial(stopScale etime.Times) bool {
+	if ss.Time.Cycle == 0 {
+		if ss.stopping() {
+			return false
+		}
+		if ts, ok := (*ss.Trainer.CurEnv).(TrialStarter); ok {
+			ts.StartTrial()
+		}
+		ss.UpdateNetViewText(true)
+		seqStart := false
+		if se, ok := (*ss.Trainer.CurEnv).(SequenceEnv); ok && se.SeqStart() {
+			seqStart = true
+			ss.Net.InitActs() // before ApplyInputs, as it also clears the Ext and Targ inputs
+		}
+		ss.ApplyInputs(*ss.Trainer.CurEnv)
+		if seqStart {
+			ss.Trainer.OnSeqStart()
+		}
+		ss.Logs.ResetLog(ss.Trainer.EvalMode, etime.Cycle) // only keep the cycles of the current trial
+	}
 
-	if ss.GUI.StopNow == true {
-		return
+	if !ss.ThetaCyc(stopScale) {
+		return false
 	}
+	se, ok := (*ss.Trainer.CurEnv).(SequenceEnv)
+	seqEnd := ok && se.SeqEnd()
 
 	ss.Log(ss.Trainer.EvalMode, etime.Trial)
+	ss.RecordTrialDynamics()
 
 	ss.Trainer.OnTrialEnd()
+	if seqEnd {
+		ss.Trainer.OnSeqEnd()
+	}
 
 	if ss.Trainer.EvalMode == etime.Test {
 		if ss.CmdArgs.NetData != nil { // offline record net data from testing, just final state
 			ss.CmdArgs.NetData.Record(ss.GUI.NetViewText)
 		}
 	}
+	ss.done(etime.Trial, stopScale)
+	return true
 }
 
 // LoopEpoch runs until the end of the Epoch, then updates logs.
-func (ss *Sim) LoopEpoch(stopScale etime.Times) {
-	if (*ss.Trainer.CurEnv).Trial().Cur == 0 {
+// Returns true if the epoch was completed.
+func (ss *Sim) LoopEpoch(stopScale etime.Times) bool {
+	st := ss.CurStack()
+	trl := (*ss.Trainer.CurEnv).Trial()
+	if !st.InEpoch {
+		if ss.stopping() {
+			return false
+		}
+		trl.Cur = 0 // env Init leaves this at -1, for env.Step, but the Sim sets the counters itself
+		if es, ok := (*ss.Trainer.CurEnv).(EpochStarter); ok {
+			es.StartEpoch()
+		}
 		ss.Logs.ResetLog(ss.Trainer.EvalMode, etime.Trial)
 		ss.Trainer.OnEpochStart()
+		st.InEpoch = true
 	}
-	for ; (*ss.Trainer.CurEnv).Trial().Cur < (*ss.Trainer.CurEnv).Trial().Max; (*ss.Trainer.CurEnv).Trial().Cur += 1 {
-		ss.LoopTrial(stopScale)
-		if stopScale == etime.Trial {
-			ss.GUI.StopNow = true
-			(*ss.Trainer.CurEnv).Trial().Cur += 1
-		}
-		if ss.GUI.StopNow == true {
-			return
+	for ; trl.Cur < trl.Max; trl.Cur++ {
+		if !ss.LoopTrial(stopScale) {
+			return false
 		}
 	}
-	(*ss.Trainer.CurEnv).Trial().Cur = 0
+	trl.Cur = 0
+	st.InEpoch = false
 
 	ss.Trainer.OnEpochEnd()
 	// Log after OnEpochEnd.
 	ss.Log(ss.Trainer.EvalMode, etime.Epoch)
+	ss.done(etime.Epoch, stopScale)
+	return true
 }
 
 // NewRun intializes a new run of the model, using the ss.Run counter
@@ -153,81 +215,97 @@ func (ss *Sim) NewRun() {
 	TestEnv := ss.TestEnv
 
 	run := ss.Run.Cur
+	ss.ApplySplit(run)
+	for _, ev := range []Environment{TrainEnv, TestEnv} {
+		if re, ok := ev.(RandEnv); ok {
+			re.SetRand(ss.Rand)
+		}
+	}
 	TrainEnv.Init(run)
 	TestEnv.Init(run)
 	ss.Time.Reset()
 	ss.InitRndSeed() //todo should be removed, for debuggin pruposes
-	ss.Net.InitWts()
+	ss.InitWts()
 	ss.LoadPretrainedWts()
 	ss.InitStats()
+	ss.EarlyStop.Reset()
+	ss.Snapshots.Reset()
 	ss.UpdateNetViewText(true)
 
 	// TODO Should this reset all non-run logs?
 	ss.Logs.ResetLog(etime.Train, etime.Epoch)
 	ss.Logs.ResetLog(etime.Test, etime.Epoch)
 	ss.CmdArgs.NeedsNewRun = false
+	ss.Stack(etime.Test).Reset()
+	st := ss.Stack(etime.Train)
+	st.Reset()
+	st.InRun = true
+	ss.SaveSnapshotsIfDue(0)
 }
 
 // RunEnd is called at the end of a run -- save weights, record final log, etc here
 func (ss *Sim) RunEnd() {
+	if ss.Split.On() {
+		ss.TestAll() // the Run log has the PctErr of a final test of the held-out items
+	}
 	ss.Log(ss.Trainer.EvalMode, etime.Run)
 
 	ss.Trainer.OnRunEnd()
+	if ss.GUI.Active && ss.Manifest != nil {
+		ss.Manifest.End = time.Now()
+		ss.saveManifest()
+	}
 }
 
-func (ss *Sim) loopRun(stopScale etime.Times) {
-	if (*ss.Trainer.CurEnv).Epoch().Cur <= 0 && (*ss.Trainer.CurEnv).Trial().Cur <= 0 && ss.Time.Cycle <= 0 {
-		if ss.Trainer.EvalMode == etime.Train {
+// loopRun runs through all the epochs of the current mode, starting a new run
+// first if the previous one has ended. For Train, each run starts with NewRun
+// and ends with RunEnd. Returns true if the run was completed.
+func (ss *Sim) loopRun(stopScale etime.Times) bool {
+	train := ss.Trainer.EvalMode == etime.Train
+	st := ss.CurStack()
+	epc := (*ss.Trainer.CurEnv).Epoch()
+	if !st.InRun {
+		if ss.stopping() {
+			return false
+		}
+		if train {
 			ss.NewRun()
+		} else {
+			epc.Cur = 0
+			st.InRun = true
 		}
 	}
-	if (*ss.Trainer.CurEnv).Trial().Cur == -1 {
-		// This is a hack, and it should be initialized at 0
-		(*ss.Trainer.CurEnv).Trial().Cur = 0
-	}
-	// TODO Put "|| ss.Trainer.RunStopEarly()" in conditional, verify
-	for ; (*ss.Trainer.CurEnv).Epoch().Cur < (*ss.Trainer.CurEnv).Epoch().Max; (*ss.Trainer.CurEnv).Epoch().Cur += 1 {
-		ss.LoopEpoch(stopScale)
-		ss.UpdateNetViewText(true)
-		if stopScale == etime.Epoch {
-			ss.GUI.StopNow = true
-			(*ss.Trainer.CurEnv).Epoch().Cur += 1
+	for ; epc.Cur < epc.Max; epc.Cur++ {
+		if !ss.LoopEpoch(stopScale) {
+			return false
+		}
+		if train {
+			ss.SaveSnapshotsIfDue(epc.Cur + 1)
 		}
-		if ss.Trainer.RunStopEarly() {
-			// End this run early
+		ss.UpdateNetViewText(true)
+		if train && ss.Trainer.RunStopEarly() {
+			// End this run early -- but not a test, which is also done in runs
 			break
 		}
-		if ss.GUI.StopNow == true {
-			return
+		if train {
+			ss.SaveCheckpointIfDue(epc.Cur)
 		}
 	}
-	(*ss.Trainer.CurEnv).Epoch().Cur = 0
-	if ss.Trainer.EvalMode == etime.Train {
+	epc.Cur = 0
+	st.InRun = false
+	if train {
 		ss.RunEnd()
 	}
+	ss.done(etime.Run, stopScale)
+	return true
 }
 
 // Train trains until the end of runs, unless stopped early by the GUI. Will stop after the end of one unit of time if indicated by stopScale.
-// TODO Create a TimeScales for never stop.
+// Training continues from where it left off, and is not affected by any testing done in the meantime.
 func (ss *Sim) Train(stopScale etime.Times) {
-	ss.Trainer.EvalMode = etime.Train
-	ss.Trainer.CurEnv = &ss.TrainEnv
-	// Note that Run, Epoch, and Trial are not initialized at zero to allow Train to restart where it left off.
-	for ; ss.Run.Cur < ss.Run.Max; ss.Run.Cur += 1 {
-		ss.loopRun(stopScale) // This might set StopNow to true
-		if stopScale == etime.Run {
-			ss.GUI.StopNow = true
-			ss.Run.Cur += 1
-		}
-		if ss.GUI.StopNow == true {
-			ss.GUI.Stopped()
-			//ss.GUI.UpdateNetView() // TODO is this necessary?
-			// Reset the Stop flag as we leave training.
-			ss.GUI.StopNow = false
-			return
-		}
-	}
-	// Run.Cur will remain at Run.Max
+	ss.Step(etime.Train, stopScale)
+	// Reset the Stop flag as we leave training.
+	ss.GUI.StopNow = false
 	ss.GUI.Stopped()
 	ss.GUI.UpdateNetView()
 }
@@ -243,40 +321,50 @@ func (ss *Sim) SaveWeights(filename gi.FileName) {
 
 // TestItem tests given item which is at given index in test item list
 func (ss *Sim) TestItem(idx int) {
-	ss.Trainer.EvalMode = etime.Test
-	ss.Trainer.CurEnv = &ss.TrainEnv
-	TestEnv := ss.TestEnv
-	cur := TestEnv.Trial().Cur
-	TestEnv.Trial().Cur = idx
+	prv := ss.SetMode(etime.Test)
+	st := ss.CurStack()
+	st.ResetTrial()
+	ss.Time.Cycle, ss.Time.PhaseCycle = 0, 0
+	trl := ss.TestEnv.Trial()
+	cur := trl.Cur
+	trl.Cur = idx
+	if ts, ok := ss.TestEnv.(TrialStarter); ok {
+		ts.StartTrial()
+	}
 	ss.ApplyInputs(ss.TestEnv)
 	ss.ThetaCyc(etime.TimesN)
-	TestEnv.Trial().Cur = cur
+	trl.Cur = cur
+	ss.SetMode(prv)
 }
 
-// TestTrial runs one trial of testing -- always sequentially presented inputs
+// TestTrial runs the next trial of testing -- always sequentially presented inputs
 func (ss *Sim) TestTrial() {
-	ss.Trainer.EvalMode = etime.Test
-	ss.Trainer.CurEnv = &ss.TestEnv
-	// ss.TestEnv.Init(ss.Run.Cur) // TODO Should this happen?
-	ss.LoopTrial(etime.TimesN) // Do one trial. No need to advance Epoch or Run.
+	prv := ss.Trainer.EvalMode
+	ss.Step(etime.Test, etime.Trial)
+	ss.SetMode(prv)
 }
 
 // TestAll runs through the full set of testing items for the current run.
 // If you stop testing in the middle, it will restart from the beginning.
 // This runs across trials and epochs, but not runs.
+// The previous mode is restored at the end, so this can be called during training.
 func (ss *Sim) TestAll() {
-	ss.Trainer.EvalMode = etime.Test
-	ss.Trainer.CurEnv = &ss.TestEnv
+	prv := ss.SetMode(etime.Test)
 	ss.TestEnv.Init(ss.Run.Cur)
-	ss.loopRun(etime.TimesN) // Do a full run of epochs.
+	ss.CurStack().Reset()
+	ss.Time.Cycle, ss.Time.PhaseCycle = 0, 0
+	ss.Step(etime.Test, etime.TimesN) // Do a full run of epochs.
+	ss.SetMode(prv)
 }
 
 // TestEpoch does a single epoch of testing.
 func (ss *Sim) TestEpoch() {
-	ss.Trainer.EvalMode = etime.Test
-	ss.Trainer.CurEnv = &ss.TestEnv
+	prv := ss.SetMode(etime.Test)
 	ss.TestEnv.Init(ss.Run.Cur)
+	ss.CurStack().Reset()
+	ss.Time.Cycle, ss.Time.PhaseCycle = 0, 0
 	ss.LoopEpoch(etime.TimesN) // Do one epoch.
+	ss.SetMode(prv)
 }
 
 // RunTestAll runs through the full set of testing items, has stop running = false at end -- for gui
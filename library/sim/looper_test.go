@@ -0,0 +1,191 @@
+package sim_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etensor"
+)
+
+func TestStepCycle(t *testing.T) {
+	ss := newTestSim()
+	ncyc := cyclesPerTrial(ss)
+	for i := 1; i < ncyc; i++ {
+		ss.Step(etime.Train, etime.Cycle)
+		if ss.Time.Cycle != i || ss.TrainEnv.Trial().Cur != 0 {
+			t.Fatalf("after %d cycle steps: Cycle = %d, Trial = %d", i, ss.Time.Cycle, ss.TrainEnv.Trial().Cur)
+		}
+	}
+	ss.Step(etime.Train, etime.Cycle)
+	if ss.Time.Cycle != 0 || ss.TrainEnv.Trial().Cur != 1 {
+		t.Errorf("last cycle step did not finish the trial: Cycle = %d, Trial = %d", ss.Time.Cycle, ss.TrainEnv.Trial().Cur)
+	}
+	if rows := ss.Logs.Table(etime.Train, etime.Trial).Rows; rows != 1 {
+		t.Errorf("expected 1 train trial log row, got %d", rows)
+	}
+}
+
+func TestStepTrial(t *testing.T) {
+	ss := newTestSim()
+	ntrl := ss.TrainEnv.Trial().Max
+	for i := 1; i < ntrl; i++ {
+		ss.Step(etime.Train, etime.Trial)
+		if ss.TrainEnv.Trial().Cur != i || ss.TrainEnv.Epoch().Cur != 0 || ss.Time.Cycle != 0 {
+			t.Fatalf("after %d trial steps: Trial = %d, Epoch = %d, Cycle = %d", i, ss.TrainEnv.Trial().Cur, ss.TrainEnv.Epoch().Cur, ss.Time.Cycle)
+		}
+	}
+	ss.Step(etime.Train, etime.Trial)
+	if ss.TrainEnv.Trial().Cur != 0 || ss.TrainEnv.Epoch().Cur != 1 {
+		t.Errorf("last trial step did not finish the epoch: Trial = %d, Epoch = %d", ss.TrainEnv.Trial().Cur, ss.TrainEnv.Epoch().Cur)
+	}
+	if rows := ss.Logs.Table(etime.Train, etime.Epoch).Rows; rows != 1 {
+		t.Errorf("expected 1 train epoch log row, got %d", rows)
+	}
+}
+
+func TestStepEpoch(t *testing.T) {
+	ss := newTestSim()
+	nepc := ss.TrainEnv.Epoch().Max
+	for i := 1; i < nepc; i++ {
+		ss.Step(etime.Train, etime.Epoch)
+		if ss.TrainEnv.Epoch().Cur != i || ss.TrainEnv.Trial().Cur != 0 || ss.Run.Cur != 0 {
+			t.Fatalf("after %d epoch steps: Epoch = %d, Trial = %d, Run = %d", i, ss.TrainEnv.Epoch().Cur, ss.TrainEnv.Trial().Cur, ss.Run.Cur)
+		}
+	}
+	ss.Step(etime.Train, etime.Epoch)
+	if ss.TrainEnv.Epoch().Cur != 0 || ss.Run.Cur != 1 {
+		t.Errorf("last epoch step did not finish the run: Epoch = %d, Run = %d", ss.TrainEnv.Epoch().Cur, ss.Run.Cur)
+	}
+	if rows := ss.Logs.Table(etime.Train, etime.Run).Rows; rows != 1 {
+		t.Errorf("expected 1 train run log row, got %d", rows)
+	}
+}
+
+func TestTestDuringTrain(t *testing.T) {
+	ss := newTestSim()
+	ss.Step(etime.Train, etime.Trial)
+	for i := 0; i < 50; i++ {
+		ss.Step(etime.Train, etime.Cycle)
+	}
+	out := ss.Net.LayerByName("Output").(axon.AxonLayer).AsAxon()
+	vm := out.Neurons[0].Vm
+
+	ss.TestTrial()
+	if ss.TestEnv.Trial().Cur != 1 {
+		t.Errorf("TestTrial did not advance the test trial: %d", ss.TestEnv.Trial().Cur)
+	}
+	ss.TestAll()
+	if ss.Trainer.EvalMode != etime.Train {
+		t.Errorf("testing did not restore the Train mode")
+	}
+	if ss.Time.Cycle != 50 || ss.TrainEnv.Trial().Cur != 1 || ss.TrainEnv.Epoch().Cur != 0 {
+		t.Errorf("testing disturbed training: Cycle = %d, Trial = %d, Epoch = %d", ss.Time.Cycle, ss.TrainEnv.Trial().Cur, ss.TrainEnv.Epoch().Cur)
+	}
+	if out.Neurons[0].Vm != vm {
+		t.Errorf("testing did not restore the network state")
+	}
+
+	ss.Step(etime.Train, etime.Trial)
+	if ss.Time.Cycle != 0 || ss.TrainEnv.Trial().Cur != 2 {
+		t.Errorf("training did not continue after testing: Cycle = %d, Trial = %d", ss.Time.Cycle, ss.TrainEnv.Trial().Cur)
+	}
+	if rows := ss.Logs.Table(etime.Train, etime.Trial).Rows; rows != 2 {
+		t.Errorf("expected 2 train trial log rows, got %d", rows)
+	}
+}
+
+// actionEnv records the actions that are sent to it, and the steps after them,
+// and then has an Input of all 1s.
+type actionEnv struct {
+	*sim.TableEnv
+	acts  map[string]etensor.Tensor
+	plus  []bool
+	steps int
+	time  *axon.Time
+}
+
+func (ae *actionEnv) Action(layerName string, act etensor.Tensor) {
+	ae.acts[layerName] = act
+	ae.plus = append(ae.plus, ae.time.PlusPhase)
+}
+
+func (ae *actionEnv) Step() { ae.steps++ }
+
+func (ae *actionEnv) State(layerName string) etensor.Tensor {
+	st := ae.TableEnv.State(layerName)
+	if ae.steps == 0 || layerName != "Input" {
+		return st
+	}
+	ones := etensor.NewFloat32(st.Shapes(), nil, nil)
+	for i := range ones.Values {
+		ones.Values[i] = 1
+	}
+	return ones
+}
+
+func TestSendAction(t *testing.T) {
+	ss := newTestSim()
+	ae := &actionEnv{TableEnv: ss.TrainEnv.(*sim.TableEnv), acts: map[string]etensor.Tensor{}, time: &ss.Time}
+	ss.TrainEnv = ae
+	for i := range ss.Trainer.Phases {
+		ss.Trainer.Phases[i].SendAction = ss.Trainer.Phases[i].Name == "Plus"
+	}
+	ss.Step(etime.Train, etime.Trial)
+
+	if len(ae.plus) != 1 || ae.plus[0] {
+		t.Fatalf("expected one action, before the plus phase, got: %v", ae.plus)
+	}
+	if len(ae.acts) != 1 || ae.acts["Output"] == nil {
+		t.Fatalf("expected an action for just the Output layer, got: %v", ae.acts)
+	}
+	ly := ss.Net.LayerByName("Output").(axon.AxonLayer).AsAxon()
+	if ae.acts["Output"].Len() != len(ly.Neurons) {
+		t.Errorf("action has %d values for %d neurons", ae.acts["Output"].Len(), len(ly.Neurons))
+	}
+	if ae.steps != 1 || ss.TrainEnv.Trial().Cur != 1 {
+		t.Fatalf("expected the env to be stepped once after the action, without changing the trial, got %d steps, trial %d", ae.steps, ss.TrainEnv.Trial().Cur)
+	}
+	in := ss.Net.LayerByName("Input").(axon.AxonLayer).AsAxon()
+	for ni := range in.Neurons {
+		if in.Neurons[ni].Ext != 1 {
+			t.Fatalf("the Input after the step was not applied: Ext of neuron %d is %g", ni, in.Neurons[ni].Ext)
+		}
+	}
+}
+
+// seqEnv has sequences of two trials of its table.
+type seqEnv struct {
+	*sim.TableEnv
+}
+
+func (se *seqEnv) SeqStart() bool { return se.Trial().Cur%2 == 0 }
+func (se *seqEnv) SeqEnd() bool   { return se.Trial().Cur%2 == 1 }
+
+func TestSequenceEvents(t *testing.T) {
+	ss := newTestSim()
+	ss.TrainEnv = &seqEnv{ss.TrainEnv.(*sim.TableEnv)}
+	in := ss.Net.LayerByName("Input").(axon.AxonLayer).AsAxon()
+	var starts, ends []int
+	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, sim.TrainingCallbacks{
+		Name: "Sequence",
+		OnSeqStart: func() {
+			starts = append(starts, ss.TrainEnv.Trial().Cur)
+			ext := float32(0)
+			for ni := range in.Neurons {
+				ext += in.Neurons[ni].Ext
+			}
+			if ext == 0 {
+				t.Errorf("trial %d: the Input was cleared at the start of the sequence", ss.TrainEnv.Trial().Cur)
+			}
+		},
+		OnSeqEnd: func() { ends = append(ends, ss.TrainEnv.Trial().Cur) },
+	})
+	ss.Step(etime.Train, etime.Epoch)
+
+	if fmt.Sprint(starts) != "[0 2 4]" || fmt.Sprint(ends) != "[1 3 5]" {
+		t.Errorf("sequences start at trials %v and end at %v, not [0 2 4] and [1 3 5]", starts, ends)
+	}
+}
@@ -0,0 +1,160 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/emer/etable/etable"
+)
+
+// LrateSchedule computes the schedule-based learning rate multiplier for each
+// training epoch, which is applied to the network with Net.LrateSched.
+// It can be configured with a "LrateSched" sheet in the params, or with the
+// -lrsched command line flag, e.g., -lrsched "cosine:MaxEpochs=200,Min=0.05"
+type LrateSchedule struct {
+	Policy    string  `desc:"schedule policy: step, exp, cosine, warmup, plateau, or none to keep the multiplier at 1"`
+	Factor    float32 `def:"0.5" desc:"[step, plateau] multiplier applied at each drop"`
+	StepStart int     `def:"40" desc:"[step] the first drop takes effect after this epoch"`
+	StepEvery int     `desc:"[step] if > 0, drop again every this many epochs after StepStart"`
+	Gamma     float32 `def:"0.98" desc:"[exp] multiplier applied every epoch"`
+	MaxEpochs int     `desc:"[cosine] number of epochs over which to anneal from 1 down to Min"`
+	Min       float32 `desc:"[cosine, plateau] lowest multiplier the schedule goes down to"`
+	Warmup    int     `desc:"number of initial epochs over which the multiplier ramps up linearly -- applies on top of any policy, and is the whole schedule for warmup"`
+	Stat      string  `def:"UnitErr" desc:"[plateau] train epoch log column to monitor -- lower is better"`
+	Patience  int     `def:"10" desc:"[plateau] number of epochs without improvement in Stat before dropping"`
+	Thresh    float64 `def:"0.001" desc:"[plateau] minimum decrease in Stat that counts as an improvement"`
+
+	Mult  float32 `inactive:"+" desc:"current learning rate multiplier"`
+	Best  float64 `inactive:"+" desc:"[plateau] best value of Stat so far"`
+	Wait  int     `inactive:"+" desc:"[plateau] number of epochs since Best last improved"`
+	Drops int     `inactive:"+" desc:"[plateau] number of drops so far"`
+}
+
+func (ls *LrateSchedule) Defaults() {
+	ls.Policy = "step"
+	ls.Factor = 0.5
+	ls.StepStart = 40
+	ls.Gamma = 0.98
+	ls.Stat = "UnitErr"
+	ls.Patience = 10
+	ls.Thresh = 0.001
+	ls.Reset()
+}
+
+// Reset resets the state at the start of a new run.
+func (ls *LrateSchedule) Reset() {
+	ls.Best = math.MaxFloat64
+	ls.Wait = 0
+	ls.Drops = 0
+	ls.Mult = ls.Warmed(0, 1)
+}
+
+// Warmed applies the Warmup ramp for given epoch to multiplier mult.
+func (ls *LrateSchedule) Warmed(epc int, mult float32) float32 {
+	if ls.Warmup > 0 && epc < ls.Warmup {
+		return mult * float32(epc+1) / float32(ls.Warmup)
+	}
+	return mult
+}
+
+// lratePolicies are the valid values of LrateSchedule.Policy.
+var lratePolicies = []string{"step", "exp", "cosine", "warmup", "plateau", "none"}
+
+// Validate checks that the Policy is known, and for plateau, that Stat is a
+// column of dt, the train epoch log.
+func (ls *LrateSchedule) Validate(dt *etable.Table) error {
+	known := false
+	for _, p := range lratePolicies {
+		known = known || ls.Policy == p
+	}
+	if !known {
+		return fmt.Errorf("LrateSchedule: unknown policy %q, not one of %v", ls.Policy, lratePolicies)
+	}
+	if ls.Policy == "plateau" && dt != nil {
+		if _, err := dt.ColByNameTry(ls.Stat); err != nil {
+			return fmt.Errorf("LrateSchedule: the Stat of the plateau policy: %v", err)
+		}
+	}
+	return nil
+}
+
+// Epoch returns the multiplier in effect for the given training epoch, to be
+// called at the start of the epoch. stat is the value of Stat for the previous
+// epoch, which is only used for the plateau policy, for which it is an error if
+// it is NaN, e.g., because there is no such column in the log -- the multiplier
+// then stays the same. The state is reset at epoch 0.
+func (ls *LrateSchedule) Epoch(epc int, stat float64) (float32, error) {
+	if epc == 0 {
+		ls.Reset()
+		return ls.Mult, nil
+	}
+	mult := float32(1)
+	switch ls.Policy {
+	case "step":
+		if epc > ls.StepStart {
+			ndrop := 1
+			if ls.StepEvery > 0 {
+				ndrop += (epc - 1 - ls.StepStart) / ls.StepEvery
+			}
+			mult = float32(math.Pow(float64(ls.Factor), float64(ndrop)))
+		}
+	case "exp":
+		mult = float32(math.Pow(float64(ls.Gamma), float64(epc)))
+	case "cosine":
+		if ls.MaxEpochs > 0 {
+			pct := math.Min(float64(epc)/float64(ls.MaxEpochs), 1)
+			mult = ls.Min + (1-ls.Min)*float32(0.5*(1+math.Cos(math.Pi*pct)))
+		}
+	case "plateau":
+		if math.IsNaN(stat) {
+			return ls.Mult, fmt.Errorf("LrateSchedule: the plateau Stat %s is NaN at epoch %d", ls.Stat, epc)
+		}
+		if stat < ls.Best-ls.Thresh {
+			ls.Best = stat
+			ls.Wait = 0
+		} else {
+			ls.Wait++
+			if ls.Wait >= ls.Patience {
+				ls.Drops++
+				ls.Wait = 0
+			}
+		}
+		mult = float32(math.Pow(float64(ls.Factor), float64(ls.Drops)))
+		if mult < ls.Min {
+			mult = ls.Min
+		}
+	}
+	ls.Mult = ls.Warmed(epc, mult)
+	return ls.Mult, nil
+}
+
+// SetFromString configures the schedule from a policy name optionally followed by
+// a colon and comma-separated Field=Value settings, e.g., "step:StepStart=20,Factor=0.2"
+func (ls *LrateSchedule) SetFromString(spec string) error {
+	ps := strings.SplitN(spec, ":", 2)
+	ls.Policy = strings.TrimSpace(ps[0])
+	if len(ps) == 2 {
+		if err := parseSpec(ps[1], ls); err != nil {
+			return fmt.Errorf("LrateSchedule: %v", err)
+		}
+	}
+	return ls.Validate(nil)
+}
+
+// CheckpointSaver returns a saver that stores the schedule in checkpoints.
+func (ls *LrateSchedule) CheckpointSaver() CheckpointSaver {
+	return CheckpointSaver{
+		Name: "LrateSched",
+		Save: func() ([]byte, error) { return json.Marshal(ls) },
+		Load: func(b []byte) error { return json.Unmarshal(b, ls) },
+	}
+}
+
+// Styler interface, so the schedule can be set from a "LrateSched" params sheet
+// with Sel "LrateSched" and params paths like "LrateSched.Policy".
+
+func (ls *LrateSchedule) TypeName() string { return "LrateSched" }
+func (ls *LrateSchedule) Class() string    { return "" }
+func (ls *LrateSchedule) Name() string     { return "LrateSched" }
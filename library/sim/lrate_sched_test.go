@@ -0,0 +1,85 @@
+package sim_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/etime"
+)
+
+// multsOf returns the multipliers of ls for epochs 0 to n-1, with stat as the
+// value of its Stat in each epoch.
+func multsOf(t *testing.T, ls *sim.LrateSchedule, n int, stat func(epc int) float64) []float32 {
+	mults := make([]float32, n)
+	for epc := 0; epc < n; epc++ {
+		m, err := ls.Epoch(epc, stat(epc))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mults[epc] = m
+	}
+	return mults
+}
+
+func TestLrateSchedule(t *testing.T) {
+	flat := func(epc int) float64 { return 1 }
+	cases := []struct {
+		spec string
+		want []float32
+	}{
+		{"none", []float32{1, 1, 1, 1, 1}},
+		{"step:StepStart=1,StepEvery=2,Factor=0.5", []float32{1, 1, 0.5, 0.5, 0.25}},
+		{"exp:Gamma=0.5", []float32{1, 0.5, 0.25, 0.125, 0.0625}},
+		{"cosine:MaxEpochs=2,Min=0.2", []float32{1, 0.6, 0.2, 0.2, 0.2}},
+		{"warmup:Warmup=4", []float32{0.25, 0.5, 0.75, 1, 1}},
+		{"plateau:Patience=2,Factor=0.5,Min=0.3", []float32{1, 1, 1, 0.5, 0.5}},
+	}
+	for _, c := range cases {
+		ls := &sim.LrateSchedule{}
+		ls.Defaults()
+		if err := ls.SetFromString(c.spec); err != nil {
+			t.Fatal(err)
+		}
+		got := multsOf(t, ls, len(c.want), flat)
+		for i := range got {
+			if math.Abs(float64(got[i]-c.want[i])) > 1e-6 {
+				t.Errorf("%s: multipliers %v, not %v", c.spec, got, c.want)
+				break
+			}
+		}
+	}
+
+	// plateau only drops while the stat does not improve, down to Min
+	ls := &sim.LrateSchedule{}
+	ls.Defaults()
+	ls.SetFromString("plateau:Patience=1,Factor=0.5,Min=0.3")
+	got := multsOf(t, ls, 5, func(epc int) float64 { return []float64{5, 4, 3, 3, 3}[epc] })
+	if want := []float32{1, 1, 1, 0.5, 0.3}; got[3] != want[3] || got[4] != want[4] || got[2] != 1 {
+		t.Errorf("plateau multipliers %v, not %v", got, want)
+	}
+	if _, err := ls.Epoch(5, math.NaN()); err == nil || ls.Mult != 0.3 {
+		t.Errorf("expected an error for a NaN plateau Stat, without a drop")
+	}
+
+	for _, spec := range []string{"cosin", "step:Nope=1", "exp:Gamma"} {
+		if err := (&sim.LrateSchedule{}).SetFromString(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+}
+
+func TestLrateSchedValidate(t *testing.T) {
+	ss := newTestSim()
+	dt := ss.Logs.Table(etime.Train, etime.Epoch)
+	ls := &sim.LrateSchedule{}
+	ls.Defaults()
+	ls.SetFromString("plateau:Stat=PctErr")
+	if err := ls.Validate(dt); err != nil {
+		t.Error(err)
+	}
+	ls.Stat = "NoSuchStat"
+	if err := ls.Validate(dt); err == nil {
+		t.Errorf("expected an error for a plateau Stat that is not in the log")
+	}
+}
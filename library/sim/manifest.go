@@ -0,0 +1,195 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/elog"
+	"github.com/emer/emergent/params"
+)
+
+// Manifest records how the runs of a program were done, so their results can
+// be traced back to it: the code, the command line, the params, the seeds, and
+// the files that were written. RunFromArgs writes it as JSON next to the logs,
+// when the runs start, and again when they are done. GuiRun writes it when the
+// Sim is initialized, and at the end of every run.
+type Manifest struct {
+	Program   string                     `desc:"path of the program"`
+	Args      []string                   `desc:"command line args"`
+	Dir       string                     `desc:"working directory"`
+	Commit    string                     `desc:"git commit of the model code"`
+	Modified  bool                       `desc:"whether the code had uncommitted changes"`
+	Note      string                     `desc:"the -note of the runs"`
+	RunName   string                     `desc:"name of the runs, as in the file names"`
+	ParamSets []*params.Set              `desc:"the param sets that are applied, in order: Base, then the ExtraSets"`
+	Applied   map[string]json.RawMessage `desc:"the params of each layer and projection of the network, and of the other objects of the param sets, by name, as they were after the sets were applied"`
+	StartRun  int                        `desc:"first run"`
+	Seeds     []int64                    `desc:"random seeds of the runs, from StartRun on"`
+	Host      string                     `desc:"host name"`
+	Start     time.Time                  `desc:"when the runs started"`
+	End       time.Time                  `desc:"when the runs were done -- zero until then"`
+	GoVersion string                     `desc:"version of Go the program was built with"`
+	Modules   map[string]string          `desc:"versions of the emer modules the program was built with"`
+	Files     []string                   `desc:"log, weight and checkpoint files written by the runs"`
+
+	mu sync.Mutex
+}
+
+// NewManifest returns a manifest for the runs that ss is configured to do.
+func NewManifest(ss *Sim) *Manifest {
+	mf := &Manifest{Args: os.Args[1:], Note: ss.CmdArgs.note, RunName: ss.RunName(), StartRun: ss.CmdArgs.StartRun,
+		Start: time.Now(), GoVersion: runtime.Version(), Modules: map[string]string{}}
+	mf.Program, _ = os.Executable()
+	mf.Dir, _ = os.Getwd()
+	mf.Host, _ = os.Hostname()
+	for _, nm := range append([]string{"Base"}, strings.Fields(ss.Params.ExtraSets)...) {
+		if pset, err := ss.Params.Params.SetByNameTry(nm); err == nil {
+			mf.ParamSets = append(mf.ParamSets, pset)
+		}
+	}
+	if st, n := ss.CmdArgs.StartRun, ss.CmdArgs.MaxRuns; st+n <= len(ss.CmdArgs.RndSeeds) {
+		mf.Seeds = ss.CmdArgs.RndSeeds[st : st+n]
+	}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, dep := range bi.Deps {
+			if strings.HasPrefix(dep.Path, "github.com/emer/") {
+				mf.Modules[dep.Path] = dep.Version
+			}
+		}
+		for _, bs := range bi.Settings {
+			switch bs.Key {
+			case "vcs.revision":
+				mf.Commit = bs.Value
+			case "vcs.modified":
+				mf.Modified = bs.Value == "true"
+			}
+		}
+	}
+	if mf.Commit == "" { // not stamped by go build, e.g., with go run or go test
+		if out, err := exec.Command("git", "rev-parse", "HEAD").Output(); err == nil {
+			mf.Commit = strings.TrimSpace(string(out))
+			out, err = exec.Command("git", "status", "--porcelain", "--untracked-files=no").Output()
+			mf.Modified = err == nil && len(out) > 0
+		}
+	}
+	return mf
+}
+
+// RecordParams records the params of the network of ss, and of the other
+// objects that the param sets apply to, as they are now, in Applied.
+// Init calls it after applying the param sets.
+func (mf *Manifest) RecordParams(ss *Sim) {
+	if mf == nil {
+		return
+	}
+	applied := map[string]json.RawMessage{}
+	add := func(nm string, obj interface{}) {
+		if b, err := json.Marshal(obj); err == nil {
+			applied[nm] = b
+		}
+	}
+	for _, li := range ss.Net.Layers {
+		ly := li.(axon.AxonLayer).AsAxon()
+		add("Layer "+ly.Nm, map[string]interface{}{"Act": &ly.Act, "Inhib": &ly.Inhib, "Learn": &ly.Learn})
+		for _, pi := range ly.RcvPrjns {
+			pj := pi.(axon.AxonPrjn).AsAxon()
+			add("Prjn "+pj.Name(), map[string]interface{}{"Com": &pj.Com, "PrjnScale": &pj.PrjnScale, "SWt": &pj.SWt, "Learn": &pj.Learn})
+		}
+	}
+	for nm, obj := range ss.Params.Objects {
+		if nm == "Network" || nm == "Sim" { // the network is above, and the Sim is much more than its params
+			continue
+		}
+		add(nm, obj)
+	}
+	mf.mu.Lock()
+	mf.Applied = applied
+	mf.mu.Unlock()
+}
+
+// AddFile records a file written by the runs, once.
+func (mf *Manifest) AddFile(fnm string) {
+	if mf == nil {
+		return
+	}
+	mf.mu.Lock()
+	defer mf.mu.Unlock()
+	for _, f := range mf.Files {
+		if f == fnm {
+			return
+		}
+	}
+	mf.Files = append(mf.Files, fnm)
+}
+
+// Save writes the manifest to the given JSON file.
+func (mf *Manifest) Save(fnm string) error {
+	mf.mu.Lock()
+	b, err := json.MarshalIndent(mf, "", "  ")
+	mf.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fnm, b, 0644)
+}
+
+// OpenManifest reads a manifest written by Save.
+func OpenManifest(fnm string) (*Manifest, error) {
+	b, err := ioutil.ReadFile(fnm)
+	if err != nil {
+		return nil, err
+	}
+	mf := &Manifest{}
+	if err := json.Unmarshal(b, mf); err != nil {
+		return nil, fmt.Errorf("OpenManifest %s: %w", fnm, err)
+	}
+	return mf, nil
+}
+
+// ManifestFileName returns the name of the manifest file, in the log directory.
+func (ss *Sim) ManifestFileName() string {
+	return filepath.Join(elog.LogDir, strings.TrimSuffix(ss.LogFileName("manifest"), ".tsv")+".json")
+}
+
+// saveManifest writes ss.Manifest, if there is one.
+func (ss *Sim) saveManifest() {
+	if ss.Manifest == nil {
+		return
+	}
+	if elog.LogDir != "" {
+		os.MkdirAll(elog.LogDir, 0755)
+	}
+	if err := ss.Manifest.Save(ss.ManifestFileName()); err != nil {
+		fmt.Println(err)
+	}
+}
+
+// addLogFiles records the files of all the open logs in the manifest.
+func (ss *Sim) addLogFiles() {
+	if ss.Manifest == nil {
+		return
+	}
+	for _, lt := range ss.Logs.Tables {
+		if lt.File != nil {
+			ss.Manifest.AddFile(lt.File.Name())
+		}
+	}
+	for _, al := range ss.ArrowLogs {
+		ss.Manifest.AddFile(al.File.Name())
+	}
+	for _, cr := range []*CycleRecorder{ss.RasterRecs, ss.CycleLogRecs} {
+		if cr != nil {
+			ss.Manifest.AddFile(cr.File)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package sim_test
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/etime"
+)
+
+func TestManifest(t *testing.T) {
+	ss := newTestSim()
+	ss.Manifest = sim.NewManifest(ss)
+	ss.Init() // records the applied params
+	afnm := filepath.Join(t.TempDir(), "testtrial.arrow")
+	if err := ss.SetArrowLog(etime.Scope(etime.Test, etime.Trial), afnm); err != nil {
+		t.Fatal(err)
+	}
+	ss.TestEpoch()
+	ss.CloseLogFiles()
+	ss.Manifest.End = time.Now()
+
+	mfnm := filepath.Join(t.TempDir(), "manifest.json")
+	if err := ss.Manifest.Save(mfnm); err != nil {
+		t.Fatal(err)
+	}
+	mf, err := sim.OpenManifest(mfnm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mf.Seeds) != 2 || mf.Seeds[1] != 2 {
+		t.Errorf("expected the seeds of the 2 runs, got %v", mf.Seeds)
+	}
+	if len(mf.ParamSets) == 0 || mf.ParamSets[0].Name != "Base" || mf.ParamSets[0].Sheets["Network"] == nil {
+		t.Errorf("expected the Base param set")
+	}
+	var in struct {
+		Inhib struct{ Layer struct{ Gi float32 } }
+	}
+	if err := json.Unmarshal(mf.Applied["Layer Input"], &in); err != nil || in.Inhib.Layer.Gi != 0.9 {
+		t.Errorf("expected the applied Inhib.Layer.Gi of the Input, 0.9, got %g (%v)", in.Inhib.Layer.Gi, err)
+	}
+	if mf.Applied["Prjn InputToHidden1"] == nil {
+		t.Errorf("expected the applied params of the projections, got %d entries", len(mf.Applied))
+	}
+	if len(mf.Files) != 1 || mf.Files[0] != afnm {
+		t.Errorf("expected the Arrow log in the files, got %v", mf.Files)
+	}
+	if mf.GoVersion == "" || mf.Modules["github.com/emer/axon"] == "" || mf.End.Before(mf.Start) {
+		t.Errorf("manifest is missing the versions or times: %+v", mf)
+	}
+}
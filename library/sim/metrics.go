@@ -0,0 +1,220 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// MetricsServer serves the progress of a run over HTTP, for monitoring runs
+// without the GUI. It has two endpoints:
+//   - /events streams every row that is logged with Sim.Log, as Server-Sent
+//     Events, named by the Mode:Time of the log (e.g., Train:Epoch), with the
+//     row as a JSON object. It can be limited to some logs with the logs query
+//     parameter, e.g., /events?logs=Train:Epoch,Test:Epoch
+//   - /metrics has the current Floats and Ints of the Stats, as Prometheus
+//     gauges named sim_<stat>, with the run as a label.
+//
+// Cycle logs are not streamed, as there are too many rows.
+type MetricsServer struct {
+	Addr string `desc:"address the server is listening on, e.g., localhost:9090"`
+
+	srv     *http.Server
+	mu      sync.Mutex
+	clients map[*metricsClient]struct{}
+	stats   map[int]map[string]float64 // current stats, by run
+	done    chan struct{}
+}
+
+// metricsClient is one client of /events.
+type metricsClient struct {
+	scopes map[etime.ScopeKey]bool // logs to send, all if nil
+	events chan []byte
+}
+
+// StartMetricsServer starts serving metrics at given address, e.g.,
+// localhost:9090, or :0 for any free port.
+func StartMetricsServer(addr string) (*MetricsServer, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("StartMetricsServer: %v", err)
+	}
+	ms := &MetricsServer{Addr: ln.Addr().String(), clients: make(map[*metricsClient]struct{}), stats: make(map[int]map[string]float64), done: make(chan struct{})}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/events", ms.serveEvents)
+	mux.HandleFunc("/metrics", ms.serveMetrics)
+	ms.srv = &http.Server{Handler: mux}
+	go ms.srv.Serve(ln)
+	fmt.Printf("Serving metrics at: http://%s/metrics and http://%s/events\n", ms.Addr, ms.Addr)
+	return ms, nil
+}
+
+// Close ends the streams of all the clients and stops the server.
+func (ms *MetricsServer) Close() error {
+	close(ms.done)
+	return ms.srv.Close()
+}
+
+func (ms *MetricsServer) serveEvents(w http.ResponseWriter, r *http.Request) {
+	fl, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	cl := &metricsClient{events: make(chan []byte, 256)}
+	if logs := r.URL.Query().Get("logs"); logs != "" {
+		sks, err := ParseLogScopes(logs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		cl.scopes = make(map[etime.ScopeKey]bool)
+		for _, sk := range sks {
+			cl.scopes[sk] = true
+		}
+	}
+	ms.mu.Lock()
+	ms.clients[cl] = struct{}{}
+	ms.mu.Unlock()
+	defer func() {
+		ms.mu.Lock()
+		delete(ms.clients, cl)
+		ms.mu.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	fl.Flush()
+	for {
+		select {
+		case ev := <-cl.events:
+			if _, err := w.Write(ev); err != nil {
+				return
+			}
+			fl.Flush()
+		case <-r.Context().Done():
+			return
+		case <-ms.done:
+			return
+		}
+	}
+}
+
+func (ms *MetricsServer) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	names := map[string]bool{}
+	var runs []int
+	for run, vals := range ms.stats {
+		runs = append(runs, run)
+		for nm := range vals {
+			names[nm] = true
+		}
+	}
+	sort.Ints(runs)
+	snms := make([]string, 0, len(names))
+	for nm := range names {
+		snms = append(snms, nm)
+	}
+	sort.Strings(snms)
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	var b bytes.Buffer
+	for _, nm := range snms {
+		mnm := "sim_" + promNameRe.ReplaceAllString(nm, "_")
+		fmt.Fprintf(&b, "# TYPE %s gauge\n", mnm)
+		for _, run := range runs {
+			if val, has := ms.stats[run][nm]; has {
+				fmt.Fprintf(&b, "%s{run=\"%d\"} %s\n", mnm, run, strconv.FormatFloat(val, 'g', -1, 64))
+			}
+		}
+	}
+	w.Write(b.Bytes())
+}
+
+// promNameRe matches the characters that are not allowed in Prometheus metric names.
+var promNameRe = regexp.MustCompile(`[^a-zA-Z0-9_:]`)
+
+// Publish records the current stats of ss, and sends given row of the log for
+// mode, time to the clients of /events. It is called by Sim.Log.
+func (ms *MetricsServer) Publish(ss *Sim, mode etime.Modes, time etime.Times, row int) {
+	if time == etime.Cycle {
+		return
+	}
+	vals := make(map[string]float64, len(ss.Stats.Floats)+len(ss.Stats.Ints))
+	for nm, v := range ss.Stats.Floats {
+		vals[nm] = v
+	}
+	for nm, v := range ss.Stats.Ints {
+		vals[nm] = float64(v)
+	}
+
+	sk := etime.Scope(mode, time)
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+	ms.stats[ss.Run.Cur] = vals
+	var ev []byte
+	for cl := range ms.clients {
+		if cl.scopes != nil && !cl.scopes[sk] {
+			continue
+		}
+		if ev == nil {
+			ev = []byte(fmt.Sprintf("event: %s:%s\ndata: %s\n\n", mode, time, rowJSON(ss.Logs.Table(mode, time), row)))
+		}
+		select {
+		case cl.events <- ev:
+		default: // a slow client misses events, rather than holding up the run
+		}
+	}
+}
+
+// rowJSON returns given row of dt as a JSON object, in the order of the
+// columns, with the values of tensor columns as lists. NaN and Inf are null.
+func rowJSON(dt *etable.Table, row int) []byte {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for ci, col := range dt.Cols {
+		if ci > 0 {
+			b.WriteByte(',')
+		}
+		nm, _ := json.Marshal(dt.ColNames[ci])
+		b.Write(nm)
+		b.WriteByte(':')
+		csz := cellSize(col)
+		if col.NumDims() > 1 {
+			b.WriteByte('[')
+		}
+		for i := row * csz; i < (row+1)*csz; i++ {
+			if i > row*csz {
+				b.WriteByte(',')
+			}
+			if col.DataType() == etensor.STRING {
+				s, _ := json.Marshal(col.StringVal1D(i))
+				b.Write(s)
+				continue
+			}
+			v := col.FloatVal1D(i)
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				b.WriteString("null")
+			} else {
+				b.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+			}
+		}
+		if col.NumDims() > 1 {
+			b.WriteByte(']')
+		}
+	}
+	b.WriteByte('}')
+	return b.Bytes()
+}
@@ -0,0 +1,54 @@
+package sim_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/etime"
+)
+
+func TestMetricsServer(t *testing.T) {
+	ss := newTestSim()
+	ms, err := sim.StartMetricsServer("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ms.Close()
+	ss.Metrics = ms
+
+	resp, err := http.Get("http://" + ms.Addr + "/events?logs=Train:Epoch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	ss.Step(etime.Train, etime.Epoch)
+
+	rdr := bufio.NewReader(resp.Body)
+	event, _ := rdr.ReadString('\n')
+	data, _ := rdr.ReadString('\n')
+	if event != "event: Train:Epoch\n" || !strings.HasPrefix(data, "data: ") {
+		t.Fatalf("unexpected event: %q %q", event, data)
+	}
+	row := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(data, "data: ")), &row); err != nil {
+		t.Fatal(err)
+	}
+	if row["Epoch"] != 0.0 || row["UnitErr"] == nil {
+		t.Errorf("unexpected epoch row: %v", row)
+	}
+
+	mresp, err := http.Get("http://" + ms.Addr + "/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer mresp.Body.Close()
+	b, _ := ioutil.ReadAll(mresp.Body)
+	if !strings.Contains(string(b), "# TYPE sim_TrlErr gauge\nsim_TrlErr{run=\"0\"} ") {
+		t.Errorf("TrlErr is not in the metrics:\n%s", b)
+	}
+}
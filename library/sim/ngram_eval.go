@@ -0,0 +1,180 @@
+package sim
+
+import (
+	"math"
+	"strings"
+
+	"github.com/emer/axon/axon"
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/metric"
+)
+
+// NGramEval compares the predictions of the next word by the network, on the
+// test trials of a CorpusEnv, to those of a count-based n-gram model made from
+// the NGramCounts of the training CorpusEnv, as a baseline -- so, like the
+// network, it is evaluated on the held-out test corpus it was not trained on. The network's prediction is a distribution
+// over the words of the env, from the similarity of the activity of the Layer
+// to the WordReps of each word. The n-gram prediction is the smoothed count of
+// each word after the CurWords, interpolated with the unigram frequency. For
+// each, the cross-entropy (in nats) of the CurNextWord is logged at Test Trial,
+// and its mean, the perplexity, and the proportion of trials with the target
+// in the TopK words, at Test Epoch.
+type NGramEval struct {
+	Layer  string  `desc:"layer whose ActM is the prediction of the network -- Output if empty"`
+	AddK   float64 `def:"0.1" desc:"add-k smoothing of the n-gram counts of each context"`
+	Lambda float64 `def:"0.8" desc:"weight of the smoothed n-gram probability, which is interpolated with the unigram probability with the rest"`
+	Temp   float64 `def:"0.1" desc:"temperature of the softmax over the cosine similarity of the activity to the WordReps of each word, which is the network's distribution"`
+	TopK   int     `def:"5" desc:"a prediction is correct if the target is one of the TopK most probable words"`
+
+	N         int     `inactive:"+" desc:"number of test trials so far in the epoch"`
+	NetCE     float64 `inactive:"+" desc:"sum of the cross-entropy of the network's predictions so far in the epoch"`
+	NGramCE   float64 `inactive:"+" desc:"sum of the cross-entropy of the n-gram predictions so far in the epoch"`
+	NetTopK   float64 `inactive:"+" desc:"number of the network's predictions with the target in the TopK so far in the epoch"`
+	NGramTopK float64 `inactive:"+" desc:"number of the n-gram predictions with the target in the TopK so far in the epoch"`
+}
+
+// Defaults sets default values.
+func (ne *NGramEval) Defaults() {
+	ne.Layer = "Output"
+	ne.AddK = 0.1
+	ne.Lambda = 0.8
+	ne.Temp = 0.1
+	ne.TopK = 5
+}
+
+// Reset resets the sums at the start of a test epoch.
+func (ne *NGramEval) Reset() {
+	ne.N = 0
+	ne.NetCE, ne.NGramCE = 0, 0
+	ne.NetTopK, ne.NGramTopK = 0, 0
+}
+
+// NGramDist returns the probability of each of the Words of the env after the
+// given context words, of which the last NContext are used.
+func (ne *NGramEval) NGramDist(ev *CorpusEnv, context []string) []float64 {
+	nw := len(ev.Words)
+	if len(context) > ev.NContext {
+		context = context[len(context)-ev.NContext:]
+	}
+	counts := ev.NGramCounts[strings.Join(context, " ")]
+	tot := 0.0
+	for _, n := range counts {
+		tot += n
+	}
+	utot := 0.0
+	for _, w := range ev.Words {
+		utot += ev.FreqMap[w]
+	}
+	dist := make([]float64, nw)
+	for i, w := range ev.Words {
+		uni := 1 / float64(nw)
+		if utot > 0 {
+			uni = ev.FreqMap[w] / utot
+		}
+		ng := (counts[w] + ne.AddK) / (tot + ne.AddK*float64(nw))
+		if tot+ne.AddK == 0 { // unseen context with no smoothing
+			ng = uni
+		}
+		dist[i] = ne.Lambda*ng + (1-ne.Lambda)*uni
+	}
+	return dist
+}
+
+// NetDist returns the probability of each of the Words of the env given by
+// the activity act of the network, as the softmax of its cosine similarity to
+// their WordReps.
+func (ne *NGramEval) NetDist(ev *CorpusEnv, act *etensor.Float32) []float64 {
+	nw := len(ev.Words)
+	temp := ne.Temp
+	if temp <= 0 {
+		temp = 0.1
+	}
+	dist := make([]float64, nw)
+	mx := math.Inf(-1)
+	for i := range dist {
+		rep := ev.WordReps.SubSpace([]int{i}).(*etensor.Float32)
+		cos := float64(metric.Cosine32(act.Values, rep.Values))
+		if math.IsNaN(cos) { // no activity
+			cos = 0
+		}
+		dist[i] = cos / temp
+		mx = math.Max(mx, dist[i])
+	}
+	sum := 0.0
+	for i := range dist {
+		dist[i] = math.Exp(dist[i] - mx)
+		sum += dist[i]
+	}
+	for i := range dist {
+		dist[i] /= sum
+	}
+	return dist
+}
+
+// Score returns the cross-entropy of the target in the distribution, and
+// whether it is one of the TopK most probable, with ties counting against it.
+func (ne *NGramEval) Score(dist []float64, target int) (ce float64, topk bool) {
+	p := dist[target]
+	ce = -math.Log(math.Max(p, 1e-12))
+	nabove := 0
+	for i, q := range dist {
+		if i != target && q >= p {
+			nabove++
+		}
+	}
+	return ce, nabove < ne.TopK
+}
+
+// Record scores the predictions of the current trial of ev, with the activity
+// act of the network and the n-grams of train, and returns their
+// cross-entropies, or NaNs if the trial has no target in the vocabulary of
+// both envs.
+func (ne *NGramEval) Record(ev, train *CorpusEnv, act *etensor.Float32) (netCE, ngramCE float64) {
+	target, ok := ev.WordMap[ev.CurNextWord]
+	ngTarget, ngok := train.WordMap[ev.CurNextWord]
+	if !ok || !ngok || ev.CurNextWord == "" {
+		return math.NaN(), math.NaN()
+	}
+	netCE, nettop := ne.Score(ne.NetDist(ev, act), target)
+	ngramCE, ngtop := ne.Score(ne.NGramDist(train, ev.CurWords), ngTarget)
+	ne.N++
+	ne.NetCE += netCE
+	ne.NGramCE += ngramCE
+	if nettop {
+		ne.NetTopK++
+	}
+	if ngtop {
+		ne.NGramTopK++
+	}
+	return netCE, ngramCE
+}
+
+// Means returns the mean cross-entropy and TopK accuracy of the network and
+// the n-grams over the trials so far in the epoch, NaN if there were none.
+func (ne *NGramEval) Means() (netCE, ngramCE, netTopK, ngramTopK float64) {
+	if ne.N == 0 {
+		return math.NaN(), math.NaN(), math.NaN(), math.NaN()
+	}
+	n := float64(ne.N)
+	return ne.NetCE / n, ne.NGramCE / n, ne.NetTopK / n, ne.NGramTopK / n
+}
+
+// NGramEvalRecord scores the predictions of the current test trial, if the
+// test and train envs are CorpusEnvs, into the TrlNetCE and TrlNGramCE stats.
+// It is called from the TrialStatsFunc, so that they are in the Test Trial log.
+func (ss *Sim) NGramEvalRecord() {
+	ev, ok := ss.CurrentEnvironment().(*CorpusEnv)
+	train, tok := ss.TrainEnv.(*CorpusEnv)
+	if !ok || !tok {
+		return
+	}
+	lnm := ss.NGramEval.Layer
+	if lnm == "" {
+		lnm = "Output"
+	}
+	act := &etensor.Float32{}
+	ss.Net.LayerByName(lnm).(axon.AxonLayer).AsAxon().UnitValsTensor(act, "ActM")
+	netCE, ngramCE := ss.NGramEval.Record(ev, train, act)
+	ss.Stats.SetFloat("TrlNetCE", netCE)
+	ss.Stats.SetFloat("TrlNGramCE", ngramCE)
+}
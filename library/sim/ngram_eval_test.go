@@ -0,0 +1,60 @@
+package sim_test
+
+import (
+	"math"
+	"os"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/evec"
+	"github.com/emer/etable/etensor"
+)
+
+func TestNGramEval(t *testing.T) {
+	inTempDir(t)
+	os.WriteFile("corpus.txt", []byte("the cat sat\nthe cat ran\nthe dog sat\na dog ran\n"), 0644)
+	ev := sim.CorpusEnv{}
+	ev.Config("corpus.txt", evec.Vec2i{5, 5}, false, 1, 3, 10)
+	ev.Init(0)
+	ev.StartTrial()
+
+	var ne sim.NGramEval
+	ne.Defaults()
+	dist := ne.NGramDist(&ev, []string{"the"})
+	sum := 0.0
+	for _, p := range dist {
+		sum += p
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("n-gram probabilities sum to %g", sum)
+	}
+	if dist[ev.WordMap["cat"]] <= dist[ev.WordMap["dog"]] || dist[ev.WordMap["dog"]] <= dist[ev.WordMap["ran"]] {
+		t.Errorf("cat should be more probable than dog, and dog than ran, after the: %v", dist)
+	}
+
+	// a network whose activity is the pattern of the target predicts it best
+	target := ev.WordMap[ev.CurNextWord]
+	act := ev.WordReps.SubSpace([]int{target}).(*etensor.Float32)
+	ce, topk := ne.Score(ne.NetDist(&ev, act), target)
+	if !topk || ce >= math.Log(float64(len(ev.Words))) {
+		t.Errorf("network with the target pattern: cross-entropy %g, top-k %v", ce, topk)
+	}
+	ne.Reset()
+	ne.Record(&ev, &ev, act)
+	ne.Record(&ev, &ev, &etensor.Float32{Values: make([]float32, act.Len())}) // no activity, uniform
+	netCE, ngramCE, netTopK, _ := ne.Means()
+	if ne.N != 2 || netTopK != 0.5 || math.Abs(netCE-(ce+math.Log(float64(len(ev.Words))))/2) > 1e-9 || math.IsNaN(ngramCE) {
+		t.Errorf("wrong means over the trials: %d %g %g %g", ne.N, netCE, ngramCE, netTopK)
+	}
+
+	// the baseline of a held-out test corpus is counted on the training corpus
+	os.WriteFile("test.txt", []byte("the dog ran\n"), 0644)
+	te := sim.CorpusEnv{}
+	te.Config("test.txt", evec.Vec2i{5, 5}, false, 1, 3, 10)
+	te.Init(0)
+	te.StartTrial()
+	_, ngramCE = ne.Record(&te, &ev, te.WordReps.SubSpace([]int{0}).(*etensor.Float32))
+	if want, _ := ne.Score(ne.NGramDist(&ev, te.CurWords), ev.WordMap[te.CurNextWord]); ngramCE != want {
+		t.Errorf("n-gram cross-entropy %g of %v -> %s, not %g from the training counts", ngramCE, te.CurWords, te.CurNextWord, want)
+	}
+}
@@ -0,0 +1,147 @@
+package sim
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+)
+
+// ShareConfig copies the configuration that the command line and params
+// files set on from into ss, for a Sim made by NewSimFunc: the Tag, the param
+// sets and the selected ExtraSets, the Split and RunAgg settings, and the given
+// command line args.
+// The param sets are shared, not copied, and are only read by the Sims.
+func (ss *Sim) ShareConfig(from *Sim, args CmdArgs) {
+	ss.Tag = from.Tag
+	ss.Params.Params = from.Params.Params
+	ss.Params.ExtraSets = from.Params.ExtraSets
+	ss.Split = from.Split
+	ss.RunAgg = from.RunAgg
+	ss.RunAgg.Curves = nil
+	ss.CmdArgs = args
+}
+
+// RunParallel does the runs given by the command line args in n goroutines at
+// once, each one in its own Sim made by NewSimFunc, with its own network,
+// environments, seed and log files. When they are all done, their Train Run
+// logs are merged, in order of run, into the Train Run log of ss, and RunStats
+// is computed from that.
+//
+// Each run uses its seed from RndSeeds, in the Rand of its Sim, so the results
+// of a run are the same as when it is done on its own. The noise of the layers
+// (Act.Noise) is drawn by axon from the global source shared by all the Sims,
+// so an error is returned, without doing any of the runs, if it is on.
+func (ss *Sim) RunParallel(n int) error {
+	start, nrun := ss.CmdArgs.StartRun, ss.CmdArgs.MaxRuns
+	fmt.Printf("Running %d Runs starting at %d, %d at a time\n", nrun, start, n)
+	runLogs := make([]*etable.Table, nrun)
+	curves := make([][]RunCurve, nrun)
+	runs := make(chan int)
+	var mu sync.Mutex // configuring Sims touches package-level state, so it is done one at a time
+	var wg sync.WaitGroup
+	var err error // of the first Sim with noise, after which no more runs are done
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for run := range runs {
+				mu.Lock()
+				ws := ss.newRunSim(run)
+				if err == nil {
+					if lnm := ws.noisyLayer(); lnm != "" {
+						err = fmt.Errorf("RunParallel: layer %s has noise, which is not reproducible in parallel runs -- turn off its Act.Noise.On, or do the runs one at a time", lnm)
+					}
+				}
+				failed := err != nil
+				mu.Unlock()
+				if failed {
+					continue
+				}
+				ws.Train(etime.TimesN)
+				ws.CloseLogFiles()
+				runLogs[run-start] = ws.Logs.Table(etime.Train, etime.Run)
+				curves[run-start] = ws.RunAgg.Curves
+			}
+		}()
+	}
+	for run := start; run < start+nrun; run++ {
+		runs <- run
+	}
+	close(runs)
+	wg.Wait()
+	if err != nil {
+		return err
+	}
+
+	dt := ss.Logs.Table(etime.Train, etime.Run)
+	dt.SetNumRows(0)
+	for _, rl := range runLogs {
+		dt.AppendRows(rl)
+	}
+	// the runs were named by the worker Sims after their own StartRun, but they
+	// are all runs of ss, and are aggregated together
+	for row := 0; row < dt.Rows; row++ {
+		dt.SetCellString("Params", row, ss.RunName())
+	}
+	ss.RunAgg.Curves = nil
+	for _, rcs := range curves {
+		for _, rc := range rcs {
+			rc.Params = ss.RunName()
+			ss.RunAgg.Curves = append(ss.RunAgg.Curves, rc)
+		}
+	}
+	lt := ss.Logs.TableDetails(etime.Train, etime.Run)
+	lt.ResetIdxViews()
+	writeLogFile(lt)
+	for row := 0; row < dt.Rows; row++ {
+		ss.logArrowRow(etime.Train, etime.Run, row)
+	}
+	ss.LogRunStats()
+	ss.CloseLogFiles()
+	return nil
+}
+
+// noisyLayer returns the name of the first layer of the network with noise
+// on, or "" if there is none.
+func (ss *Sim) noisyLayer() string {
+	for _, ly := range ss.Net.Layers {
+		if ly.(axon.AxonLayer).AsAxon().Act.Noise.On {
+			return ly.Name()
+		}
+	}
+	return ""
+}
+
+// newRunSim makes a Sim with NewSimFunc for doing just the given run,
+// and starts the run.
+func (ss *Sim) newRunSim(run int) *Sim {
+	args := ss.CmdArgs.subArgs()
+	args.StartRun = run // also gives each run its own log file names
+	args.MaxRuns = 1
+	ws := ss.NewSimFunc(args)
+	ws.Metrics = ss.Metrics
+	ws.Manifest = ss.Manifest
+	ws.addStopRules()
+	ws.Init()
+	ws.Run.Set(run)
+	ws.Run.Max = run + 1
+	ws.NewRun()
+	return ws
+}
+
+// subArgs returns a copy of the args for a Sim made with NewSimFunc, without
+// the options that only apply to the Sim that started it.
+func (ca *CmdArgs) subArgs() CmdArgs {
+	args := *ca
+	args.Parallel = 0
+	args.NetData = nil
+	args.saveNetData = false
+	args.resumeFile = ""
+	args.searchFile = ""
+	args.metricsAddr = ""
+	args.wtEvol = ""
+	return args
+}
@@ -0,0 +1,80 @@
+package sim_test
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+)
+
+func TestRunParallel(t *testing.T) {
+	inTempDir(t)
+	ss := newTestSim()
+	ss.CmdArgs.MaxRuns = 3
+	ss.CmdArgs.Parallel = 2
+	if err := ss.RunFromArgs(); err != nil {
+		t.Fatal(err)
+	}
+	dt := ss.Logs.Table(etime.Train, etime.Run)
+	if dt.Rows != 3 {
+		t.Fatalf("expected 3 merged train run log rows, got %d", dt.Rows)
+	}
+	for row := 0; row < dt.Rows; row++ {
+		if run := int(dt.CellFloat("Run", row)); run != row {
+			t.Errorf("run log row %d is for run %d", row, run)
+		}
+	}
+	if _, has := ss.Logs.MiscTables["RunStats"]; !has {
+		t.Errorf("RunStats was not computed from the merged run logs")
+	}
+}
+
+func TestRunParallelNoise(t *testing.T) {
+	inTempDir(t)
+	ss := newTestSim()
+	ss.CmdArgs.MaxRuns = 3
+	ss.CmdArgs.Parallel = 2
+	ss.NewSimFunc = func(args sim.CmdArgs) *sim.Sim {
+		ps := newTestParallelSim(ss, args)
+		ps.Net.LayerByName("Output").(axon.AxonLayer).AsAxon().Act.Noise.On = true
+		return ps
+	}
+	if err := ss.RunFromArgs(); err == nil || !strings.Contains(err.Error(), "Output") {
+		t.Fatalf("expected an error about the noise of the Output layer, got %v", err)
+	}
+	if dt := ss.Logs.Table(etime.Train, etime.Run); dt.Rows != 0 {
+		t.Errorf("expected no runs, got %d run log rows", dt.Rows)
+	}
+}
+
+func TestRunParallelSameAsSerial(t *testing.T) {
+	inTempDir(t)
+	runLog := func(parallel int) *etable.Table {
+		ss := newTestSim()
+		ss.CmdArgs.MaxRuns = 3
+		ss.CmdArgs.Parallel = parallel
+		if err := ss.RunFromArgs(); err != nil {
+			t.Fatal(err)
+		}
+		return ss.Logs.Table(etime.Train, etime.Run)
+	}
+	ser := runLog(0)
+	par := runLog(3)
+	if ser.Rows != 3 || par.Rows != 3 {
+		t.Fatalf("expected 3 run log rows, got %d serial and %d parallel", ser.Rows, par.Rows)
+	}
+	for row := 0; row < ser.Rows; row++ {
+		for _, col := range []string{"UnitErr", "PctErr", "PctCor", "CosDiff"} {
+			if s, p := ser.CellFloat(col, row), par.CellFloat(col, row); s != p {
+				t.Errorf("run %d: %s is %g serial but %g parallel", row, col, s, p)
+			}
+		}
+	}
+	if ue := par.CellFloat("UnitErr", 0); ue == 0 || math.IsNaN(ue) {
+		t.Errorf("the UnitErr of run 0 is %g, not the mean of its last epochs", ue)
+	}
+}
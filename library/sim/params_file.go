@@ -0,0 +1,244 @@
+package sim
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/emer"
+	"github.com/emer/emergent/params"
+	"github.com/goki/ki/kit"
+	"gopkg.in/yaml.v3"
+)
+
+// OpenParamsFile reads param sets from a JSON, TOML or YAML file, according to
+// its extension (.json, .toml, or .yaml / .yml). The file has a list of named
+// sets, each the same as a params.Set, under the key Sets, e.g., in TOML:
+//
+//	[[Sets]]
+//	Name = "Big"
+//	[[Sets.Sheets.Network]]
+//	Sel = "#Output"
+//	Params = { "Layer.Inhib.Layer.Gi" = 0.8 }
+//
+// A JSON file can also be just the list of sets, as written by -hyperFile.
+// Param values can be numbers or strings. Any keys that are not fields of the
+// params types are reported as errors.
+func OpenParamsFile(filename string) (params.Sets, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var tree interface{}
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".json":
+		err = json.Unmarshal(b, &tree)
+	case ".toml":
+		var mp map[string]interface{}
+		_, err = toml.Decode(string(b), &mp)
+		tree = mp
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(b, &tree)
+	default:
+		return nil, fmt.Errorf("OpenParamsFile: %s is not a .json, .toml, or .yaml file", filename)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("OpenParamsFile: %s: %v", filename, err)
+	}
+	tree = paramStrings(tree)
+	if mp, ok := tree.(map[string]interface{}); ok {
+		for k := range mp {
+			if k != "Sets" {
+				return nil, fmt.Errorf("OpenParamsFile: %s: unknown key %q, expected Sets", filename, k)
+			}
+		}
+		tree = mp["Sets"]
+	}
+	if _, ok := tree.([]interface{}); !ok {
+		return nil, fmt.Errorf("OpenParamsFile: %s does not have a list of Sets", filename)
+	}
+	jb, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+	var sets params.Sets
+	dec := json.NewDecoder(bytes.NewReader(jb))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&sets); err != nil {
+		return nil, fmt.Errorf("OpenParamsFile: %s: %v", filename, err)
+	}
+	for i, set := range sets {
+		if set == nil || set.Name == "" {
+			return nil, fmt.Errorf("OpenParamsFile: %s: set %d has no Name", filename, i)
+		}
+	}
+	return sets, nil
+}
+
+// paramStrings converts all the numbers and bools in a decoded file to
+// strings, which is what all the values in the params types are.
+func paramStrings(v interface{}) interface{} {
+	switch vt := v.(type) {
+	case map[string]interface{}:
+		for k, e := range vt {
+			vt[k] = paramStrings(e)
+		}
+	case []map[string]interface{}: // TOML arrays of tables
+		lst := make([]interface{}, len(vt))
+		for i, e := range vt {
+			lst[i] = paramStrings(e)
+		}
+		return lst
+	case []interface{}:
+		for i, e := range vt {
+			vt[i] = paramStrings(e)
+		}
+	case float64:
+		return strconv.FormatFloat(vt, 'g', -1, 64)
+	case int:
+		return strconv.Itoa(vt)
+	case int64:
+		return strconv.FormatInt(vt, 10)
+	case bool:
+		return strconv.FormatBool(vt)
+	}
+	return v
+}
+
+// LoadParamsFile loads the param sets in given file (see OpenParamsFile) into
+// Params, replacing any sets of the same name, e.g., Base. Which sets are used
+// is still chosen by Params.ExtraSets, i.e., the -params flag. The sets are
+// validated against the network by ValidateParamsFile, once it has been made.
+func (ss *Sim) LoadParamsFile(filename string) error {
+	sets, err := OpenParamsFile(filename)
+	if err != nil {
+		return err
+	}
+	for _, set := range sets {
+		if cur, err := ss.Params.Params.SetByNameTry(set.Name); err == nil {
+			*cur = *set
+		} else {
+			ss.Params.Params = append(ss.Params.Params, set)
+		}
+	}
+	ss.CmdArgs.paramsFile = filename
+	ss.CmdArgs.fileSets = sets
+	return nil
+}
+
+// ValidateParamsFile validates the sets loaded by LoadParamsFile,
+// see ValidateParams.
+func (ss *Sim) ValidateParamsFile() error {
+	if len(ss.CmdArgs.fileSets) == 0 {
+		return nil
+	}
+	if err := ss.ValidateParams(ss.CmdArgs.fileSets); err != nil {
+		return fmt.Errorf("%s: %v", ss.CmdArgs.paramsFile, err)
+	}
+	return nil
+}
+
+// ValidateParams checks that every sheet in sets is for one of the Params
+// objects, that every selector in a sheet matches at least one of the layers
+// or projections of the network (or the other object of the sheet), and that
+// every param path is a field of what it matches, which can be set to its value.
+// All the problems found are returned together in one error.
+func (ss *Sim) ValidateParams(sets params.Sets) error {
+	var errs []string
+	for _, set := range sets {
+		for shnm, sh := range set.Sheets {
+			obj, has := ss.Params.Objects[shnm]
+			if !has {
+				errs = append(errs, fmt.Sprintf("set %s: unknown sheet %s", set.Name, shnm))
+				continue
+			}
+			objs := paramsTargets(obj)
+			if len(objs) == 0 {
+				continue // e.g., NetSize without any layers added
+			}
+			for _, sl := range *sh {
+				for pt, val := range sl.Params {
+					if err := validateParam(sl.Sel, pt, val, true, objs); err != nil {
+						errs = append(errs, fmt.Sprintf("set %s, sheet %s: %v", set.Name, shnm, err))
+					}
+				}
+				for pt := range sl.Hypers {
+					if err := validateParam(sl.Sel, pt, "", false, objs); err != nil {
+						errs = append(errs, fmt.Sprintf("set %s, sheet %s: %v", set.Name, shnm, err))
+					}
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid params:\n\t%s", strings.Join(errs, "\n\t"))
+	}
+	return nil
+}
+
+// paramsTargets returns the objects that the sheet for a Params object applies to.
+func paramsTargets(obj interface{}) []interface{} {
+	var objs []interface{}
+	switch ot := obj.(type) {
+	case *axon.Network:
+		for _, ly := range ot.Layers {
+			objs = append(objs, ly)
+			for _, pj := range *ly.RecvPrjns() {
+				objs = append(objs, pj)
+			}
+		}
+	case *emer.NetSize:
+		for _, fv := range *ot {
+			objs = append(objs, fv)
+		}
+	default:
+		objs = append(objs, obj)
+	}
+	return objs
+}
+
+// validateParam checks that param path pt in selector sel applies to at least
+// one of objs, and that it can be set to val there if set is true.
+func validateParam(sel, pt, val string, set bool, objs []interface{}) error {
+	ps := strings.SplitN(pt, ".", 2)
+	if len(ps) != 2 {
+		return fmt.Errorf("%s: param path %q does not start with the type it applies to, e.g., Layer.", sel, pt)
+	}
+	typ, path := ps[0], ps[1]
+	for _, obj := range objs {
+		name, cls, styp := "", "", ""
+		if stylr, ok := obj.(params.Styler); ok {
+			name, cls, styp = stylr.Name(), stylr.Class(), stylr.TypeName()
+		}
+		if styob, ok := obj.(params.StylerObj); ok {
+			obj = styob.Object()
+		}
+		gotyp := kit.NonPtrType(reflect.TypeOf(obj)).Name()
+		if typ != styp && typ != gotyp {
+			continue
+		}
+		if styp != "" && !params.SelMatch(sel, name, cls, styp, gotyp) {
+			continue
+		}
+		// check the path on a new blank object, so nothing is changed
+		blank := reflect.New(kit.NonPtrType(reflect.TypeOf(obj))).Interface()
+		var err error
+		if set {
+			err = params.SetParam(blank, path, val)
+		} else {
+			_, err = params.FindParam(reflect.ValueOf(blank), path)
+		}
+		if err != nil {
+			return fmt.Errorf("%s: %s = %q is not valid for %s: %v", sel, pt, val, typ, strings.TrimSpace(err.Error()))
+		}
+		return nil
+	}
+	return fmt.Errorf("%s: matches no %s for %s", sel, typ, pt)
+}
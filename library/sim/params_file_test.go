@@ -0,0 +1,78 @@
+package sim_test
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/axon/axon"
+)
+
+// writeParamsFile writes a params file with given name in a temp dir.
+func writeParamsFile(t *testing.T, name, text string) string {
+	fnm := filepath.Join(t.TempDir(), name)
+	if err := ioutil.WriteFile(fnm, []byte(text), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return fnm
+}
+
+func TestParamsFile(t *testing.T) {
+	ss := newTestSim()
+	toml := `
+[[Sets]]
+Name = "Base"
+[[Sets.Sheets.Network]]
+Sel = "#Output"
+Params = { "Layer.Inhib.Layer.Gi" = 0.7 }
+
+[[Sets]]
+Name = "Strong"
+[[Sets.Sheets.Network]]
+Sel = "Prjn"
+Params = { "Prjn.Learn.Lrate.Base" = "0.3" }
+`
+	if err := ss.LoadParamsFile(writeParamsFile(t, "p.toml", toml)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ss.ValidateParamsFile(); err != nil {
+		t.Fatal(err)
+	}
+	if val, _ := ss.Params.Params.ParamVal("Base", "Network", "#Output", "Layer.Inhib.Layer.Gi"); val != "0.7" {
+		t.Errorf("Base set was not replaced from the file: Gi = %q", val)
+	}
+	if ss.Params.ExtraSets != "" {
+		t.Errorf("loading the file changed ExtraSets to %q", ss.Params.ExtraSets)
+	}
+	ss.Params.ExtraSets = "Strong"
+	ss.Init()
+	out := ss.Net.LayerByName("Output").(axon.AxonLayer).AsAxon()
+	if out.Inhib.Layer.Gi != 0.7 {
+		t.Errorf("Gi from the file was not applied: %g", out.Inhib.Layer.Gi)
+	}
+
+	yml := `
+Sets:
+  - Name: Bad
+    Sheets:
+      Network:
+        - Sel: "#Nope"
+          Params: {Layer.Inhib.Layer.Gi: 1}
+        - Sel: Layer
+          Params: {Layer.Inhib.Layer.NoSuchField: 1}
+`
+	ss = newTestSim()
+	if err := ss.LoadParamsFile(writeParamsFile(t, "p.yaml", yml)); err != nil {
+		t.Fatal(err)
+	}
+	err := ss.ValidateParamsFile()
+	if err == nil || !strings.Contains(err.Error(), "#Nope") || !strings.Contains(err.Error(), "NoSuchField") {
+		t.Errorf("expected errors for the unknown layer and field, got: %v", err)
+	}
+
+	if _, err := sim.OpenParamsFile(writeParamsFile(t, "p.json", `[{"Name": "X", "Shetes": {}}]`)); err == nil {
+		t.Errorf("expected an error for an unknown key")
+	}
+}
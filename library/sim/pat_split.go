@@ -0,0 +1,216 @@
+package sim
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/gi/gi"
+)
+
+// PatSplit splits the items (patterns) of the environments into the ones that
+// are trained on and the held-out ones that are tested, to measure how well
+// the model generalizes. It is set with the -split flag. The split of a run is
+// a function of its seed, so it is the same when the run is done again, and the
+// splits of all the runs are saved in the splits log file.
+//
+// With Folds > 1, it does k-fold cross-validation across runs: the items are
+// divided into Folds folds, and run r holds out fold r % Folds, so a set of
+// Folds runs tests every item once.
+type PatSplit struct {
+	Holdout float64 `desc:"proportion of the items to hold out for testing, chosen at random for each run"`
+	Folds   int     `desc:"if > 1, do k-fold cross-validation with this many folds, instead of Holdout"`
+	Seed    int64   `desc:"seed of the random permutation of the items -- if 0, Holdout uses the seed of each run, and Folds the seed of run 0, as the folds must be the same for all the runs"`
+}
+
+// ParsePatSplit parses a split given as comma-separated Field=Value settings,
+// e.g., "Holdout=0.2" or "Folds=5".
+func ParsePatSplit(spec string) (PatSplit, error) {
+	ps := PatSplit{}
+	if err := parseSpec(spec, &ps); err != nil {
+		return ps, fmt.Errorf("ParsePatSplit: %v", err)
+	}
+	if ps.Holdout < 0 || ps.Holdout >= 1 {
+		return ps, fmt.Errorf("ParsePatSplit: Holdout must be in [0, 1)")
+	}
+	if !ps.On() {
+		return ps, fmt.Errorf("ParsePatSplit: %q holds nothing out, set Holdout or Folds", spec)
+	}
+	return ps, nil
+}
+
+// On returns whether any items are held out.
+func (ps *PatSplit) On() bool {
+	return ps.Holdout > 0 || ps.Folds > 1
+}
+
+// Fold returns the fold held out in given run, or -1 if not doing k-fold.
+func (ps *PatSplit) Fold(run int) int {
+	if ps.Folds <= 1 {
+		return -1
+	}
+	return run % ps.Folds
+}
+
+// Items returns the indexes of the train and test items, in order, for
+// splitting n items in given run, with the given seed for the permutation.
+func (ps *PatSplit) Items(n, run int, seed int64) (train, test []int) {
+	perm := rand.New(rand.NewSource(seed)).Perm(n)
+	var st, ed int
+	if fold := ps.Fold(run); fold >= 0 {
+		st, ed = fold*n/ps.Folds, (fold+1)*n/ps.Folds
+	} else {
+		ed = int(math.Round(ps.Holdout * float64(n)))
+		if ed == 0 && n > 1 {
+			ed = 1
+		}
+	}
+	test = append(test, perm[st:ed]...)
+	train = append(append(train, perm[:st]...), perm[ed:]...)
+	sort.Ints(train)
+	sort.Ints(test)
+	return
+}
+
+// SplitEnv is an Environment whose items can be restricted to a subset, so it
+// can be used with PatSplit. For TableEnv, the items are the rows of its table.
+type SplitEnv interface {
+	// SplitItems returns the names of all the items that can be split.
+	SplitItems() []string
+
+	// SetSplitItems restricts the env to the items with given indexes,
+	// from those of SplitItems -- it must be Init after.
+	SetSplitItems(idxs []int)
+}
+
+// SplitItems returns the names of the rows of the whole table.
+func (te *TableEnv) SplitItems() []string {
+	dt := te.FixedTable.Table.Table
+	nmcol := te.FixedTable.NameCol
+	if nmcol == "" {
+		nmcol = "Name"
+	}
+	col := dt.ColByName(nmcol)
+	nms := make([]string, dt.Rows)
+	for i := range nms {
+		if col != nil {
+			nms[i] = col.StringVal1D(i)
+		} else {
+			nms[i] = fmt.Sprint(i)
+		}
+	}
+	return nms
+}
+
+// SetSplitItems presents only the given rows of the whole table.
+func (te *TableEnv) SetSplitItems(idxs []int) {
+	ix := etable.NewIdxView(te.FixedTable.Table.Table)
+	ix.Idxs = append([]int(nil), idxs...)
+	te.FixedTable.Table = ix
+}
+
+// splitSeed returns the seed of the permutation of the items in given run.
+func (ss *Sim) splitSeed(run int) int64 {
+	switch {
+	case ss.Split.Seed != 0:
+		return ss.Split.Seed
+	case ss.Split.Folds > 1:
+		return ss.CmdArgs.RndSeeds[0]
+	}
+	return ss.CmdArgs.RndSeeds[run]
+}
+
+// splitEnvs returns the train and test envs as SplitEnvs, and the names of
+// their items, or an error if they cannot be split.
+func (ss *Sim) splitEnvs() (trn, tst SplitEnv, items []string, err error) {
+	var ok bool
+	if trn, ok = ss.TrainEnv.(SplitEnv); !ok {
+		return nil, nil, nil, fmt.Errorf("the train env %s cannot be split", ss.TrainEnv.Name())
+	}
+	if tst, ok = ss.TestEnv.(SplitEnv); !ok {
+		return nil, nil, nil, fmt.Errorf("the test env %s cannot be split", ss.TestEnv.Name())
+	}
+	items = trn.SplitItems()
+	if len(tst.SplitItems()) != len(items) {
+		return nil, nil, nil, fmt.Errorf("the train and test envs do not have the same items to split")
+	}
+	return trn, tst, items, nil
+}
+
+// ApplySplit restricts the train and test envs to the train and held-out items
+// of given run, according to ss.Split. It is called by NewRun before the envs
+// are Init for the run.
+func (ss *Sim) ApplySplit(run int) {
+	if !ss.Split.On() {
+		return
+	}
+	trn, tst, items, err := ss.splitEnvs()
+	if err != nil {
+		fmt.Println("ApplySplit:", err)
+		return
+	}
+	train, test := ss.Split.Items(len(items), run, ss.splitSeed(run))
+	trn.SetSplitItems(train)
+	tst.SetSplitItems(test)
+}
+
+// SplitsTable returns the splits of the items in all the runs to be done, with
+// a row for each item of each run, and whether it is in the Train or Test set.
+func (ss *Sim) SplitsTable() (*etable.Table, error) {
+	_, _, items, err := ss.splitEnvs()
+	if err != nil {
+		return nil, err
+	}
+	dt := etable.New(etable.Schema{
+		{"Run", etensor.INT64, nil, nil},
+		{"Fold", etensor.INT64, nil, nil},
+		{"Seed", etensor.INT64, nil, nil},
+		{"Item", etensor.INT64, nil, nil},
+		{"Name", etensor.STRING, nil, nil},
+		{"Set", etensor.STRING, nil, nil},
+	}, 0)
+	dt.SetMetaData("name", "Splits")
+	for run := ss.CmdArgs.StartRun; run < ss.CmdArgs.StartRun+ss.CmdArgs.MaxRuns; run++ {
+		seed := ss.splitSeed(run)
+		train, test := ss.Split.Items(len(items), run, seed)
+		for _, set := range []struct {
+			name string
+			idxs []int
+		}{{"Train", train}, {"Test", test}} {
+			for _, it := range set.idxs {
+				row := dt.Rows
+				dt.AddRows(1)
+				dt.SetCellFloat("Run", row, float64(run))
+				dt.SetCellFloat("Fold", row, float64(ss.Split.Fold(run)))
+				dt.SetCellFloat("Seed", row, float64(seed))
+				dt.SetCellFloat("Item", row, float64(it))
+				dt.SetCellString("Name", row, items[it])
+				dt.SetCellString("Set", row, set.name)
+			}
+		}
+	}
+	return dt, nil
+}
+
+// saveSplits records the splits of all the runs in the Splits misc log table,
+// and in the splits log file if the run log is saved.
+func (ss *Sim) saveSplits() {
+	if !ss.Split.On() {
+		return
+	}
+	dt, err := ss.SplitsTable()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	ss.Logs.MiscTables["Splits"] = dt
+	if ss.CmdArgs.saveRunLog {
+		fnm := ss.LogFileName("splits")
+		fmt.Printf("Saving the held-out splits to: %s\n", fnm)
+		dt.SaveCSV(gi.FileName(fnm), etable.Tab, etable.Headers)
+		ss.Manifest.AddFile(fnm)
+	}
+}
@@ -0,0 +1,81 @@
+package sim_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/etime"
+)
+
+func TestPatSplit(t *testing.T) {
+	for _, spec := range []string{"Holdout=1", "Seed=3", "Folds"} {
+		if _, err := sim.ParsePatSplit(spec); err == nil {
+			t.Errorf("expected an error for %q", spec)
+		}
+	}
+	ss := newTestSimWith(func(ss *sim.Sim) {
+		ss.CmdArgs.MaxRuns = 3
+		ss.CmdArgs.MaxEpcs = 2
+		ss.CmdArgs.RndSeeds = []int64{1, 2, 3}
+		ss.Split, _ = sim.ParsePatSplit("Folds=3")
+	})
+	if ntrn, ntst := ss.TrainEnv.Trial().Max, ss.TestEnv.Trial().Max; ntrn != 4 || ntst != 2 {
+		t.Fatalf("expected 4 train and 2 test items in fold 0, got %d and %d", ntrn, ntst)
+	}
+
+	dt, err := ss.SplitsTable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dt.Rows != 3*6 {
+		t.Fatalf("expected a row for each of 6 items in 3 runs, got %d", dt.Rows)
+	}
+	ntest := map[int]int{}
+	for i := 0; i < dt.Rows; i++ {
+		if dt.CellString("Set", i) == "Test" {
+			ntest[int(dt.CellFloat("Item", i))]++
+		}
+	}
+	if len(ntest) != 6 {
+		t.Errorf("expected every item to be tested once over the folds, got %v", ntest)
+	}
+	for it, n := range ntest {
+		if n != 1 {
+			t.Errorf("item %d is tested in %d folds", it, n)
+		}
+	}
+
+	ss.Step(etime.Train, etime.Run)
+	rl := ss.Logs.Table(etime.Train, etime.Run)
+	if rl.Rows != 1 || rl.CellFloat("Fold", 0) != 0 {
+		t.Fatalf("expected a Run log row for fold 0")
+	}
+	// the error of the final test, over its trials, minus that of the last training epoch
+	tt := ss.Logs.Table(etime.Test, etime.Trial)
+	nerr := 0.0
+	for i := 0; i < tt.Rows; i++ {
+		nerr += tt.CellFloat("Err", i)
+	}
+	if tt.Rows != 2 {
+		t.Fatalf("expected the final test of the 2 held-out items, got %d trials", tt.Rows)
+	}
+	tpe := nerr / 2
+	if got := rl.CellFloat("TestPctErr", 0); got != tpe {
+		t.Errorf("TestPctErr is %g, expected %g", got, tpe)
+	}
+	te := ss.Logs.Table(etime.Train, etime.Epoch)
+	if te.Rows != 2 {
+		t.Fatalf("expected 2 training epochs, got %d", te.Rows)
+	}
+	if gap, want := rl.CellFloat("GenGap", 0), tpe-te.CellFloat("PctErr", 1); math.Abs(gap-want) > 1e-9 {
+		t.Errorf("GenGap is %g, expected %g", gap, want)
+	}
+
+	ss.Step(etime.Train, etime.Epoch) // starts run 1, with fold 1 held out
+	trn, _ := sim.ParsePatSplit("Folds=3")
+	_, test := trn.Items(6, 1, 1)
+	if ss.TestEnv.Trial().Max != len(test) {
+		t.Errorf("the test env does not have the items of fold 1")
+	}
+}
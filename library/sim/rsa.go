@@ -0,0 +1,197 @@
+package sim
+
+import (
+	"math"
+
+	"github.com/emer/axon/axon"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/metric"
+	"github.com/emer/etable/simat"
+)
+
+// RSA does representational similarity analysis of the hidden layers over the
+// test patterns. On the epochs it is due, it records the minus phase activity
+// of each layer over the test trials, and at the end of testing it computes
+// the similarity matrix of each layer, which is saved in the Stats SimMats as
+// RSA_<layer>, and the summary stats that are logged at Test Epoch:
+//   - <layer>_RSAWithin is the mean similarity between patterns of the same group
+//   - <layer>_RSABetween is the mean similarity between patterns of different groups
+//   - <layer>_RSAInput is the correlation of the similarities with those of the
+//     activity of the Input layers, i.e., how much of the input structure is kept.
+//
+// The stats are NaN on the test epochs where it is not computed.
+type RSA struct {
+	Interval int               `desc:"how often (in training epochs) to do the analysis, counted like TestInterval -- it is done at the end of testing, so it should be a multiple of TestInterval. 0 for never"`
+	GroupBy  string            `desc:"the env state that patterns are grouped by: TrialName or GroupName"`
+	Layers   []string          `desc:"layers to analyze -- all the Hidden layers if empty"`
+	Metric   metric.StdMetrics `desc:"similarity metric -- for distance metrics, such as Euclidean, Within is smaller than Between when the groups are well separated"`
+
+	acts *etable.Table // recorded group, activity of the Layers and of the Input layers, one row per test trial
+	on   bool          // recording the current test epoch
+}
+
+// Defaults sets default values.
+func (rs *RSA) Defaults() {
+	rs.GroupBy = "TrialName"
+	rs.Metric = metric.Correlation
+}
+
+// Due returns whether the analysis is to be done in the testing after given training epoch.
+func (rs *RSA) Due(epc int) bool {
+	return rs.Interval > 0 && (epc+1)%rs.Interval == 0
+}
+
+// RSALayers returns the names of the layers analyzed by RSA.
+func (ss *Sim) RSALayers() []string {
+	if len(ss.RSA.Layers) > 0 {
+		return ss.RSA.Layers
+	}
+	return ss.Net.LayersByClass("Hidden")
+}
+
+// RSAStartEpoch starts recording the test epoch, if the analysis is due at
+// the current training epoch, and sets the stats to NaN otherwise.
+func (ss *Sim) RSAStartEpoch() {
+	rs := &ss.RSA
+	rs.on = rs.Due(ss.TrainEnv.Epoch().Cur)
+	if rs.acts != nil {
+		rs.acts.SetNumRows(0)
+	}
+	if rs.on {
+		return
+	}
+	for _, lnm := range ss.RSALayers() {
+		for _, st := range []string{"_RSAWithin", "_RSABetween", "_RSAInput"} {
+			ss.Stats.SetFloat(lnm+st, math.NaN())
+		}
+	}
+}
+
+// RSARecord records the activity of the current test trial, if recording.
+func (ss *Sim) RSARecord() {
+	rs := &ss.RSA
+	if !rs.on {
+		return
+	}
+	if rs.acts == nil {
+		ss.configRSATable()
+	}
+	dt := rs.acts
+	row := dt.Rows
+	dt.SetNumRows(row + 1)
+	env := ss.CurrentEnvironment()
+	grp := env.TrialName().Cur
+	if rs.GroupBy == "GroupName" {
+		grp = env.GroupName().Cur
+	}
+	dt.SetCellString("Group", row, grp)
+	act := &etensor.Float32{}
+	for _, lnm := range ss.RSALayers() {
+		ly := ss.Net.LayerByName(lnm).(axon.AxonLayer).AsAxon()
+		ly.UnitValsTensor(act, "ActM")
+		dt.SetCellTensor(lnm, row, act)
+	}
+	inp := dt.ColByName("Input").(*etensor.Float64)
+	csz := cellSize(inp)
+	i := row * csz
+	for _, lnm := range ss.Net.LayersByClass("Input") {
+		ly := ss.Net.LayerByName(lnm).(axon.AxonLayer).AsAxon()
+		ly.UnitValsTensor(act, "Act")
+		for _, v := range act.Values {
+			inp.Values[i] = float64(v)
+			i++
+		}
+	}
+}
+
+// configRSATable makes the table the activity is recorded in, with a column for
+// each of the Layers, and one for all the Input layers together.
+func (ss *Sim) configRSATable() {
+	sch := etable.Schema{{"Group", etensor.STRING, nil, nil}}
+	for _, lnm := range ss.RSALayers() {
+		sch = append(sch, etable.Column{lnm, etensor.FLOAT64, ss.Net.LayerByName(lnm).Shape().Shp, nil})
+	}
+	ninp := 0
+	for _, lnm := range ss.Net.LayersByClass("Input") {
+		ninp += ss.Net.LayerByName(lnm).Shape().Len()
+	}
+	sch = append(sch, etable.Column{"Input", etensor.FLOAT64, []int{ninp}, nil})
+	ss.RSA.acts = etable.New(sch, 0)
+}
+
+// RSAStats computes the similarity matrices and stats from the recorded test
+// epoch, if any, and stops recording. It is called at the end of testing,
+// before the Test Epoch is logged.
+func (ss *Sim) RSAStats() {
+	rs := &ss.RSA
+	if !rs.on {
+		return
+	}
+	rs.on = false
+	if rs.acts == nil || rs.acts.Rows < 2 {
+		return
+	}
+	ix := etable.NewIdxView(rs.acts)
+	ix.SortStableColName("Group", true) // so groups are together in the matrices
+	grps := make([]string, ix.Len())
+	for i, ri := range ix.Idxs {
+		grps[i] = rs.acts.CellString("Group", ri)
+	}
+	mfun := metric.StdFunc64(rs.Metric)
+	inp := &simat.SimMat{}
+	inp.TableCol(ix, "Input", "Group", true, mfun)
+	for _, lnm := range ss.RSALayers() {
+		sm := ss.Stats.SimMat("RSA_" + lnm)
+		sm.TableCol(ix, lnm, "Group", true, mfun)
+		within, between := simWithinBetween(sm.Mat.(*etensor.Float64), grps)
+		ss.Stats.SetFloat(lnm+"_RSAWithin", within)
+		ss.Stats.SetFloat(lnm+"_RSABetween", between)
+		ss.Stats.SetFloat(lnm+"_RSAInput", simCorrel(sm.Mat.(*etensor.Float64), inp.Mat.(*etensor.Float64)))
+	}
+}
+
+// simWithinBetween returns the mean of the values of similarity matrix sm, over
+// the pairs of different rows with the same group, and with different groups.
+// Either one is NaN if there are no such pairs.
+func simWithinBetween(sm *etensor.Float64, grps []string) (within, between float64) {
+	n := len(grps)
+	nw, nb := 0, 0
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			v := sm.Value([]int{i, j})
+			if grps[i] == grps[j] {
+				within += v
+				nw++
+			} else {
+				between += v
+				nb++
+			}
+		}
+	}
+	if nw == 0 {
+		within = math.NaN()
+	} else {
+		within /= float64(nw)
+	}
+	if nb == 0 {
+		between = math.NaN()
+	} else {
+		between /= float64(nb)
+	}
+	return
+}
+
+// simCorrel returns the correlation between the upper triangles of
+// similarity matrices a and b, of the same size.
+func simCorrel(a, b *etensor.Float64) float64 {
+	n := a.Dim(0)
+	var av, bv []float64
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			av = append(av, a.Value([]int{i, j}))
+			bv = append(bv, b.Value([]int{i, j}))
+		}
+	}
+	return metric.Correlation64(av, bv)
+}
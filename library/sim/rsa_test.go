@@ -0,0 +1,36 @@
+package sim_test
+
+import (
+	"math"
+	"testing"
+
+	"github.com/emer/emergent/etime"
+)
+
+func TestRSA(t *testing.T) {
+	ss := newTestSim()
+	ss.RSA.Interval = 1
+	ss.TestAll()
+	dt := ss.Logs.Table(etime.Test, etime.Epoch)
+	ntrl := ss.TestEnv.Trial().Max
+	for _, lnm := range ss.RSALayers() {
+		sm := ss.Stats.SimMat("RSA_" + lnm)
+		if sm.Mat == nil || sm.Mat.Dim(0) != ntrl || len(sm.Rows) != ntrl {
+			t.Fatalf("expected a %d x %d similarity matrix for %s", ntrl, ntrl, lnm)
+		}
+		if inp := dt.CellFloat(lnm+"_RSAInput", dt.Rows-1); math.IsNaN(inp) || inp < -1 || inp > 1 {
+			t.Errorf("%s_RSAInput = %g, expected a correlation", lnm, inp)
+		}
+		if btw := dt.CellFloat(lnm+"_RSABetween", dt.Rows-1); math.IsNaN(btw) {
+			t.Errorf("%s_RSABetween is NaN", lnm)
+		}
+	}
+
+	ss.RSA.Interval = 2 // not due after the first epoch
+	ss.TestAll()
+	for _, lnm := range ss.RSALayers() {
+		if v := dt.CellFloat(lnm+"_RSABetween", dt.Rows-1); !math.IsNaN(v) {
+			t.Errorf("%s_RSABetween = %g when RSA was not due, expected NaN", lnm, v)
+		}
+	}
+}
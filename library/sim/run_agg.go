@@ -0,0 +1,276 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/gi/gi"
+)
+
+// RunAgg aggregates stats across the runs with the same Params, as logged in
+// the Train Run log, into the RunAgg misc log table, with the mean, standard
+// error of the mean (SEM), and bootstrap confidence interval of each of the
+// RunStats, and into the Curves misc log table, with the same for each of the
+// EpochStats at each epoch, i.e., the learning curves averaged across runs.
+// Both tables are updated at the end of every run, and saved to the runagg and
+// curves log files if the run log is saved.
+type RunAgg struct {
+	RunStats   []string `desc:"columns of the Train Run log to aggregate across runs -- FirstZero and LastZero values of -1, which mean they were not reached, are left out, as are NaN values"`
+	EpochStats []string `desc:"columns of the Train Epoch log to average across runs into learning curves"`
+	Carry      bool     `desc:"runs that stopped early carry their last values on to the later epochs of the curves -- otherwise the curves at each epoch are over the runs that got to it, whose number is given by N"`
+	NBoot      int      `desc:"number of bootstrap resamples for the confidence intervals -- 0 for none"`
+	CI         float64  `desc:"confidence level of the intervals"`
+	Seed       int64    `desc:"seed of the bootstrap resamples, so the intervals are the same for the same runs"`
+
+	Curves []RunCurve `view:"-" desc:"the EpochStats of each run so far"`
+}
+
+// RunCurve is the learning curves of one run, for RunAgg.
+type RunCurve struct {
+	Params string
+	Run    int
+	Vals   map[string][]float64 `desc:"values of each stat, by epoch"`
+}
+
+// Defaults sets default values.
+func (ra *RunAgg) Defaults() {
+	ra.RunStats = []string{"FirstZero", "PctCor"}
+	ra.EpochStats = []string{"PctErr"}
+	ra.NBoot = 1000
+	ra.CI = 0.95
+	ra.Seed = 1
+}
+
+// AddCurve records the EpochStats of a run from its Train Epoch log.
+func (ra *RunAgg) AddCurve(params string, run int, dt *etable.Table) {
+	rc := RunCurve{Params: params, Run: run, Vals: map[string][]float64{}}
+	for _, st := range ra.EpochStats {
+		col := dt.ColByName(st)
+		if col == nil {
+			continue
+		}
+		vals := make([]float64, dt.Rows)
+		for i := range vals {
+			vals[i] = col.FloatVal1D(i)
+		}
+		rc.Vals[st] = vals
+	}
+	for i := range ra.Curves { // a run can be logged again, e.g., when it is resumed
+		if ra.Curves[i].Params == params && ra.Curves[i].Run == run {
+			ra.Curves[i] = rc
+			return
+		}
+	}
+	ra.Curves = append(ra.Curves, rc)
+}
+
+// CheckpointSaver returns a saver that stores the curves of the runs so far in checkpoints.
+func (ra *RunAgg) CheckpointSaver() CheckpointSaver {
+	return CheckpointSaver{
+		Name: "RunAgg",
+		Save: func() ([]byte, error) { return json.Marshal(ra.Curves) },
+		Load: func(b []byte) error { return json.Unmarshal(b, &ra.Curves) },
+	}
+}
+
+// Stats returns the mean, SEM and confidence interval of the values, leaving
+// out NaNs, and their number. The SEM is NaN for less than 2 values.
+func (ra *RunAgg) Stats(rnd *rand.Rand, vals []float64) (n int, mean, sem, lo, hi float64) {
+	var vs []float64
+	for _, v := range vals {
+		if !math.IsNaN(v) {
+			vs = append(vs, v)
+		}
+	}
+	n = len(vs)
+	mean, sem, lo, hi = math.NaN(), math.NaN(), math.NaN(), math.NaN()
+	if n == 0 {
+		return
+	}
+	sum := 0.0
+	for _, v := range vs {
+		sum += v
+	}
+	mean = sum / float64(n)
+	if n > 1 {
+		sq := 0.0
+		for _, v := range vs {
+			sq += (v - mean) * (v - mean)
+		}
+		sem = math.Sqrt(sq/float64(n-1)) / math.Sqrt(float64(n))
+	}
+	if ra.NBoot <= 0 {
+		return
+	}
+	means := make([]float64, ra.NBoot)
+	for b := range means {
+		bs := 0.0
+		for range vs {
+			bs += vs[rnd.Intn(n)]
+		}
+		means[b] = bs / float64(n)
+	}
+	sort.Float64s(means)
+	alpha := (1 - ra.CI) / 2
+	last := float64(ra.NBoot - 1)
+	lo = means[int(math.Round(alpha*last))]
+	hi = means[int(math.Round((1-alpha)*last))]
+	return
+}
+
+// RunTable returns the aggregates of the RunStats in the given Train Run log,
+// with a row for each Params and stat.
+func (ra *RunAgg) RunTable(runLog *etable.Table) *etable.Table {
+	dt := etable.New(etable.Schema{
+		{"Params", etensor.STRING, nil, nil},
+		{"Stat", etensor.STRING, nil, nil},
+		{"N", etensor.INT64, nil, nil},
+		{"Mean", etensor.FLOAT64, nil, nil},
+		{"SEM", etensor.FLOAT64, nil, nil},
+		{"CILo", etensor.FLOAT64, nil, nil},
+		{"CIHi", etensor.FLOAT64, nil, nil},
+	}, 0)
+	dt.SetMetaData("name", "RunAgg")
+	rnd := rand.New(rand.NewSource(ra.Seed))
+	pcol := runLog.ColByName("Params")
+	var groups []string
+	rows := map[string][]int{}
+	for i := 0; i < runLog.Rows; i++ {
+		p := ""
+		if pcol != nil {
+			p = pcol.StringVal1D(i)
+		}
+		if _, has := rows[p]; !has {
+			groups = append(groups, p)
+		}
+		rows[p] = append(rows[p], i)
+	}
+	for _, p := range groups {
+		for _, st := range ra.RunStats {
+			col := runLog.ColByName(st)
+			if col == nil {
+				continue
+			}
+			vals := make([]float64, len(rows[p]))
+			for i, ri := range rows[p] {
+				vals[i] = col.FloatVal1D(ri)
+				if vals[i] < 0 && (st == "FirstZero" || st == "LastZero") {
+					vals[i] = math.NaN()
+				}
+			}
+			n, mean, sem, lo, hi := ra.Stats(rnd, vals)
+			row := dt.Rows
+			dt.AddRows(1)
+			dt.SetCellString("Params", row, p)
+			dt.SetCellString("Stat", row, st)
+			dt.SetCellFloat("N", row, float64(n))
+			dt.SetCellFloat("Mean", row, mean)
+			dt.SetCellFloat("SEM", row, sem)
+			dt.SetCellFloat("CILo", row, lo)
+			dt.SetCellFloat("CIHi", row, hi)
+		}
+	}
+	return dt
+}
+
+// CurveTable returns the learning curves of the EpochStats averaged across
+// the Curves, with a row for each Params and epoch, the number of runs N at
+// that epoch, and the <stat>:Mean, :SEM, :CILo and :CIHi of each stat.
+func (ra *RunAgg) CurveTable() *etable.Table {
+	sch := etable.Schema{
+		{"Params", etensor.STRING, nil, nil},
+		{"Epoch", etensor.INT64, nil, nil},
+		{"N", etensor.INT64, nil, nil},
+	}
+	for _, st := range ra.EpochStats {
+		for _, ag := range []string{":Mean", ":SEM", ":CILo", ":CIHi"} {
+			sch = append(sch, etable.Column{st + ag, etensor.FLOAT64, nil, nil})
+		}
+	}
+	dt := etable.New(sch, 0)
+	dt.SetMetaData("name", "Curves")
+	rnd := rand.New(rand.NewSource(ra.Seed))
+	var groups []string
+	curves := map[string][]*RunCurve{}
+	for i := range ra.Curves {
+		rc := &ra.Curves[i]
+		if _, has := curves[rc.Params]; !has {
+			groups = append(groups, rc.Params)
+		}
+		curves[rc.Params] = append(curves[rc.Params], rc)
+	}
+	for _, p := range groups {
+		nepc := 0
+		for _, rc := range curves[p] {
+			for _, vals := range rc.Vals {
+				if len(vals) > nepc {
+					nepc = len(vals)
+				}
+			}
+		}
+		for epc := 0; epc < nepc; epc++ {
+			row := dt.Rows
+			dt.AddRows(1)
+			dt.SetCellString("Params", row, p)
+			dt.SetCellFloat("Epoch", row, float64(epc))
+			nrun := 0
+			for _, st := range ra.EpochStats {
+				var vals []float64
+				for _, rc := range curves[p] {
+					cv := rc.Vals[st]
+					switch {
+					case epc < len(cv):
+						vals = append(vals, cv[epc])
+					case ra.Carry && len(cv) > 0:
+						vals = append(vals, cv[len(cv)-1])
+					}
+				}
+				if len(vals) > nrun {
+					nrun = len(vals)
+				}
+				_, mean, sem, lo, hi := ra.Stats(rnd, vals)
+				dt.SetCellFloat(st+":Mean", row, mean)
+				dt.SetCellFloat(st+":SEM", row, sem)
+				dt.SetCellFloat(st+":CILo", row, lo)
+				dt.SetCellFloat(st+":CIHi", row, hi)
+			}
+			dt.SetCellFloat("N", row, float64(nrun))
+		}
+	}
+	return dt
+}
+
+// recordCurve adds the curves of the run that just ended to ss.RunAgg.
+func (ss *Sim) recordCurve() {
+	ss.RunAgg.AddCurve(ss.RunName(), ss.Run.Cur, ss.Logs.Table(etime.Train, etime.Epoch))
+}
+
+// AggregateRuns updates the RunAgg and Curves misc log tables from the Train
+// Run log and ss.RunAgg.Curves, and saves them if the run log is saved.
+func (ss *Sim) AggregateRuns() {
+	tables := []struct {
+		lognm string
+		dt    *etable.Table
+	}{
+		{"runagg", ss.RunAgg.RunTable(ss.Logs.Table(etime.Train, etime.Run))},
+		{"curves", ss.RunAgg.CurveTable()},
+	}
+	for _, t := range tables {
+		ss.Logs.MiscTables[t.dt.MetaData["name"]] = t.dt
+		if !ss.CmdArgs.saveRunLog {
+			continue
+		}
+		fnm := ss.LogFileName(t.lognm)
+		if err := t.dt.SaveCSV(gi.FileName(fnm), etable.Tab, etable.Headers); err != nil {
+			fmt.Println(err)
+			continue
+		}
+		ss.Manifest.AddFile(fnm)
+	}
+}
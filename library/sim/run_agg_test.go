@@ -0,0 +1,65 @@
+package sim_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+func TestRunAgg(t *testing.T) {
+	ra := sim.RunAgg{}
+	ra.Defaults()
+	rnd := rand.New(rand.NewSource(1))
+	n, mean, sem, lo, hi := ra.Stats(rnd, []float64{1, 2, 3, 4, math.NaN()})
+	if n != 4 || mean != 2.5 || math.Abs(sem-math.Sqrt(5.0/3)/2) > 1e-9 {
+		t.Errorf("wrong N, mean or SEM: %d, %g, %g", n, mean, sem)
+	}
+	if !(lo >= 1 && lo < mean && hi > mean && hi <= 4) {
+		t.Errorf("bad confidence interval: [%g, %g]", lo, hi)
+	}
+
+	// a run that stopped early is left out of the later epochs, unless carried on
+	for run, vals := range [][]float64{{1, 0.5, 0}, {1, 0.4}} {
+		dt := etable.New(etable.Schema{{"PctErr", etensor.FLOAT64, nil, nil}}, len(vals))
+		for i, v := range vals {
+			dt.SetCellFloat("PctErr", i, v)
+		}
+		ra.AddCurve("Base", run, dt)
+	}
+	ct := ra.CurveTable()
+	if ct.Rows != 3 || ct.CellFloat("N", 1) != 2 || ct.CellFloat("N", 2) != 1 || ct.CellFloat("PctErr:Mean", 2) != 0 {
+		t.Errorf("wrong curves of runs of different lengths")
+	}
+	if math.Abs(ct.CellFloat("PctErr:Mean", 1)-0.45) > 1e-9 {
+		t.Errorf("expected mean 0.45 at epoch 1, got %g", ct.CellFloat("PctErr:Mean", 1))
+	}
+	ra.Carry = true
+	ct = ra.CurveTable()
+	if ct.CellFloat("N", 2) != 2 || math.Abs(ct.CellFloat("PctErr:Mean", 2)-0.2) > 1e-9 {
+		t.Errorf("expected the last value of the early stopped run to be carried on")
+	}
+
+	ss := newTestSim()
+	ss.Step(etime.Train, etime.Run)
+	ss.Step(etime.Train, etime.Run)
+	at := ss.Logs.MiscTables["RunAgg"]
+	if at == nil || at.Rows != 2 || at.CellString("Stat", 1) != "PctCor" || at.CellFloat("N", 1) != 2 {
+		t.Fatalf("expected the aggregates of FirstZero and PctCor over 2 runs")
+	}
+	rt := ss.Logs.Table(etime.Train, etime.Run)
+	if pc := rt.CellFloat("PctCor", 0); pc <= 0 || math.IsNaN(pc) {
+		t.Errorf("the PctCor of run 0 is %g, not that of its last epochs", pc)
+	}
+	if mean := (rt.CellFloat("PctCor", 0) + rt.CellFloat("PctCor", 1)) / 2; math.Abs(at.CellFloat("Mean", 1)-mean) > 1e-9 {
+		t.Errorf("expected the mean PctCor of the runs %g, got %g", mean, at.CellFloat("Mean", 1))
+	}
+	ct = ss.Logs.MiscTables["Curves"]
+	if nepc := ss.TrainEnv.Epoch().Max; ct == nil || ct.Rows != nepc || ct.CellFloat("N", 0) != 2 {
+		t.Errorf("expected the curves of 2 runs over %d epochs", nepc)
+	}
+}
@@ -1,6 +1,7 @@
 package sim
 
 import (
+	"fmt"
 	"github.com/emer/axon/axon"
 	"github.com/emer/emergent/egui"
 	"github.com/emer/emergent/elog"
@@ -12,6 +13,7 @@ import (
 	"github.com/emer/emergent/looper"
 	"github.com/emer/etable/etable"
 	"math/rand"
+	"sync"
 	"time"
 )
 
@@ -33,10 +35,28 @@ type Sim struct {
 	GUI     egui.GUI      `view:"-" desc:"manages all the gui elements"`
 	CmdArgs CmdArgs       `desc:"Arguments passed in through the command line"`
 
-	Run          env.Ctr `desc:"run number"`
-	TestInterval int     `desc:"how often (in epochs) to run through all the test patterns, in terms of training epochs -- can use 0 or -1 for no testing"`
-	PCAInterval  int     `desc:"how frequently (in epochs) to compute PCA on hidden representations to measure variance?"`
-	NZeroStop    int     `desc:"if a positive number, training will stop after this many epochs with zero UnitErr"`
+	ArrowLogs map[etime.ScopeKey]*ArrowLog `view:"-" desc:"logs that are also saved as Arrow IPC files, see the -arrow flag"`
+	Metrics   *MetricsServer               `view:"-" desc:"if set, every logged row and the current stats are published on it, see the -metrics flag"`
+
+	RasterRecs   *CycleRecorder `view:"-" desc:"if set, records the spike rasters of a sample of trials, see the -rasters flag"`
+	CycleLogRecs *CycleRecorder `view:"-" desc:"if set, records the cycle log of a sample of trials, see the -cyclelog flag"`
+	Manifest     *Manifest      `view:"-" desc:"record of how the runs were done, written next to the logs by RunFromArgs"`
+
+	Run          env.Ctr    `desc:"run number"`
+	Rand         *rand.Rand `view:"-" desc:"random source of this sim, reseeded from RndSeeds at the start of every run -- the envs draw from it rather than from the global source, so that runs in parallel are reproducible"`
+	TestInterval int        `desc:"how often (in epochs) to run through all the test patterns, in terms of training epochs -- can use 0 or -1 for no testing"`
+	PCAInterval  int        `desc:"how frequently (in epochs) to compute PCA on hidden representations to measure variance?"`
+	NZeroStop    int        `desc:"if a positive number, training will stop after this many epochs with zero UnitErr"`
+
+	LrateSched LrateSchedule `desc:"learning rate schedule applied over training epochs"`
+	EarlyStop  EarlyStop     `desc:"early stopping rules for training runs"`
+	RSA        RSA           `desc:"representational similarity analysis of the hidden layers over the test patterns"`
+	Confusion  Confusion     `desc:"confusion matrix of the target and closest pattern names over the test trials"`
+	RunAgg     RunAgg        `desc:"aggregation of stats across runs, with confidence intervals, and of the learning curves"`
+	NGramEval  NGramEval     `desc:"comparison of the next word predictions of the network to those of an n-gram model, over the test trials of a CorpusEnv"`
+	Split      PatSplit      `desc:"held-out split of the items of the envs, to test generalization, see the -split flag"`
+	Snapshots  WtsSnapshots  `desc:"when to save snapshots of the weights during training runs, see the -snapshots flag"`
+	Expect     string        `desc:"acceptance criteria for the model, checked against the Train Run log at the end of RunFromArgs, e.g., FirstZero<=40;PctCor>=0.95 -- see ParseExpectations and the -expect flag"`
 
 	TrainEnv Environment `desc:"Training environment -- contains everything about iterating over input / output patterns over training"`
 	TestEnv  Environment `desc:"Testing environment -- manages iterating over testing"`
@@ -55,11 +75,15 @@ type Sim struct {
 	TestUpdt etime.Times `desc:"at what time scale to update the display during testing?  Anything longer than Epoch updates at Epoch in this model"`
 
 	// Callbacks
-	TrialStatsFunc func(ss *Sim, accum bool) `view:"-" desc:"a function that calculates trial stats"`
-	Initialization func()                    `view:"-" desc:"This is called during sim.Init"`
+	TrialStatsFunc   func(ss *Sim, accum bool) `view:"-" desc:"a function that calculates trial stats"`
+	Initialization   func()                    `view:"-" desc:"This is called during sim.Init"`
+	CheckpointSavers []CheckpointSaver         `view:"-" desc:"additional state to store in checkpoints, beyond what the Sim itself saves"`
+	NewSimFunc       func(args CmdArgs) *Sim   `view:"-" desc:"makes a new, fully configured Sim that shares no state with this one, using the given command line args -- needed for the -parallel flag"`
 
 	// Used by Hippocampus model
 	PreTrainWts []byte `view:"-" desc:"pretrained weights file"`
+
+	randSrc *randSource // source of Rand, whose state is saved in checkpoints
 }
 
 // Env returns the relevant environment based on Time Mode
@@ -71,6 +95,8 @@ func (ss *Sim) Env() envlp.Env {
 func (ss *Sim) New() {
 	ss.Net = &axon.Network{}
 	ss.Pats = &etable.Table{}
+	ss.randSrc = newRandSource(1)
+	ss.Rand = rand.New(ss.randSrc)
 	ss.Stats.Init()
 	ss.Run.Scale = env.Run
 	ss.ViewOn = true
@@ -78,6 +104,10 @@ func (ss *Sim) New() {
 	ss.TestUpdt = etime.Cycle
 	ss.TestInterval = 500 // TODO this should be a value we update or save, seems to log every epoch
 	ss.PCAInterval = 10
+	ss.LrateSched.Defaults()
+	ss.RSA.Defaults()
+	ss.RunAgg.Defaults()
+	ss.NGramEval.Defaults()
 	ss.Time.Defaults()
 }
 
@@ -91,6 +121,25 @@ func (ss *Sim) Init() {
 	ss.GUI.StopNow = false
 	ss.Params.SetMsg = ss.CmdArgs.LogSetParams
 	ss.Params.SetAll()
+	if ss.CmdArgs.lrateSched != "" {
+		if err := ss.LrateSched.SetFromString(ss.CmdArgs.lrateSched); err != nil {
+			fmt.Println(err)
+		}
+	}
+	ss.Manifest.RecordParams(ss)
+	if ss.GUI.Active {
+		ss.saveManifest()
+	}
+	if ss.CmdArgs.rsaInterval > 0 {
+		ss.RSA.Interval = ss.CmdArgs.rsaInterval
+	}
+	if ss.CmdArgs.snapshots != "" {
+		sn, err := ParseWtsSnapshots(ss.CmdArgs.snapshots)
+		if err != nil {
+			fmt.Println(err)
+		}
+		ss.Snapshots = sn
+	}
 	if ss.Initialization != nil {
 		ss.Initialization()
 	}
@@ -101,10 +150,27 @@ func (ss *Sim) Init() {
 	ss.Stats.ResetTimer("PerTrlMSec")
 }
 
-// InitRndSeed initializes the random seed based on current training run number
+// InitRndSeed initializes the random seed of ss.Rand based on current training run number
 func (ss *Sim) InitRndSeed() {
 	run := ss.Run.Cur
-	rand.Seed(ss.CmdArgs.RndSeeds[run])
+	ss.Rand.Seed(ss.CmdArgs.RndSeeds[run])
+}
+
+// globalRandMu is held while the global math/rand source is seeded and drawn
+// from for one sim, as by InitWts, so that sims running in parallel do not
+// interleave their draws.
+var globalRandMu sync.Mutex
+
+// InitWts initializes the weights of the network. Axon draws their random values
+// from the global math/rand source, which is seeded from ss.Rand for this, so that
+// the weights of a run are the same whether it runs alone or in parallel with
+// others. Any random draws of the network during training, such as for noise,
+// are still from the global source, and are only reproducible without -parallel.
+func (ss *Sim) InitWts() {
+	globalRandMu.Lock()
+	defer globalRandMu.Unlock()
+	rand.Seed(ss.Rand.Int63())
+	ss.Net.InitWts()
 }
 
 func (ss *Sim) GetViewUpdate() etime.Times {
@@ -0,0 +1,212 @@
+package sim_test
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/Astera-org/models/library/common"
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/emer"
+	"github.com/emer/emergent/params"
+	"github.com/emer/emergent/prjn"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+)
+
+// The tests of the Sim use a small model, which learns to map each of 6
+// random Input patterns to its own random Output pattern, through one
+// Hidden1 layer.
+
+// nTestPats is the number of patterns of the test model.
+const nTestPats = 6
+
+// newTestSim configures the test model, for 2 runs of 3 epochs.
+func newTestSim() *sim.Sim {
+	return newTestSimWith(nil)
+}
+
+// newTestSimWith is newTestSim, with cfg called before the sim is configured.
+func newTestSimWith(cfg func(ss *sim.Sim)) *sim.Sim {
+	ss := &sim.Sim{}
+	ss.New()
+	ss.CmdArgs.MaxRuns = 2
+	ss.CmdArgs.MaxEpcs = 3
+	ss.CmdArgs.RndSeeds = []int64{1, 2, 3, 4}
+	if cfg != nil {
+		cfg(ss)
+	}
+	configTestPats(ss)
+	configTestParams(ss)
+	configTestSim(ss)
+	ss.NewSimFunc = func(args sim.CmdArgs) *sim.Sim {
+		return newTestParallelSim(ss, args)
+	}
+	ss.Init()
+	return ss
+}
+
+// newTestParallelSim makes a copy of the test model ss, with its own network
+// and envs, for the NewSimFunc.
+func newTestParallelSim(ss *sim.Sim, args sim.CmdArgs) *sim.Sim {
+	ps := &sim.Sim{}
+	ps.New()
+	ps.Pats = ss.Pats
+	configTestParams(ps)
+	ps.ShareConfig(ss, args)
+	configTestSim(ps)
+	return ps
+}
+
+// configTestSim configures everything but the patterns and params.
+func configTestSim(ss *sim.Sim) {
+	configTestEnv(ss)
+	configTestNet(ss)
+	ss.InitStats()
+	ss.ConfigLogItems()
+	ss.ConfigLogs()
+	common.AddDefaultTrainCallbacks(ss)
+	ss.PCAInterval = 0
+}
+
+// configTestPats makes the patterns, which are the same every time.
+func configTestPats(ss *sim.Sim) {
+	dt := ss.Pats
+	dt.SetMetaData("name", "TestPats")
+	dt.SetFromSchema(etable.Schema{
+		{"Name", etensor.STRING, nil, nil},
+		{"Input", etensor.FLOAT32, []int{5, 5}, []string{"Y", "X"}},
+		{"Output", etensor.FLOAT32, []int{5, 5}, []string{"Y", "X"}},
+	}, nTestPats)
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < nTestPats; i++ {
+		dt.SetCellString("Name", i, fmt.Sprint(i))
+		for _, col := range []string{"Input", "Output"} {
+			pat := dt.CellTensor(col, i).(*etensor.Float32)
+			for _, u := range rnd.Perm(pat.Len())[:6] {
+				pat.Values[u] = 1
+			}
+		}
+	}
+}
+
+func configTestParams(ss *sim.Sim) {
+	ss.Params.AddNetwork(ss.Net)
+	ss.Params.AddSim(ss)
+	ss.Params.Params = params.Sets{
+		{Name: "Base", Desc: "params of the test model", Sheets: params.Sheets{
+			"Network": &params.Sheet{
+				{Sel: "Layer", Desc: "all defaults",
+					Params: params.Params{
+						"Layer.Inhib.Layer.Gi":    "1.2",
+						"Layer.Inhib.ActAvg.Init": "0.04",
+						"Layer.Inhib.Layer.Bg":    "0.3",
+						"Layer.Act.Decay.Glong":   "0.6",
+						"Layer.Act.Dend.GbarExp":  "0.5",
+						"Layer.Act.Dend.GbarR":    "6",
+						"Layer.Act.Dt.VmDendTau":  "5",
+						"Layer.Act.Dt.VmSteps":    "2",
+						"Layer.Act.Dt.GeTau":      "5",
+						"Layer.Act.NMDA.Gbar":     "0.15",
+						"Layer.Act.GABAB.Gbar":    "0.2",
+					}},
+				{Sel: "#Input", Desc: "activity level of the patterns",
+					Params: params.Params{
+						"Layer.Inhib.Layer.Gi":    "0.9",
+						"Layer.Act.Clamp.Ge":      "1.0",
+						"Layer.Inhib.ActAvg.Init": "0.24",
+					}},
+				{Sel: "#Output", Desc: "lower inhib for the small output layer",
+					Params: params.Params{
+						"Layer.Inhib.Layer.Gi":    "0.9",
+						"Layer.Inhib.ActAvg.Init": "0.24",
+						"Layer.Act.Spike.Tr":      "1",
+						"Layer.Act.Clamp.Ge":      "0.6",
+					}},
+				{Sel: "Prjn", Desc: "learning",
+					Params: params.Params{
+						"Prjn.Learn.Lrate.Base": "0.2",
+						"Prjn.SWt.Adapt.Lrate":  "0.1",
+						"Prjn.SWt.Init.SPct":    "0.5",
+					}},
+				{Sel: ".Back", Desc: "top-down back-projections have a lower weight scale",
+					Params: params.Params{
+						"Prjn.PrjnScale.Rel": "0.3",
+					}},
+			},
+		}},
+	}
+}
+
+func configTestEnv(ss *sim.Sim) {
+	trn := &sim.TableEnv{}
+	tst := &sim.TableEnv{}
+	ss.TrainEnv = trn
+	ss.TestEnv = tst
+	ss.TrialStatsFunc = testTrialStats
+	ss.NZeroStop = 5
+
+	trn.Config("TrainEnv", "training params and state", etable.NewIdxView(ss.Pats), "Input", "Output")
+	trn.Epoch().Max = ss.CmdArgs.MaxEpcs
+	ss.Run.Max = ss.CmdArgs.MaxRuns
+
+	tst.Config("TestEnv", "testing params and state", etable.NewIdxView(ss.Pats), "Input", "Output")
+	tst.SetSequential(true)
+	tst.Epoch().Max = 1
+	trn.Init(0)
+	tst.Init(0)
+}
+
+func configTestNet(ss *sim.Sim) {
+	net := ss.Net
+	net.InitName(net, "TestNet")
+	inp := net.AddLayer2D("Input", 5, 5, emer.Input)
+	hid := net.AddLayer2D("Hidden1", 7, 7, emer.Hidden)
+	out := net.AddLayer2D("Output", 5, 5, emer.Target)
+	full := prjn.NewFull()
+	net.ConnectLayers(inp, hid, full, emer.Forward)
+	net.BidirConnectLayers(hid, out, full)
+	net.Defaults()
+	ss.Params.SetObject("Network")
+	if err := net.Build(); err != nil {
+		panic(err)
+	}
+	net.InitWts()
+}
+
+// testTrialStats computes the stats of a trial: it is correct if the closest
+// Output pattern to the minus phase activity is that of the trial.
+func testTrialStats(ss *sim.Sim, accum bool) {
+	out := ss.Net.LayerByName("Output").(axon.AxonLayer).AsAxon()
+	ss.Stats.SetFloat("TrlCosDiff", float64(out.CosDiff.Cos))
+	ss.Stats.SetFloat("TrlUnitErr", out.PctUnitErr())
+	_, cor, cnm := ss.Stats.ClosestPat(ss.Net, "Output", "ActM", ss.Pats, "Output", "Name")
+	ss.Stats.SetString("TrlClosest", cnm)
+	ss.Stats.SetFloat("TrlCorrel", float64(cor))
+	if cnm == ss.CurrentEnvironment().TrialName().Cur {
+		ss.Stats.SetFloat("TrlErr", 0)
+	} else {
+		ss.Stats.SetFloat("TrlErr", 1)
+	}
+}
+
+// cyclesPerTrial returns the number of cycles in one theta cycle.
+func cyclesPerTrial(ss *sim.Sim) int {
+	ncyc := 0
+	for _, ph := range ss.Trainer.Phases {
+		ncyc += ph.Duration
+	}
+	return ncyc
+}
+
+// inTempDir changes the working directory to a temp dir for the rest of the
+// test, for the files that the Sim writes in it.
+func inTempDir(t *testing.T) {
+	wd, _ := os.Getwd()
+	if err := os.Chdir(t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
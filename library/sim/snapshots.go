@@ -0,0 +1,247 @@
+package sim
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emer/axon/axon"
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/goki/gi/gi"
+)
+
+// WtsSnapshots is the policy for saving snapshots of the weights during the
+// training runs, as set with the -snapshots flag. Snapshots are saved at the end
+// of training epochs, to one file per run and number of epochs trained, named by
+// SnapshotFileName, and their series can be analyzed with WeightEvolution.
+type WtsSnapshots struct {
+	Init      bool   `desc:"save the initial weights of each run, as the snapshot after 0 epochs -- needed for the distance from init in WeightEvolution"`
+	Every     int    `desc:"if > 0, save every this many training epochs"`
+	FirstZero bool   `desc:"save at the epoch where FirstZero is reached"`
+	Best      string `desc:"if set, a column of the Test Epoch log -- save after every test where it is the best so far in the run"`
+	Maximize  bool   `desc:"higher values of Best are better -- otherwise lower is better"`
+
+	BestVal  float64 `inactive:"+" desc:"best value of Best so far in the run"`
+	TestRows int     `inactive:"+" desc:"rows of the Test Epoch log that were already checked for Best"`
+}
+
+// ParseWtsSnapshots parses a snapshot policy given as comma-separated
+// Field=Value settings, e.g., "Every=10,FirstZero=true,Best=PctErr".
+// Init is true unless it is set to false.
+func ParseWtsSnapshots(spec string) (WtsSnapshots, error) {
+	sn := WtsSnapshots{Init: true}
+	if err := parseSpec(spec, &sn, "BestVal", "TestRows"); err != nil {
+		return sn, fmt.Errorf("ParseWtsSnapshots: %v", err)
+	}
+	sn.Reset()
+	return sn, nil
+}
+
+// On returns whether any snapshots are to be saved.
+func (sn *WtsSnapshots) On() bool {
+	return sn.Init || sn.Every > 0 || sn.FirstZero || sn.Best != ""
+}
+
+// Reset resets the best value at the start of a new run.
+func (sn *WtsSnapshots) Reset() {
+	sn.BestVal = math.MaxFloat64
+	if sn.Maximize {
+		sn.BestVal = -math.MaxFloat64
+	}
+	sn.TestRows = 0
+}
+
+// CheckpointSaver returns a saver that stores the best value so far in checkpoints.
+func (sn *WtsSnapshots) CheckpointSaver() CheckpointSaver {
+	return CheckpointSaver{
+		Name: "Snapshots",
+		Save: func() ([]byte, error) { return json.Marshal(sn) },
+		Load: func(b []byte) error { return json.Unmarshal(b, sn) },
+	}
+}
+
+// SnapshotFileName returns the name of the weights snapshot of the current run
+// after given number of training epochs.
+func (ss *Sim) SnapshotFileName(nepc int) string {
+	return ss.Net.Nm + "_" + ss.RunName() + "_snap_" + ss.RunEpochName(ss.Run.Cur, nepc) + ".wts.gz"
+}
+
+// ParseSnapshotName returns the run and number of training epochs of a weights
+// snapshot from its file name, as made by SnapshotFileName.
+func ParseSnapshotName(fnm string) (run, nepc int, err error) {
+	base := strings.TrimSuffix(filepath.Base(fnm), ".wts.gz")
+	fs := strings.Split(base, "_")
+	if len(fs) < 3 || fs[len(fs)-3] != "snap" {
+		return 0, 0, fmt.Errorf("ParseSnapshotName: %s is not the name of a weights snapshot", fnm)
+	}
+	if run, err = strconv.Atoi(fs[len(fs)-2]); err == nil {
+		nepc, err = strconv.Atoi(fs[len(fs)-1])
+	}
+	if err != nil {
+		return 0, 0, fmt.Errorf("ParseSnapshotName %s: %w", fnm, err)
+	}
+	return run, nepc, nil
+}
+
+// SaveSnapshotsIfDue saves a snapshot of the weights if ss.Snapshots calls for
+// one after given number of training epochs, 0 being the initial weights.
+// It is called at the end of each training epoch, after the logs and testing.
+func (ss *Sim) SaveSnapshotsIfDue(nepc int) {
+	sn := &ss.Snapshots
+	var why []string
+	if nepc == 0 {
+		if sn.Init {
+			why = append(why, "Init")
+		}
+	} else {
+		if sn.Every > 0 && nepc%sn.Every == 0 {
+			why = append(why, "Every")
+		}
+		if sn.FirstZero && ss.Stats.Int("FirstZero") == nepc-1 {
+			why = append(why, "FirstZero")
+		}
+		if sn.Best != "" {
+			dt := ss.Logs.Table(etime.Test, etime.Epoch)
+			if dt.Rows > sn.TestRows {
+				sn.TestRows = dt.Rows
+				val := dt.CellFloat(sn.Best, dt.Rows-1)
+				if (sn.Maximize && val > sn.BestVal) || (!sn.Maximize && val < sn.BestVal) {
+					sn.BestVal = val
+					why = append(why, "Best")
+				}
+			}
+		}
+	}
+	if len(why) == 0 {
+		return
+	}
+	fnm := ss.SnapshotFileName(nepc)
+	fmt.Printf("Saving weights snapshot (%s) to: %s\n", strings.Join(why, ", "), fnm)
+	if err := ss.Net.SaveWtsJSON(gi.FileName(fnm)); err != nil {
+		fmt.Println(err)
+		return
+	}
+	ss.Manifest.AddFile(fnm)
+}
+
+// WtSatThr is the distance from the 0 and 1 bounds within which a weight
+// counts as saturated, in WeightEvolution.
+var WtSatThr = float32(0.05)
+
+// WeightEvolution loads each of the given weights snapshots, as saved with
+// the -snapshots flag, into net and returns a table with a row for each, in
+// order of run and epochs, and these stats of the weights of each projection:
+//   - <prjn>_Mean and <prjn>_Var are their mean and variance
+//   - <prjn>_Sat is the proportion within WtSatThr of 0 or 1
+//   - <prjn>_L2Init is their L2 distance from the first snapshot of the same run,
+//     which is the initial weights if they were saved.
+//
+// The weights of net are left as those of the last snapshot.
+func WeightEvolution(net *axon.Network, files []string) (*etable.Table, error) {
+	type snap struct {
+		file      string
+		run, nepc int
+	}
+	snaps := make([]snap, len(files))
+	for i, fnm := range files {
+		run, nepc, err := ParseSnapshotName(fnm)
+		if err != nil {
+			return nil, err
+		}
+		snaps[i] = snap{fnm, run, nepc}
+	}
+	sort.SliceStable(snaps, func(i, j int) bool {
+		if snaps[i].run != snaps[j].run {
+			return snaps[i].run < snaps[j].run
+		}
+		return snaps[i].nepc < snaps[j].nepc
+	})
+
+	var prjns []*axon.Prjn
+	sch := etable.Schema{
+		{"Run", etensor.INT64, nil, nil},
+		{"Epoch", etensor.INT64, nil, nil},
+		{"File", etensor.STRING, nil, nil},
+	}
+	for _, ly := range net.Layers {
+		for _, p := range *ly.RecvPrjns() {
+			pj := p.(axon.AxonPrjn).AsAxon()
+			prjns = append(prjns, pj)
+			for _, st := range []string{"_Mean", "_Var", "_Sat", "_L2Init"} {
+				sch = append(sch, etable.Column{pj.Name() + st, etensor.FLOAT64, nil, nil})
+			}
+		}
+	}
+	dt := etable.New(sch, len(snaps))
+	dt.SetMetaData("name", "WeightEvolution")
+
+	var init [][]float32 // weights of the first snapshot of the current run, by prjn
+	for i, sn := range snaps {
+		if err := net.OpenWtsJSON(gi.FileName(sn.file)); err != nil {
+			return nil, fmt.Errorf("WeightEvolution %s: %w", sn.file, err)
+		}
+		dt.SetCellFloat("Run", i, float64(sn.run))
+		dt.SetCellFloat("Epoch", i, float64(sn.nepc))
+		dt.SetCellString("File", i, sn.file)
+		if i == 0 || sn.run != snaps[i-1].run {
+			init = make([][]float32, len(prjns))
+			for pi, pj := range prjns {
+				init[pi] = make([]float32, len(pj.Syns))
+				for si := range pj.Syns {
+					init[pi][si] = pj.Syns[si].Wt
+				}
+			}
+		}
+		for pi, pj := range prjns {
+			var sum, ssq, sat, dsq float64
+			for si := range pj.Syns {
+				wt := pj.Syns[si].Wt
+				sum += float64(wt)
+				ssq += float64(wt) * float64(wt)
+				if wt <= WtSatThr || wt >= 1-WtSatThr {
+					sat++
+				}
+				d := float64(wt - init[pi][si])
+				dsq += d * d
+			}
+			mean, vr := math.NaN(), math.NaN()
+			if n := float64(len(pj.Syns)); n > 0 {
+				mean = sum / n
+				vr = ssq/n - mean*mean
+				sat /= n
+			}
+			nm := pj.Name()
+			dt.SetCellFloat(nm+"_Mean", i, mean)
+			dt.SetCellFloat(nm+"_Var", i, vr)
+			dt.SetCellFloat(nm+"_Sat", i, sat)
+			dt.SetCellFloat(nm+"_L2Init", i, math.Sqrt(dsq))
+		}
+	}
+	return dt, nil
+}
+
+// SaveWeightEvolution does the WeightEvolution analysis of the weights
+// snapshots that match the -wtevol glob pattern, and saves the table to the
+// wtevol log file.
+func (ss *Sim) SaveWeightEvolution() error {
+	files, err := filepath.Glob(ss.CmdArgs.wtEvol)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no weights snapshots match %s", ss.CmdArgs.wtEvol)
+	}
+	dt, err := WeightEvolution(ss.Net, files)
+	if err != nil {
+		return err
+	}
+	fnm := ss.LogFileName("wtevol")
+	fmt.Printf("Saving the weight evolution of %d snapshots to: %s\n", len(files), fnm)
+	return dt.SaveCSV(gi.FileName(fnm), etable.Tab, etable.Headers)
+}
@@ -0,0 +1,71 @@
+package sim_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Astera-org/models/library/common"
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/etime"
+)
+
+func TestWeightSnapshots(t *testing.T) {
+	inTempDir(t) // snapshots are saved in the working directory
+	ss := newTestSim()
+	common.AddSimpleCallbacks(ss)
+	ss.TestInterval = 1
+	var err error
+	if ss.Snapshots, err = sim.ParseWtsSnapshots("Every=2,Best=PctErr"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sim.ParseWtsSnapshots("Every=2,BestVal=0"); err == nil {
+		t.Errorf("expected an error for setting BestVal")
+	}
+	ss.NewRun()
+	for i := 0; i < 3; i++ {
+		ss.Step(etime.Train, etime.Epoch)
+	}
+
+	files, _ := filepath.Glob("*_snap_000_*.wts.gz")
+	has := map[int]bool{}
+	for _, fnm := range files {
+		_, nepc, err := sim.ParseSnapshotName(fnm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		has[nepc] = true
+	}
+	// the first test is always the best so far
+	if !has[0] || !has[1] || !has[2] {
+		t.Fatalf("expected the snapshots after 0, 1 and 2 epochs, got %v", files)
+	}
+
+	dt, err := sim.WeightEvolution(ss.Net, files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dt.Rows != len(files) || dt.CellFloat("Epoch", 0) != 0 {
+		t.Fatalf("expected a row for each snapshot, in order of epochs")
+	}
+	nprjn := 0
+	for _, cnm := range dt.ColNames {
+		if !strings.HasSuffix(cnm, "_L2Init") {
+			continue
+		}
+		nprjn++
+		pnm := strings.TrimSuffix(cnm, "_L2Init")
+		if dt.CellFloat(cnm, 0) != 0 || !(dt.CellFloat(cnm, dt.Rows-1) > 0) {
+			t.Errorf("%s: expected 0 at init, and > 0 after learning", cnm)
+		}
+		if mean := dt.CellFloat(pnm+"_Mean", 0); !(mean > 0 && mean < 1) {
+			t.Errorf("%s_Mean is out of range: %g", pnm, mean)
+		}
+		if sat := dt.CellFloat(pnm+"_Sat", dt.Rows-1); !(sat >= 0 && sat <= 1) {
+			t.Errorf("%s_Sat is out of range: %g", pnm, sat)
+		}
+	}
+	if nprjn == 0 {
+		t.Errorf("no projection stats in the table")
+	}
+}
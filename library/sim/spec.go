@@ -0,0 +1,34 @@
+package sim
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/emer/emergent/params"
+)
+
+// parseSpec sets the fields of obj from comma-separated Field=Value settings,
+// e.g., "Every=10,Trials=5", with params.SetParam. It is the common part of
+// the specs given on the command line, like -stop, -lrsched and -snapshots.
+// An empty spec sets nothing, and the fields named in fixed cannot be set.
+func parseSpec(spec string, obj interface{}, fixed ...string) error {
+	if strings.TrimSpace(spec) == "" {
+		return nil
+	}
+	for _, kv := range strings.Split(spec, ",") {
+		fv := strings.SplitN(kv, "=", 2)
+		if len(fv) != 2 {
+			return fmt.Errorf("setting %q is not of the form Field=Value", kv)
+		}
+		fld := strings.TrimSpace(fv[0])
+		for _, fx := range fixed {
+			if fld == fx {
+				return fmt.Errorf("%s cannot be set", fld)
+			}
+		}
+		if err := params.SetParam(obj, fld, strings.TrimSpace(fv[1])); err != nil {
+			return err
+		}
+	}
+	return nil
+}
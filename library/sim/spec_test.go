@@ -0,0 +1,31 @@
+package sim
+
+import "testing"
+
+func TestParseSpec(t *testing.T) {
+	cs := CycleSample{}
+	if err := parseSpec(" Every = 10,Trials=5", &cs); err != nil {
+		t.Fatal(err)
+	}
+	if cs.Every != 10 || cs.Trials != 5 {
+		t.Errorf("expected Every 10 and Trials 5, got %+v", cs)
+	}
+	if err := parseSpec("", &cs); err != nil || cs.Every != 10 {
+		t.Errorf("an empty spec should set nothing: %v %+v", err, cs)
+	}
+	sn := WtsSnapshots{}
+	if err := parseSpec("Best=PctErr,Maximize=true", &sn, "BestVal"); err != nil {
+		t.Fatal(err)
+	}
+	if sn.Best != "PctErr" || !sn.Maximize {
+		t.Errorf("expected Best PctErr and Maximize, got %+v", sn)
+	}
+	for _, bad := range []string{"Every", "Every=10,", "NoSuchField=1", "Every=ten"} {
+		if err := parseSpec(bad, &cs); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+	if err := parseSpec("BestVal=0", &sn, "BestVal"); err == nil {
+		t.Errorf("expected an error for setting a fixed field")
+	}
+}
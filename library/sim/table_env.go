@@ -0,0 +1,171 @@
+package sim
+
+import (
+	"math/rand"
+
+	"github.com/emer/emergent/env"
+	"github.com/emer/etable/etable"
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/split"
+)
+
+// LayerCol maps a layer of the network to the table column that is applied to it.
+type LayerCol struct {
+	Layer string `desc:"name of the layer"`
+	Col   string `desc:"name of the column with the patterns for the layer"`
+}
+
+// TableEnv is an Environment that presents the rows of an etable.IdxView
+// as trials, applying the cells of a column to each of the layers in Cols.
+// Unless it is Sequential, the rows are shuffled at the start of every epoch.
+// Several tables can be kept in Tables, to switch between with AssignTable.
+type TableEnv struct {
+	env.FixedTable
+	Cols   []LayerCol                 `desc:"the input and output layers, and the columns that are applied to them"`
+	Tables map[string]*etable.IdxView `desc:"named tables that can be presented, see AssignTable"`
+	Rand   *rand.Rand                 `view:"-" desc:"if set, the random source of the orders of the trials -- otherwise the global one"`
+}
+
+// Config sets the name, description and table of the env, which applies the
+// columns with the same names as the given input and output layers.
+func (te *TableEnv) Config(name, desc string, tbl *etable.IdxView, layers ...string) {
+	te.Nm = name
+	te.Dsc = desc
+	te.FixedTable.Table = tbl
+	te.Cols = nil
+	for _, lnm := range layers {
+		te.Cols = append(te.Cols, LayerCol{Layer: lnm, Col: lnm})
+	}
+}
+
+// SetLayerCol sets the column applied to given layer, adding the layer if needed.
+func (te *TableEnv) SetLayerCol(layer, col string) {
+	for i := range te.Cols {
+		if te.Cols[i].Layer == layer {
+			te.Cols[i].Col = col
+			return
+		}
+	}
+	te.Cols = append(te.Cols, LayerCol{Layer: layer, Col: col})
+}
+
+// AddTable adds a named table, that can then be presented with AssignTable.
+func (te *TableEnv) AddTable(name string, tbl *etable.IdxView) {
+	if te.Tables == nil {
+		te.Tables = make(map[string]*etable.IdxView)
+	}
+	te.Tables[name] = tbl
+}
+
+// AssignTable presents the named table from Tables, starting a new order of trials.
+func (te *TableEnv) AssignTable(name string) {
+	te.FixedTable.Table = te.Tables[name]
+	te.NewOrder()
+}
+
+// SplitTable splits the rows of dt at random, into a train view with
+// proportion trainPct of them, and a test view with the rest.
+func SplitTable(dt *etable.Table, trainPct float64) (train, test *etable.IdxView) {
+	spl, _ := split.Permuted(etable.NewIdxView(dt), []float64{trainPct, 1 - trainPct}, []string{"Train", "Test"})
+	return spl.Splits[0], spl.Splits[1]
+}
+
+// StartEpoch shuffles the order of the trials, unless Sequential.
+func (te *TableEnv) StartEpoch() {
+	if !te.FixedTable.Sequential {
+		te.PermuteOrder()
+	}
+}
+
+// SetRand sets the random source of the orders of the trials.
+func (te *TableEnv) SetRand(rnd *rand.Rand) {
+	te.Rand = rnd
+}
+
+// Init initializes the counters for a new run, and starts a new order of trials.
+func (te *TableEnv) Init(run int) {
+	te.FixedTable.Init(run)
+	if te.Rand != nil {
+		te.NewOrder()
+	}
+}
+
+// NewOrder starts a new random order of all the trials.
+func (te *TableEnv) NewOrder() {
+	if te.Rand == nil {
+		te.FixedTable.NewOrder()
+		return
+	}
+	np := te.FixedTable.Table.Len()
+	te.FixedTable.Order = te.Rand.Perm(np)
+	te.FixedTable.Trial.Max = np
+}
+
+// PermuteOrder shuffles the current order of the trials.
+func (te *TableEnv) PermuteOrder() {
+	if te.Rand == nil {
+		te.FixedTable.PermuteOrder()
+		return
+	}
+	ord := te.FixedTable.Order
+	te.Rand.Shuffle(len(ord), func(i, j int) { ord[i], ord[j] = ord[j], ord[i] })
+}
+
+// State returns the pattern of the current trial for given layer,
+// or nil if the layer is not in Cols.
+func (te *TableEnv) State(layerName string) etensor.Tensor {
+	te.setNames()
+	for _, lc := range te.Cols {
+		if lc.Layer == layerName {
+			return te.FixedTable.State(lc.Col)
+		}
+	}
+	return nil
+}
+
+// Action does nothing, as the trials of a table do not depend on what the agent does.
+func (te *TableEnv) Action(layerName string, act etensor.Tensor) {}
+
+func (te *TableEnv) InputAndOutputLayers() []string {
+	lays := make([]string, len(te.Cols))
+	for i, lc := range te.Cols {
+		lays[i] = lc.Layer
+	}
+	return lays
+}
+
+func (te *TableEnv) CurTrialName() string {
+	te.setNames()
+	return te.FixedTable.TrialName.Cur
+}
+
+// setNames sets TrialName and GroupName from the current row, if there is one.
+// The Sim sets the Trial counter itself rather than calling Step, which is
+// where FixedTable sets them.
+func (te *TableEnv) setNames() {
+	trl := te.FixedTable.Trial.Cur
+	if trl < 0 || trl >= len(te.FixedTable.Order) {
+		return
+	}
+	te.SetTrialName()
+	te.SetGroupName()
+}
+
+func (te *TableEnv) SetName(name string)          { te.Nm = name }
+func (te *TableEnv) SetDesc(desc string)          { te.Dsc = desc }
+func (te *TableEnv) Order() []int                 { return te.FixedTable.Order }
+func (te *TableEnv) Sequential() bool             { return te.FixedTable.Sequential }
+func (te *TableEnv) SetSequential(s bool)         { te.FixedTable.Sequential = s }
+func (te *TableEnv) Run() *env.Ctr                { return &te.FixedTable.Run }
+func (te *TableEnv) Epoch() *env.Ctr              { return &te.FixedTable.Epoch }
+func (te *TableEnv) Trial() *env.Ctr              { return &te.FixedTable.Trial }
+func (te *TableEnv) TrialName() *env.CurPrvString { return &te.FixedTable.TrialName }
+func (te *TableEnv) GroupName() *env.CurPrvString { return &te.FixedTable.GroupName }
+func (te *TableEnv) NameCol() string              { return te.FixedTable.NameCol }
+func (te *TableEnv) SetNameCol(s string)          { te.FixedTable.NameCol = s }
+func (te *TableEnv) GroupCol() string             { return te.FixedTable.GroupCol }
+func (te *TableEnv) SetGroupCol(s string)         { te.FixedTable.GroupCol = s }
+func (te *TableEnv) Step()                        { te.FixedTable.Step() }
+
+var _ Environment = (*TableEnv)(nil)
+var _ RandEnv = (*TableEnv)(nil)
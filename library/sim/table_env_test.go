@@ -0,0 +1,75 @@
+package sim_test
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/etime"
+	"github.com/emer/etable/etable"
+)
+
+func TestTableEnv(t *testing.T) {
+	ss := newTestSim()
+	te := ss.TrainEnv.(*sim.TableEnv)
+	if lays := te.InputAndOutputLayers(); len(lays) != 2 || lays[0] != "Input" || lays[1] != "Output" {
+		t.Errorf("unexpected layers: %v", lays)
+	}
+	ss.Step(etime.Train, etime.Trial)
+	te.Trial().Cur = 0
+	row := te.Row()
+	if nm := te.CurTrialName(); nm != ss.Pats.CellString("Name", row) {
+		t.Errorf("trial name %q is not that of row %d", nm, row)
+	}
+	te.SetLayerCol("Output", "Input")
+	var got, want []float64
+	te.State("Output").Floats(&got)
+	ss.Pats.CellTensor("Input", row).Floats(&want)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Output layer did not get the Input column")
+	}
+	if te.State("Hidden1") != nil {
+		t.Errorf("expected no state for a layer that is not in Cols")
+	}
+
+	orders := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		te.StartEpoch()
+		orders[fmt.Sprint(te.Order())] = true
+	}
+	if len(orders) < 2 {
+		t.Errorf("the order of trials was not shuffled by StartEpoch")
+	}
+
+	train, test := sim.SplitTable(ss.Pats, .5)
+	if train.Len()+test.Len() != ss.Pats.Rows || train.Len() != ss.Pats.Rows/2 {
+		t.Errorf("bad split of %d rows: %d train, %d test", ss.Pats.Rows, train.Len(), test.Len())
+	}
+}
+
+func TestTableEnvRand(t *testing.T) {
+	ss := newTestSim()
+	orders := func() [][]int {
+		te := &sim.TableEnv{}
+		te.Config("Env", "", etable.NewIdxView(ss.Pats), "Input", "Output")
+		te.SetRand(rand.New(rand.NewSource(5)))
+		te.Init(0)
+		var ords [][]int
+		for i := 0; i < 3; i++ {
+			te.StartEpoch()
+			ords = append(ords, append([]int{}, te.Order()...))
+		}
+		return ords
+	}
+	rand.Seed(1)
+	a := orders()
+	rand.Seed(2)
+	b := orders()
+	if fmt.Sprint(a) != fmt.Sprint(b) {
+		t.Errorf("the orders depend on the global random source: %v and %v", a, b)
+	}
+	if fmt.Sprint(a[0]) == fmt.Sprint(a[1]) && fmt.Sprint(a[1]) == fmt.Sprint(a[2]) {
+		t.Errorf("the order is not shuffled every epoch: %v", a)
+	}
+}
@@ -0,0 +1,217 @@
+package sim
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Tokenizer splits the words of a sentence into tokens, e.g., subwords, which
+// CorpusEnv then uses as its words, for the vocabulary, NGrams and WordReps.
+type Tokenizer interface {
+	// Tokens returns the tokens of the given words, in order.
+	Tokens(words []string) []string
+}
+
+// BPEEnd marks the last symbol of a word in BPE tokens, so that a token at the
+// end of a word is different from the same letters within a word.
+const BPEEnd = "</w>"
+
+// BPE is a byte-pair encoding Tokenizer: words are split into their letters,
+// which are merged into larger subwords by applying the Merges in order, so
+// frequent words are one token and rare words are a few tokens of their parts,
+// instead of being out of the vocabulary. The merges are learned from the
+// counts of the words of a corpus with TrainBPE.
+type BPE struct {
+	Merges [][2]string `desc:"pairs of adjacent symbols to merge into one, in order of priority"`
+
+	ranks map[[2]string]int   // index of each merge in Merges
+	cache map[string][]string // tokens of the words seen so far
+}
+
+// bpeCacheMax is the number of words whose tokens are cached, after which the
+// cache is emptied, to bound its memory.
+const bpeCacheMax = 1 << 16
+
+// NewBPE returns a BPE with given merges.
+func NewBPE(merges [][2]string) *BPE {
+	bp := &BPE{Merges: merges}
+	bp.ranks = make(map[[2]string]int, len(merges))
+	for i, m := range merges {
+		if _, has := bp.ranks[m]; !has {
+			bp.ranks[m] = i
+		}
+	}
+	return bp
+}
+
+// bpeSymbols returns the letters of word, with BPEEnd on the last.
+func bpeSymbols(word string) []string {
+	rs := []rune(word)
+	syms := make([]string, len(rs))
+	for i, r := range rs {
+		syms[i] = string(r)
+	}
+	if len(syms) > 0 {
+		syms[len(syms)-1] += BPEEnd
+	}
+	return syms
+}
+
+// mergePair replaces each occurrence of the pair in syms, from left to right,
+// with the two symbols joined.
+func mergePair(syms []string, pair [2]string) []string {
+	out := syms[:0]
+	for i := 0; i < len(syms); i++ {
+		if i+1 < len(syms) && syms[i] == pair[0] && syms[i+1] == pair[1] {
+			out = append(out, pair[0]+pair[1])
+			i++
+		} else {
+			out = append(out, syms[i])
+		}
+	}
+	return out
+}
+
+// TrainBPE learns the merges of a BPE from the counts of the words of a corpus,
+// by merging the most frequent pair of adjacent symbols, over all the words.
+// The letters of the words, with and without BPEEnd, are reserved in the
+// vocabulary, so it learns up to vocabSize minus their number merges, stopping
+// early if no pair occurs more than once, and it is an error if that leaves no
+// room for any merge. Ties are broken by the order of the pairs, so it does
+// not depend on the order of the map.
+func TrainBPE(counts map[string]int, vocabSize int) (*BPE, error) {
+	type bpeWord struct {
+		syms []string
+		n    int
+	}
+	words := make([]bpeWord, 0, len(counts))
+	letters := map[string]bool{}
+	for w, n := range counts {
+		syms := bpeSymbols(w)
+		for _, s := range syms {
+			letters[s] = true
+		}
+		words = append(words, bpeWord{syms, n})
+	}
+	nmerges := vocabSize - len(letters)
+	if nmerges <= 0 {
+		return nil, fmt.Errorf("TrainBPE: a vocabulary of %d leaves no room for merges beyond the %d letters of the corpus", vocabSize, len(letters))
+	}
+	var merges [][2]string
+	for len(merges) < nmerges {
+		pairs := map[[2]string]int{}
+		for _, w := range words {
+			for i := 0; i+1 < len(w.syms); i++ {
+				pairs[[2]string{w.syms[i], w.syms[i+1]}] += w.n
+			}
+		}
+		var best [2]string
+		bestN := 1
+		for p, n := range pairs {
+			if n > bestN || (n == bestN && n > 1 && (p[0] < best[0] || (p[0] == best[0] && p[1] < best[1]))) {
+				best, bestN = p, n
+			}
+		}
+		if bestN < 2 {
+			break
+		}
+		merges = append(merges, best)
+		for i := range words {
+			words[i].syms = mergePair(words[i].syms, best)
+		}
+	}
+	return NewBPE(merges), nil
+}
+
+// Encode returns the tokens of a word, by applying the merges to its letters
+// in order of priority.
+func (bp *BPE) Encode(word string) []string {
+	if toks, has := bp.cache[word]; has {
+		return toks
+	}
+	if bp.ranks == nil {
+		*bp = *NewBPE(bp.Merges)
+	}
+	syms := bpeSymbols(word)
+	for len(syms) > 1 {
+		best, bestRank := [2]string{}, -1
+		for i := 0; i+1 < len(syms); i++ {
+			if r, has := bp.ranks[[2]string{syms[i], syms[i+1]}]; has && (bestRank < 0 || r < bestRank) {
+				best, bestRank = [2]string{syms[i], syms[i+1]}, r
+			}
+		}
+		if bestRank < 0 {
+			break
+		}
+		syms = mergePair(syms, best)
+	}
+	if bp.cache == nil || len(bp.cache) >= bpeCacheMax {
+		bp.cache = make(map[string][]string)
+	}
+	bp.cache[word] = syms
+	return syms
+}
+
+// Tokens returns the tokens of all the words, in order.
+func (bp *BPE) Tokens(words []string) []string {
+	var toks []string
+	for _, w := range words {
+		toks = append(toks, bp.Encode(w)...)
+	}
+	return toks
+}
+
+// bpeHeader is the first line of a file of BPE merges, with the version of
+// its format.
+const bpeHeader = "#bpe merges v1"
+
+// Save saves the merges to the given file, after the bpeHeader line, one per
+// line, with the two symbols separated by a tab, in order of priority.
+func (bp *BPE) Save(fnm string) error {
+	f, err := os.Create(fnm)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, bpeHeader)
+	for _, m := range bp.Merges {
+		fmt.Fprintf(w, "%s\t%s\n", m[0], m[1])
+	}
+	return w.Flush()
+}
+
+// OpenBPE returns a BPE with the merges in the given file, as saved by Save.
+// Every line after the header is a merge, so symbols can start with "#".
+func OpenBPE(fnm string) (*BPE, error) {
+	f, err := os.Open(fnm)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var merges [][2]string
+	scan := bufio.NewScanner(f)
+	if !scan.Scan() || scan.Text() != bpeHeader {
+		if err := scan.Err(); err != nil {
+			return nil, fmt.Errorf("OpenBPE %s: %w", fnm, err)
+		}
+		return nil, fmt.Errorf("OpenBPE %s: not a file of BPE merges, the first line is not %q", fnm, bpeHeader)
+	}
+	for ln := 2; scan.Scan(); ln++ {
+		line := scan.Text()
+		if line == "" {
+			continue
+		}
+		fs := strings.Split(line, "\t")
+		if len(fs) != 2 {
+			return nil, fmt.Errorf("OpenBPE %s:%d: not a pair of symbols separated by a tab", fnm, ln)
+		}
+		merges = append(merges, [2]string{fs[0], fs[1]})
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("OpenBPE %s: %w", fnm, err)
+	}
+	return NewBPE(merges), nil
+}
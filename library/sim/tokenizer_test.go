@@ -0,0 +1,81 @@
+package sim_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/evec"
+)
+
+func TestBPE(t *testing.T) {
+	counts := map[string]int{"low": 5, "lower": 2, "newest": 6, "widest": 3}
+	bp, err := sim.TrainBPE(counts, 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if toks := bp.Encode("newest"); len(toks) != 1 || toks[0] != "newest"+sim.BPEEnd {
+		t.Errorf("a frequent word should be one token, not %v", toks)
+	}
+	toks := bp.Encode("lowest") // not in the counts
+	if len(toks) < 2 || strings.Join(toks, "") != "lowest"+sim.BPEEnd || toks[0] != "low" {
+		t.Errorf("wrong tokens of a new word: %v", toks)
+	}
+	if small, err := sim.TrainBPE(counts, 13); err != nil || len(small.Merges) != 13-11 { // 11 letters, with the ends of words
+		t.Errorf("not 2 merges for 13 tokens: %v", err)
+	}
+	if _, err := sim.TrainBPE(counts, 11); err == nil {
+		t.Errorf("expected an error for a vocabulary with no room for merges")
+	}
+
+	dir := t.TempDir()
+	fnm := filepath.Join(dir, "merges.bpe")
+	if err := bp.Save(fnm); err != nil {
+		t.Fatal(err)
+	}
+	op, err := sim.OpenBPE(fnm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(op.Merges) != len(bp.Merges) || strings.Join(op.Tokens([]string{"lowest", "newer"}), " ") != strings.Join(bp.Tokens([]string{"lowest", "newer"}), " ") {
+		t.Errorf("the merges are not the same after Save and OpenBPE")
+	}
+	hash := sim.NewBPE([][2]string{{"#", "1"}, {"#1", "2</w>"}})
+	if err := hash.Save(fnm); err != nil {
+		t.Fatal(err)
+	}
+	if op, err := sim.OpenBPE(fnm); err != nil || len(op.Merges) != 2 {
+		t.Errorf("the merges of symbols that start with # are lost after Save and OpenBPE: %v", err)
+	}
+	os.WriteFile(fnm, []byte("e\tr\n"), 0644)
+	if _, err := sim.OpenBPE(fnm); err == nil {
+		t.Errorf("expected an error for a file without the header")
+	}
+
+	// a CorpusEnv of subword tokens learned from its corpus
+	os.WriteFile(filepath.Join(dir, "corpus.txt"), []byte("the lowest newest widest\nthe low lower newest\n"), 0644)
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+	ev := sim.CorpusEnv{BPEFile: "corpus.bpe", MaxVocab: 20}
+	ev.Config("corpus.txt", evec.Vec2i{5, 5}, false, 1, 3, 10)
+	if _, ok := ev.Tokenizer.(*sim.BPE); !ok {
+		t.Fatalf("no BPE tokenizer")
+	}
+	if _, err := os.Stat("corpus.bpe"); err != nil {
+		t.Errorf("the merges were not saved: %v", err)
+	}
+	if len(ev.Words) > 20 {
+		t.Errorf("%d tokens, more than MaxVocab", len(ev.Words))
+	}
+	for _, tok := range ev.Tokenizer.Tokens([]string{"the", "lowest", "lower"}) {
+		if _, has := ev.WordMap[tok]; !has {
+			t.Errorf("token %s of the corpus is not in the vocabulary %v", tok, ev.Words)
+		}
+	}
+	if err := ev.Validate(); err != nil {
+		t.Error(err)
+	}
+}
@@ -7,6 +7,7 @@ type ThetaPhase struct {
 	Name             string // Might be plus or minus for example
 	Duration         int
 	IsPlusPhase      bool
+	SendAction       bool // Whether the actions of the Target layers are sent to the environment at the start of this phase, which then steps it -- see Sim.SendAction
 	OnMillisecondEnd func()
 	PhaseStart       func()
 	PhaseEnd         func()
@@ -21,6 +22,8 @@ type TrainingCallbacks struct {
 	OnEpochEnd        func()
 	OnTrialStart      func()
 	OnTrialEnd        func()
+	OnSeqStart        func() // at the start of the first trial of a sequence of a SequenceEnv
+	OnSeqEnd          func() // at the end of the last trial of a sequence of a SequenceEnv, after OnTrialEnd
 	OnThetaStart      func()
 	OnThetaEnd        func()
 	OnMillisecondEnd  func()
@@ -38,6 +41,7 @@ type Trainer struct {
 	CurEnv    *Environment `desc:"The current training environment. This should be synced with EvalMode."`
 	Callbacks []TrainingCallbacks
 	Phases    []ThetaPhase
+	Stacks    map[etime.Modes]*LoopStack `desc:"position of each mode in its loops, see Sim.SetMode"`
 }
 
 // Boiler-plate functions to prevent copy-pasting a for-loop.
@@ -90,6 +94,22 @@ func (trainer *Trainer) OnTrialEnd() {
 	}
 }
 
+func (trainer *Trainer) OnSeqStart() {
+	for _, callback := range trainer.Callbacks {
+		if callback.OnSeqStart != nil {
+			callback.OnSeqStart()
+		}
+	}
+}
+
+func (trainer *Trainer) OnSeqEnd() {
+	for _, callback := range trainer.Callbacks {
+		if callback.OnSeqEnd != nil {
+			callback.OnSeqEnd()
+		}
+	}
+}
+
 func (trainer *Trainer) OnThetaStart() {
 	for _, callback := range trainer.Callbacks {
 		if callback.OnThetaStart != nil {
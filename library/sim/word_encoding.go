@@ -0,0 +1,305 @@
+package sim
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/emer/etable/etensor"
+	"github.com/emer/etable/pca"
+)
+
+// WordEncoding is how the WordReps of a CorpusEnv are made. The random method
+// gives each word a random pattern, or a 1-hot one if Localist, so similar words
+// share no units. The other methods make a real-valued embedding of each word,
+// which is randomly projected onto the input units, if it has another size, and
+// binarized by turning on its NOn highest units, so that words with similar
+// embeddings share units:
+//   - cooc embeds the words by the SVD of their positive pointwise mutual
+//     information (PPMI) of co-occurrence within Window words in the corpus
+//   - charhash embeds the words by their character n-grams, each hashed onto a
+//     unit, so words with common parts, e.g., walk and walked, share units
+//   - file reads the embeddings from an external File, as of GloVe or word2vec.
+//
+// It can be set from a string with SetFromString, e.g., "cooc:Window=3".
+type WordEncoding struct {
+	Method string `desc:"encoding method: random, cooc, charhash or file -- random if empty"`
+	NOn    int    `desc:"[cooc, charhash, file] number of active units of each word -- if 0, from the DistPctAct of the env, or 4 if that is 0, as for random"`
+	Window int    `def:"2" desc:"[cooc] words up to this far on either side of a word co-occur with it"`
+	Dims   int    `desc:"[cooc] number of SVD dimensions of the embeddings -- all of them if 0"`
+	NGram  int    `def:"3" desc:"[charhash] length of the character n-grams, which include < and > at the start and end of words"`
+	File   string `desc:"[file] embeddings file, with a word followed by the values of its embedding on each line, separated by spaces -- a first line with just the numbers of words and dims, as in word2vec, is skipped. Words not in the file get random embeddings"`
+	Seed   int64  `def:"1" desc:"[cooc, charhash, file] seed of the random projection and hashing"`
+}
+
+// Defaults sets default values.
+func (we *WordEncoding) Defaults() {
+	we.Method = "random"
+	we.Window = 2
+	we.NGram = 3
+	we.Seed = 1
+}
+
+// SetFromString configures the encoding from a method name optionally followed
+// by a colon and comma-separated Field=Value settings, e.g., "charhash:NGram=4".
+func (we *WordEncoding) SetFromString(spec string) error {
+	ps := strings.SplitN(spec, ":", 2)
+	we.Method = strings.TrimSpace(ps[0])
+	switch we.Method {
+	case "", "random", "cooc", "charhash", "file":
+	default:
+		return fmt.Errorf("WordEncoding: unknown method %q -- must be random, cooc, charhash or file", we.Method)
+	}
+	if len(ps) == 1 {
+		return nil
+	}
+	if err := parseSpec(ps[1], we); err != nil {
+		return fmt.Errorf("WordEncoding: %v", err)
+	}
+	return nil
+}
+
+// IsRandom returns whether the method is random, which is done by ConfigWordReps.
+func (we *WordEncoding) IsRandom() bool {
+	return we.Method == "" || we.Method == "random"
+}
+
+// Embeddings returns an embedding of each of the Words of the env, in order.
+func (we *WordEncoding) Embeddings(ev *CorpusEnv) ([][]float64, error) {
+	switch we.Method {
+	case "cooc":
+		return we.CoocEmbeddings(ev)
+	case "charhash":
+		nin := ev.InputSize.X * ev.InputSize.Y
+		embs := make([][]float64, len(ev.Words))
+		for i, w := range ev.Words {
+			embs[i] = we.CharHashEmbedding(w, nin)
+		}
+		return embs, nil
+	case "file":
+		return we.FileEmbeddings(ev.Words)
+	}
+	return nil, fmt.Errorf("WordEncoding: no embeddings for method %q", we.Method)
+}
+
+// CoocEmbeddings returns the embeddings of the words of the env from the SVD
+// of the PPMI of their co-occurrence in its corpus. As the PPMI matrix is
+// symmetric, its SVD is its eigendecomposition, and the embedding of a word
+// is its row of the eigenvectors of the Dims largest eigenvalues, scaled by
+// the square root of their magnitude.
+func (we *WordEncoding) CoocEmbeddings(ev *CorpusEnv) ([][]float64, error) {
+	nw := len(ev.Words)
+	if nw == 0 {
+		return nil, fmt.Errorf("WordEncoding: no words to embed")
+	}
+	win := we.Window
+	if win <= 0 {
+		win = 2
+	}
+	cooc := make([]float64, nw*nw)
+	err := ev.readSentences(func(sent []string) {
+		words := ev.vocabWords(sent)
+		for i, w := range words {
+			wi := ev.WordMap[w]
+			for j := i + 1; j <= i+win && j < len(words); j++ {
+				wj := ev.WordMap[words[j]]
+				cooc[wi*nw+wj]++
+				cooc[wj*nw+wi]++
+			}
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	rsum := make([]float64, nw)
+	tot := 0.0
+	for i := 0; i < nw; i++ {
+		for j := 0; j < nw; j++ {
+			rsum[i] += cooc[i*nw+j]
+		}
+		tot += rsum[i]
+	}
+	ppmi := etensor.NewFloat64([]int{nw, nw}, nil, nil)
+	for i := 0; i < nw; i++ {
+		for j := 0; j < nw; j++ {
+			if c := cooc[i*nw+j]; c > 0 {
+				ppmi.Values[i*nw+j] = math.Max(0, math.Log(c*tot/(rsum[i]*rsum[j])))
+			}
+		}
+	}
+	pc := pca.PCA{}
+	pc.Init()
+	pc.Covar = ppmi
+	if err := pc.PCA(); err != nil {
+		return nil, err
+	}
+	dims := we.Dims
+	if dims <= 0 || dims > nw {
+		dims = nw
+	}
+	embs := make([][]float64, nw)
+	for i := range embs {
+		embs[i] = make([]float64, dims)
+		for d := 0; d < dims; d++ {
+			ei := nw - 1 - d // eigenvalues are in increasing order
+			embs[i][d] = pc.Vectors.Values[i*nw+ei] * math.Sqrt(math.Abs(pc.Values[ei]))
+		}
+	}
+	return embs, nil
+}
+
+// CharHashEmbedding returns the embedding of a word with n units, with 1 added
+// to the unit that each of its character n-grams hashes to.
+func (we *WordEncoding) CharHashEmbedding(word string, n int) []float64 {
+	ng := we.NGram
+	if ng <= 0 {
+		ng = 3
+	}
+	rs := []rune("<" + word + ">")
+	if len(rs) < ng {
+		ng = len(rs)
+	}
+	emb := make([]float64, n)
+	for i := 0; i+ng <= len(rs); i++ {
+		h := fnv.New64a()
+		fmt.Fprintf(h, "%d:%s", we.Seed, string(rs[i:i+ng]))
+		emb[h.Sum64()%uint64(n)]++
+	}
+	return emb
+}
+
+// FileEmbeddings reads the embeddings of the given words from the File, and
+// gives random ones, with the same number of dims, to the words not in it.
+// Only the lines of the words are kept, so the file can be larger than memory.
+func (we *WordEncoding) FileEmbeddings(words []string) ([][]float64, error) {
+	f, err := os.Open(we.File)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	idx := make(map[string]int, len(words))
+	for i, w := range words {
+		idx[w] = i
+	}
+	embs := make([][]float64, len(words))
+	dims := 0
+	scan := bufio.NewScanner(f)
+	scan.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for ln := 1; scan.Scan(); ln++ {
+		fs := strings.Fields(scan.Text())
+		if len(fs) < 2 {
+			continue
+		}
+		if _, err := strconv.Atoi(fs[0]); ln == 1 && len(fs) == 2 && err == nil { // word2vec header
+			continue
+		}
+		wi, has := idx[fs[0]]
+		if !has {
+			continue
+		}
+		if dims == 0 {
+			dims = len(fs) - 1
+		} else if len(fs)-1 != dims {
+			return nil, fmt.Errorf("WordEncoding %s:%d: %d values, not %d as before", we.File, ln, len(fs)-1, dims)
+		}
+		emb := make([]float64, dims)
+		for d := range emb {
+			if emb[d], err = strconv.ParseFloat(fs[d+1], 64); err != nil {
+				return nil, fmt.Errorf("WordEncoding %s:%d: %w", we.File, ln, err)
+			}
+		}
+		embs[wi] = emb
+	}
+	if err := scan.Err(); err != nil {
+		return nil, fmt.Errorf("WordEncoding %s: %w", we.File, err)
+	}
+	if dims == 0 {
+		return nil, fmt.Errorf("WordEncoding %s: none of the words are in the file", we.File)
+	}
+	nmiss := 0
+	for i, w := range words {
+		if embs[i] != nil {
+			continue
+		}
+		nmiss++
+		rnd := rand.New(rand.NewSource(we.Seed + int64(wordHash(w))))
+		embs[i] = make([]float64, dims)
+		for d := range embs[i] {
+			embs[i][d] = rnd.NormFloat64()
+		}
+	}
+	if nmiss > 0 {
+		fmt.Printf("WordEncoding: %d of %d words are not in %s, and have random embeddings\n", nmiss, len(words), we.File)
+	}
+	return embs, nil
+}
+
+// wordHash returns a hash of the word, to seed random values that are the
+// same for the same word.
+func wordHash(word string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(word))
+	return h.Sum32()
+}
+
+// Binarize sets each row of reps, whose first dim is that of embs, to the
+// binary pattern of the corresponding embedding, with the nOn units of the
+// highest values on. Embeddings of another size than the rows are first
+// projected onto them by a random Gaussian matrix. Ties are broken by tiny
+// random values, which are the same for the same word, so that a word with
+// fewer than nOn non-zero values still gets nOn units.
+func (we *WordEncoding) Binarize(reps *etensor.Float32, words []string, embs [][]float64, nOn int) {
+	n := reps.Len() / reps.Dim(0)
+	if nOn > n {
+		nOn = n
+	}
+	var proj [][]float64
+	if len(embs) > 0 && len(embs[0]) != n {
+		rnd := rand.New(rand.NewSource(we.Seed))
+		proj = make([][]float64, n)
+		for u := range proj {
+			proj[u] = make([]float64, len(embs[0]))
+			for d := range proj[u] {
+				proj[u][d] = rnd.NormFloat64()
+			}
+		}
+	}
+	vals := make([]float64, n)
+	order := make([]int, n)
+	for wi, emb := range embs {
+		scale := 0.0
+		for u := range vals {
+			if proj == nil {
+				vals[u] = emb[u]
+			} else {
+				vals[u] = 0
+				for d, pv := range proj[u] {
+					vals[u] += pv * emb[d]
+				}
+			}
+			scale = math.Max(scale, math.Abs(vals[u]))
+		}
+		if scale == 0 {
+			scale = 1
+		}
+		rnd := rand.New(rand.NewSource(we.Seed + int64(wordHash(words[wi]))))
+		for u := range vals {
+			vals[u] += 1e-6 * scale * rnd.Float64()
+			order[u] = u
+		}
+		sort.SliceStable(order, func(i, j int) bool { return vals[order[i]] > vals[order[j]] })
+		off := wi * n
+		for u := 0; u < n; u++ {
+			reps.Values[off+u] = 0
+		}
+		for _, u := range order[:nOn] {
+			reps.Values[off+u] = 1
+		}
+	}
+}
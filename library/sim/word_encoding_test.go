@@ -0,0 +1,55 @@
+package sim_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/Astera-org/models/library/sim"
+	"github.com/emer/emergent/evec"
+	"github.com/emer/etable/etensor"
+)
+
+func TestWordEncoding(t *testing.T) {
+	inTempDir(t)
+	// cat and dog are in the same contexts, and walking and walked share a stem
+	os.WriteFile("corpus.txt", []byte("the cat sat\nthe dog sat\na cat ran\na dog ran\nwalking walked\n"), 0644)
+	os.WriteFile("emb.txt", []byte("3 3\ncat 1 0.5 0\ndog 1 0.5 0.01\nsat -1 -0.5 0\n"), 0644)
+
+	overlap := func(ev *sim.CorpusEnv, a, b string) int {
+		ra := ev.WordReps.SubSpace([]int{ev.WordMap[a]}).(*etensor.Float32)
+		rb := ev.WordReps.SubSpace([]int{ev.WordMap[b]}).(*etensor.Float32)
+		n := 0
+		for i, v := range ra.Values {
+			if v == 1 && rb.Values[i] == 1 {
+				n++
+			}
+		}
+		return n
+	}
+	for _, spec := range []string{"cooc", "charhash:NGram=3", "file:File=emb.txt"} {
+		ev := sim.CorpusEnv{DistPctAct: 0.2}
+		if err := ev.Encoding.SetFromString(spec); err != nil {
+			t.Fatal(err)
+		}
+		ev.Config("corpus.txt", evec.Vec2i{10, 10}, false, 1, 3, 10)
+		for i := range ev.Words {
+			if n := overlap(&ev, ev.Words[i], ev.Words[i]); n != 10 {
+				t.Errorf("%s: %s has %d units on, not 10", spec, ev.Words[i], n)
+			}
+		}
+		switch ev.Encoding.Method {
+		case "cooc", "file":
+			if overlap(&ev, "cat", "dog") != 10 || overlap(&ev, "cat", "sat") > 2 {
+				t.Errorf("%s: cat and dog should be the same, and not like sat", spec)
+			}
+		case "charhash":
+			if overlap(&ev, "walking", "walked") <= overlap(&ev, "walking", "cat") {
+				t.Errorf("%s: walking and walked should overlap more than walking and cat", spec)
+			}
+		}
+	}
+	var we sim.WordEncoding
+	if err := we.SetFromString("glove"); err == nil {
+		t.Errorf("unknown method not an error")
+	}
+}
@@ -104,6 +104,8 @@ func (envhip *EnvHipBench) State(s string) etensor.Tensor {
 	return envhip.FixedTable.State(s)
 }
 
+func (envhip *EnvHipBench) Action(layerName string, act etensor.Tensor) {}
+
 func (envhip *EnvHipBench) Counter(scale env.TimeScales) (cur, prv int, chg bool) {
 	return envhip.FixedTable.Counter(scale)
 }
@@ -5,7 +5,6 @@ import (
 	"github.com/emer/emergent/env"
 	"github.com/emer/emergent/etime"
 	"github.com/emer/etable/etable"
-	"github.com/emer/etable/etensor"
 )
 
 type HipTableTypes string
@@ -31,8 +30,7 @@ type PatParams struct {
 }
 
 type EnvHip struct {
-	sim.Environment
-	env.FixedTable
+	sim.TableEnv
 	EvalTables       TableMaps `desc:"a map of tables used for handling stuff"`
 	Pat              PatParams
 	IsTest           bool    `desc:"Whether this is the Test environment or the Train"`
@@ -58,12 +56,6 @@ func (envhip *EnvHip) AssignTable(name string) {
 	envhip.CurrentTableName = name
 }
 
-func (envhip *EnvHip) SetName(name string) {
-	envhip.FixedTable.Nm = name
-}
-func (envhip *EnvHip) Name() string {
-	return envhip.FixedTable.Nm
-}
 func (envhip *EnvHip) SetDesc(desc string) {
 	// This does nothing! Don't call this method please!
 }
@@ -73,51 +65,13 @@ func (envhip *EnvHip) Desc() string {
 	return envhip.CurrentTableName
 }
 
-func (envhip *EnvHip) Order() []int {
-	return envhip.FixedTable.Order
-}
-func (envhip *EnvHip) Sequential() bool {
-	return envhip.FixedTable.Sequential
-}
-func (envhip *EnvHip) SetSequential(s bool) {
-	envhip.FixedTable.Sequential = s
-}
-
-func (envhip *EnvHip) Run() *env.Ctr {
-	return &envhip.FixedTable.Run
-}
 func (envhip *EnvHip) Epoch() *env.Ctr {
 	if envhip.IsTest {
 		return envhip.TrainEnv.Epoch()
 	}
 	return &envhip.FixedTable.Epoch
 }
-func (envhip *EnvHip) Trial() *env.Ctr {
-	return &envhip.FixedTable.Trial
-}
-func (envhip *EnvHip) TrialName() *env.CurPrvString {
-	return &envhip.FixedTable.TrialName
-}
-func (envhip *EnvHip) GroupName() *env.CurPrvString {
-	return &envhip.FixedTable.GroupName
-}
-func (envhip *EnvHip) NameCol() string {
-	return envhip.FixedTable.NameCol
-}
-func (envhip *EnvHip) SetNameCol(s string) {
-	envhip.FixedTable.NameCol = s
-}
-func (envhip *EnvHip) GroupCol() string {
-	return envhip.FixedTable.GroupCol
-}
-func (envhip *EnvHip) SetGroupCol(s string) {
-	envhip.FixedTable.GroupCol = s
-}
 
-func (envhip *EnvHip) Validate() error {
-
-	return envhip.FixedTable.Validate()
-}
 func (envhip *EnvHip) Init(run int) {
 	if !envhip.IsTest {
 		envhip.AssignTable("TrainAB")
@@ -127,25 +81,6 @@ func (envhip *EnvHip) Init(run int) {
 	envhip.Pat.Defaults()
 }
 
-func (envhip *EnvHip) CurTrialName() string {
-	return envhip.TrialName().Cur
-}
-func (envhip *EnvHip) Step() {
-	envhip.FixedTable.Step()
-}
-
-func (envhip *EnvHip) State(s string) etensor.Tensor {
-	return envhip.FixedTable.State(s)
-}
-
-func (envhip *EnvHip) Counter(scale env.TimeScales) (cur, prv int, chg bool) {
-	return envhip.FixedTable.Counter(scale)
-}
-
-func (envhip *EnvHip) InputAndOutputLayers() []string {
-	return []string{"Input", "ECout"}
-}
-
 func (envhip *EnvHip) AddTaskSwitching(ss *sim.Sim) *sim.TrainingCallbacks {
 
 	taskSwitching := sim.TrainingCallbacks{}
@@ -175,19 +110,21 @@ func (envhip *EnvHip) AddTaskSwitching(ss *sim.Sim) *sim.TrainingCallbacks {
 		}
 	}
 
-	taskSwitching.RunStopEarly = func() bool {
-		numberZero := ss.Stats.Int("HipNZero")
-		nzeroStop := ss.Stats.Int("NZeroStop")
-		learned := (numberZero > 0 && numberZero >= nzeroStop)
-
-		if envhip.EvalTables[TrainAC] == envhip.Table.Table {
-			if learned {
-				return true
+	ss.EarlyStop.Add(&sim.StopFunc{
+		Reason: "LearnedAC",
+		Func: func() bool {
+			numberZero := ss.Stats.Int("HipNZero")
+			nzeroStop := ss.Stats.Int("NZeroStop")
+			learned := (numberZero > 0 && numberZero >= nzeroStop)
+
+			if envhip.EvalTables[TrainAC] == envhip.Table.Table {
+				if learned {
+					return true
+				}
 			}
-		}
-		return false
-
-	}
+			return false
+		},
+	})
 
 	return &taskSwitching
 }
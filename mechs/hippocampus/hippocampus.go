@@ -27,13 +27,11 @@ import (
 	"github.com/goki/ki/ki"
 	"github.com/goki/ki/kit"
 	"log"
+	"os"
 )
 
 var ProgramName = "Hippocampus"
 
-var TestEnvHip = EnvHip{IsTest: true}
-var TrainEnvHip = EnvHip{}
-
 // TrialStats computes the trial-level statistics and adds them to the epoch accumulators if
 // accum is true.  Note that we're accumulating stats here on the Sim side so the
 // core algorithm side remains as simple as possible, and doesn't need to worry about
@@ -87,7 +85,10 @@ func main() {
 			// TODO This might not be the behavior we want! PreTrain needs to be refactored, though.
 			//PreTrain(&TheSim.Sim)
 		}
-		TheSim.RunFromArgs()
+		if err := TheSim.RunFromArgs(); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	} else {
 		gimain.Main(func() { // this starts gui -- requires valid OpenGL display connection (e.g., X11)
 			window := TheSim.ConfigGui(ProgramName, "Hippocampus AB-AC", `This demonstrates a basic Hippocampus model in Axon. See <a href="https://github.com/emer/emergent">emergent on GitHub</a>.</p>`)
@@ -109,21 +110,25 @@ func OpenPat(dt *etable.Table, fname, name, desc string) {
 }
 
 func OpenFixedPatterns(ss *HipSim) {
-	OpenPat(TrainEnvHip.EvalTables[TrainAB], "hippoinputs/trainab.tsv", "TrainAB", "")
-	OpenPat(TrainEnvHip.EvalTables[TrainAC], "hippoinputs/trainac.tsv", "TrainAC", "")
-	OpenPat(TrainEnvHip.EvalTables[TrainAll], "hippoinputs/trainall.tsv", "TrainAll", "")
+	trainEnv := ss.TrainEnv.(*EnvHip)
+	testEnv := ss.TestEnv.(*EnvHip)
+	OpenPat(trainEnv.EvalTables[TrainAB], "hippoinputs/trainab.tsv", "TrainAB", "")
+	OpenPat(trainEnv.EvalTables[TrainAC], "hippoinputs/trainac.tsv", "TrainAC", "")
+	OpenPat(trainEnv.EvalTables[TrainAll], "hippoinputs/trainall.tsv", "TrainAll", "")
 
-	OpenPat(TestEnvHip.EvalTables[TestAB], "hippoinputs/testab.tsv", "TestAB", "")
-	OpenPat(TestEnvHip.EvalTables[TestAC], "hippoinputs/testac.tsv", "TestAC", "")
-	OpenPat(TestEnvHip.EvalTables[TestLure], "hippoinputs/testlure.tsv", "TestLure", "")
+	OpenPat(testEnv.EvalTables[TestAB], "hippoinputs/testab.tsv", "TestAB", "")
+	OpenPat(testEnv.EvalTables[TestAC], "hippoinputs/testac.tsv", "TestAC", "")
+	OpenPat(testEnv.EvalTables[TestLure], "hippoinputs/testlure.tsv", "TestLure", "")
 
 }
 
 // Config configures all the elements using the standard functions
 func Config(ss *HipSim) {
 	// These need to be initialized before ConfigPats
-	TrainEnvHip.InitTables(TrainAB, TrainAC, PretrainLure, TrainAll)
-	TestEnvHip.InitTables(TestAB, TestAC, TestLure)
+	trainEnv, testEnv := &EnvHip{}, &EnvHip{IsTest: true}
+	trainEnv.InitTables(TrainAB, TrainAC, PretrainLure, TrainAll)
+	testEnv.InitTables(TestAB, TestAC, TestLure)
+	ss.TrainEnv, ss.TestEnv = trainEnv, testEnv
 
 	ConfigPats(ss)
 	//OpenFixedPatterns(ss) //todo ths is for debugging, shoudl be removed later
@@ -139,6 +144,14 @@ func Config(ss *HipSim) {
 	ConfigParams(&ss.Sim)
 	// Parse arguments before configuring the network and env, in case parameters are set.
 	ss.ParseArgs()
+	ConfigSim(ss)
+	ss.NewSimFunc = func(args sim.CmdArgs) *sim.Sim {
+		return &NewParallelSim(ss, args).Sim
+	}
+}
+
+// ConfigSim configures everything that depends on the command line args.
+func ConfigSim(ss *HipSim) {
 	ConfigEnv(ss)
 
 	ss.TestInterval = 1
@@ -150,10 +163,26 @@ func Config(ss *HipSim) {
 	common.AddDefaultTrainCallbacks(&ss.Sim)
 	AddHipCallbacks(ss)
 
-	conditionEnvs := TrainEnvHip.AddTaskSwitching(&ss.Sim)
+	conditionEnvs := ss.TrainEnv.(*EnvHip).AddTaskSwitching(&ss.Sim)
 	ss.Trainer.Callbacks = append(ss.Trainer.Callbacks, *conditionEnvs)
 }
 
+// NewParallelSim makes a copy of ss, with its own network and environments,
+// for doing runs in parallel with the given args. The pattern tables are shared.
+func NewParallelSim(ss *HipSim, args sim.CmdArgs) *HipSim {
+	ps := &HipSim{}
+	ps.New()
+	ps.Hip = ss.Hip
+	ps.Pat = ss.Pat
+	ps.PoolVocab = ss.PoolVocab
+	ps.TrainEnv = &EnvHip{EvalTables: ss.TrainEnv.(*EnvHip).EvalTables}
+	ps.TestEnv = &EnvHip{IsTest: true, EvalTables: ss.TestEnv.(*EnvHip).EvalTables}
+	ConfigParams(&ps.Sim)
+	ps.ShareConfig(&ss.Sim, args)
+	ConfigSim(ps)
+	return ps
+}
+
 func ConfigGui(ss *HipSim) {
 	// TODO Add a separator to put this in its own section.
 	ss.GUI.AddToolbarItem(egui.ToolbarItem{Label: "PreTrain",
@@ -211,9 +240,9 @@ func ConfigGui(ss *HipSim) {
 //// 		Configs
 
 func ConfigEnv(ss *HipSim) {
-	ss.TestEnv = &TestEnvHip
-	ss.TrainEnv = &TrainEnvHip
-	TestEnvHip.TrainEnv = &TrainEnvHip
+	trainEnv := ss.TrainEnv.(*EnvHip)
+	testEnv := ss.TestEnv.(*EnvHip)
+	testEnv.TrainEnv = trainEnv
 	ss.CmdArgs.PreTrainEpcs = 10    //from hip sim
 	ss.Stats.SetInt("NZeroStop", 1) //TODO move this, should be a command line args
 	ss.TrialStatsFunc = TrialStats
@@ -221,26 +250,21 @@ func ConfigEnv(ss *HipSim) {
 	// TODO PCA seems to hang in internal Dlatrd function for hippocampus.
 	ss.PCAInterval = -1
 
-	TrainEnvHip.Nm = "TrainEnv"
-	TrainEnvHip.Dsc = "training params and state"
-
-	TrainEnvHip.Table = etable.NewIdxView(TrainEnvHip.EvalTables[TrainAB])
-	TrainEnvHip.CurrentTableName = string(TrainAB)
+	trainEnv.Config("TrainEnv", "training params and state", etable.NewIdxView(trainEnv.EvalTables[TrainAB]), "Input", "ECout")
+	trainEnv.CurrentTableName = string(TrainAB)
 	// to simulate training items in order, uncomment this line:
 	// ss.TrainEnv.Sequential = true
-	TrainEnvHip.SetSequential(true) //todo this should be removed, this is done to compare between original and old
-	TrainEnvHip.Validate()
+	trainEnv.SetSequential(true) //todo this should be removed, this is done to compare between original and old
+	trainEnv.Validate()
 	ss.Run.Max = ss.CmdArgs.MaxRuns
 	ss.Run.Cur = ss.CmdArgs.StartRun
-	TrainEnvHip.Epoch().Max = ss.CmdArgs.MaxEpcs
+	trainEnv.Epoch().Max = ss.CmdArgs.MaxEpcs
 
 	// MaxEpcs is consulted for early stopping in TrainTrial and is split between AB and AC
 
-	TestEnvHip.Nm = "TestEnv"
-	TestEnvHip.Dsc = "testing params and state"
-	TestEnvHip.Table = etable.NewIdxView(TestEnvHip.EvalTables[TestAB])
-	TestEnvHip.CurrentTableName = string(TestAB)
-	TestEnvHip.SetSequential(true)
+	testEnv.Config("TestEnv", "testing params and state", etable.NewIdxView(testEnv.EvalTables[TestAB]), "Input", "ECout")
+	testEnv.CurrentTableName = string(TestAB)
+	testEnv.SetSequential(true)
 	ss.TestEnv.Validate()
 
 	ss.TrainEnv.Init(ss.CmdArgs.StartRun)
@@ -252,8 +276,8 @@ func ConfigEnv(ss *HipSim) {
 //ConfigPats used to configure patterns
 func ConfigPats(ss *HipSim) {
 
-	trainEnv := &TrainEnvHip
-	testEnv := &TestEnvHip
+	trainEnv := ss.TrainEnv.(*EnvHip)
+	testEnv := ss.TestEnv.(*EnvHip)
 	hp := &ss.Hip
 	ecY := hp.ECSize.Y
 	ecX := hp.ECSize.X
@@ -560,9 +584,9 @@ func testEpochHip(ss *sim.Sim) {
 }
 
 // TestAllConditions does a single epoch of testing.
+// The previous mode is restored at the end.
 func TestAllConditions(ss *sim.Sim) {
-	ss.Trainer.EvalMode = etime.Test
-	ss.Trainer.CurEnv = &ss.TestEnv
+	prv := ss.SetMode(etime.Test)
 	ss.Logs.ResetLog(etime.Test, etime.Trial)
 
 	ss.TestEnv.AssignTable(string(TestAB))
@@ -580,6 +604,7 @@ func TestAllConditions(ss *sim.Sim) {
 
 	// Log only after all conditions have been tested.
 	ss.Log(ss.Trainer.EvalMode, etime.Epoch)
+	ss.SetMode(prv)
 }
 
 func AddHipCallbacks(ss *HipSim) {
@@ -590,8 +615,6 @@ func AddHipCallbacks(ss *HipSim) {
 				if (ss.TestInterval > 0) && ((ss.TrainEnv.Epoch().Cur+1)%ss.TestInterval == 0) {
 					// Unlike some testing setups, we only do one epoch of test instead of a whole run.
 					TestAllConditions(&ss.Sim)
-					ss.Trainer.EvalMode = etime.Train // Important to set these back because TestEpoch sets them to Test.
-					ss.Trainer.CurEnv = &ss.TrainEnv
 				}
 			}
 		},
@@ -13,6 +13,7 @@ import (
 	"fmt"
 	"github.com/Astera-org/models/library/common"
 	"log"
+	"os"
 	"strconv"
 
 	"github.com/Astera-org/models/library/sim"
@@ -29,10 +30,7 @@ import (
 
 type Input2OutputCount map[string]map[string]int
 
-var InputOutputCounts = Input2OutputCount{}
-var InputPredictedCounts = Input2OutputCount{}
-
-func calculateInputOutputCounts(table *etable.Table) {
+func calculateInputOutputCounts(InputOutputCounts Input2OutputCount, table *etable.Table) {
 	var nameIds = table.ColByName("Name").(*etensor.String)
 	for row, name := range nameIds.Values {
 		indexMap := InputOutputCounts[name]
@@ -47,7 +45,7 @@ func calculateInputOutputCounts(table *etable.Table) {
 }
 
 //Could also do this in the end of the theta cycle and take slices every N cycle
-func addToInputPredictedCounts(name, row string) {
+func addToInputPredictedCounts(InputPredictedCounts Input2OutputCount, name, row string) {
 	indexMap, exists := InputPredictedCounts[name]
 	if exists == false {
 		InputPredictedCounts[name] = make(map[string]int)
@@ -101,7 +99,7 @@ func KLDiverge(trueDistribution, predDistribution map[string]float64) float64 {
 	return diverge
 }
 
-func alignInputOutput(name string) {
+func alignInputOutput(InputOutputCounts, InputPredictedCounts Input2OutputCount, name string) {
 	groundTruthMap, _ := InputOutputCounts[name]
 	predictedMap, _ := InputPredictedCounts[name]
 	//Add zeros for values that exist in predictedMap but not in ground truth map
@@ -122,15 +120,14 @@ func alignInputOutput(name string) {
 
 var ProgramName = "One2Many"
 
-var TestEnv = EnvOne2Many{}
-var TrainEnv = EnvOne2Many{}
-
 // TrialStats computes the trial-level statistics and adds them to the epoch accumulators if
 // accum is true.  Note that we're accumulating stats here on the Sim side so the
 // core algorithm side remains as simple as possible, and doesn't need to worry about
 // different time-scales over which stats could be accumulated etc.
 // You can also aggregate directly from log data, as is done for testing stats
-func TrialStats(ss *sim.Sim, accum bool) {
+// It is the TrialStatsFunc of the embedded sim.Sim, which is passed as ss, and
+// also counts the closest patterns in the InputPredictedCounts of o2s.
+func (o2s *One2Sim) TrialStats(ss *sim.Sim, accum bool) {
 	out := ss.Net.LayerByName("Output").(axon.AxonLayer).AsAxon()
 
 	ss.Stats.SetFloat("TrlCosDiff", float64(out.CosDiff.Cos))
@@ -153,15 +150,16 @@ func TrialStats(ss *sim.Sim, accum bool) {
 		ss.Stats.SetFloat("TrlErr", 1)
 	}
 
-	addToInputPredictedCounts(cnm, strconv.Itoa(row)) //Alternatively, I could only measure the values that are part of it
-	if TrainEnv.Epoch().Cur > 2 {
-		if TrainEnv.Epoch().Chg == true {
+	addToInputPredictedCounts(o2s.InputPredictedCounts, cnm, strconv.Itoa(row)) //Alternatively, I could only measure the values that are part of it
+	epc := ss.TrainEnv.Epoch()
+	if epc.Cur > 2 {
+		if epc.Chg == true {
 			//normedOutputDistr := calculateNorms(InputOutputCounts)
 			//normedPredDistr := calculateNorms(InputPredictedCounts)
 
-			if TrainEnv.Epoch().Cur%2 == 0 {
+			if epc.Cur%2 == 0 {
 				//result := KlDivergeAcross(normedOutputDistr, normedPredDistr)
-				InputPredictedCounts = make(Input2OutputCount) //Calculate input output counts for doing KL
+				o2s.InputPredictedCounts = make(Input2OutputCount) //Calculate input output counts for doing KL
 				//fmt.Println(result)
 			}
 
@@ -176,13 +174,12 @@ type One2Sim struct {
 	// Specific to the one2many module
 	NInputs  int `desc:"Number of input/output pattern pairs"`
 	NOutputs int `desc:"The number of output patterns potentially associated with each input pattern."`
+
+	InputOutputCounts    Input2OutputCount `view:"-" desc:"for each input name, the count of each of its output rows in the patterns"`
+	InputPredictedCounts Input2OutputCount `view:"-" desc:"for each closest pattern name, the count of each of the rows predicted in the trials -- reset every other epoch"`
 }
 
 func main() {
-
-	InputPredictedCounts = make(Input2OutputCount) //Calculate input output counts for doing KL
-	InputOutputCounts = make(Input2OutputCount)    //calculate input predicted counts for doing KL
-
 	// TheSim is the overall state for this simulation
 	var TheSim One2Sim
 	TheSim.New()
@@ -192,7 +189,10 @@ func main() {
 	Config(&TheSim)
 
 	if TheSim.CmdArgs.NoGui {
-		TheSim.RunFromArgs() // simple assumption is that any args = no gui -- could add explicit arg if you want
+		if err := TheSim.RunFromArgs(); err != nil { // simple assumption is that any args = no gui -- could add explicit arg if you want
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	} else {
 		gimain.Main(func() { // this starts gui -- requires valid OpenGL display connection (e.g., X11)
 			window := TheSim.ConfigGui(ProgramName, "One to Many", `demonstrates basic one to many for axon model`)
@@ -206,11 +206,22 @@ func main() {
 func Config(ss *One2Sim) {
 	ConfigPats(ss)
 	OpenPats(&ss.Sim)
-	calculateInputOutputCounts(ss.Pats)
 	ConfigParams(&ss.Sim)
 	// Parse arguments before configuring the network and env, in case parameters are set.
 	ss.ParseArgs()
+	ConfigSim(ss)
+	ss.NewSimFunc = func(args sim.CmdArgs) *sim.Sim {
+		return &NewParallelSim(ss, args).Sim
+	}
+}
+
+// ConfigSim configures everything that depends on the command line args.
+func ConfigSim(ss *One2Sim) {
+	ss.InputPredictedCounts = make(Input2OutputCount) //Calculate input output counts for doing KL
+	ss.InputOutputCounts = make(Input2OutputCount)    //calculate input predicted counts for doing KL
+	calculateInputOutputCounts(ss.InputOutputCounts, ss.Pats)
 	ConfigEnv(&ss.Sim)
+	ss.TrialStatsFunc = ss.TrialStats
 	ConfigNet(&ss.Sim, ss.Net)
 	ss.InitStats()
 	ss.ConfigLogItems()
@@ -219,6 +230,18 @@ func Config(ss *One2Sim) {
 	common.AddSimpleCallbacks(&ss.Sim)
 }
 
+// NewParallelSim makes a copy of ss, with its own network and environments,
+// for doing runs in parallel with the given args. The patterns are shared.
+func NewParallelSim(ss *One2Sim, args sim.CmdArgs) *One2Sim {
+	ps := &One2Sim{NInputs: ss.NInputs, NOutputs: ss.NOutputs}
+	ps.New()
+	ps.Pats = ss.Pats
+	ConfigParams(&ps.Sim)
+	ps.ShareConfig(&ss.Sim, args)
+	ConfigSim(ps)
+	return ps
+}
+
 // ConfigParams configure the parameters
 func ConfigParams(ss *sim.Sim) {
 	ss.Params.AddNetwork(ss.Net)
@@ -393,34 +416,26 @@ func ConfigParams(ss *sim.Sim) {
 //// 		Configs
 
 func ConfigEnv(ss *sim.Sim) {
-
-	ss.TestEnv = &TestEnv
-	ss.TrainEnv = &TrainEnv
-
-	ss.TrialStatsFunc = TrialStats
+	TrainEnv := &sim.TableEnv{}
+	TestEnv := &sim.TableEnv{}
+	ss.TestEnv = TestEnv
+	ss.TrainEnv = TrainEnv
 
 	ss.NZeroStop = 5
 
-	TrainEnv.Nm = "TrainEnv"
-	TrainEnv.Dsc = "training params and state"
-	TrainEnv.Table = etable.NewIdxView(ss.Pats)
+	TrainEnv.Config("TrainEnv", "training params and state", etable.NewIdxView(ss.Pats), "Input", "Output")
 	ss.TrainEnv.Validate()
 	ss.Run.Max = ss.CmdArgs.MaxRuns // note: we are not setting epoch max -- do that manually
 	TrainEnv.Epoch().Max = ss.CmdArgs.MaxEpcs
 
-	TestEnv.Nm = "TestEnv"
-	TestEnv.Dsc = "testing params and state"
-	TestEnv.Table = etable.NewIdxView(ss.Pats)
+	TestEnv.Config("TestEnv", "testing params and state", etable.NewIdxView(ss.Pats), "Input", "Output")
 	TestEnv.SetSequential(true)
 	ss.TestEnv.Validate()
 	TestEnv.Epoch().Max = ss.CmdArgs.MaxEpcs
 	TestEnv.Run().Max = ss.CmdArgs.MaxRuns
 
-	// note: to create a train / test split of pats, do this:
-	// all := etable.NewIdxView(ss.Pats)
-	// splits, _ := split.Permuted(all, []float64{.8, .2}, []string{"Train", "Test"})
-	// ss.TrainEnv.Table = splits.Splits[0]
-	// ss.TestEnv.Table = splits.Splits[1]
+	// note: to hold out some of the pats from training, to test generalization,
+	// use the -split flag, or set ss.Split -- see sim.PatSplit
 
 	ss.TrainEnv.Init(0)
 	ss.TestEnv.Init(0)
@@ -54,3 +54,28 @@ func SimpleTest(t *testing.T) {
 		t.Errorf("oh no!")
 	}
 }
+
+func TestNewParallelSim(t *testing.T) {
+	ss := &One2Sim{NInputs: 3, NOutputs: 2}
+	ss.New()
+	ss.CmdArgs.MaxRuns = 1
+	ss.CmdArgs.MaxEpcs = 2
+	ss.CmdArgs.RndSeeds = []int64{1}
+	ConfigPats(ss)
+	ConfigParams(&ss.Sim)
+	ConfigSim(ss)
+	ps := NewParallelSim(ss, ss.CmdArgs)
+	if ps.Pats != ss.Pats || ps.NInputs != 3 || ps.NOutputs != 2 {
+		t.Errorf("the parallel sim does not share the patterns and their numbers")
+	}
+	if ps.Net == ss.Net || ps.TrainEnv == ss.TrainEnv || ps.Rand == ss.Rand {
+		t.Errorf("the parallel sim shares the network, env or random source")
+	}
+	ps.InputPredictedCounts["x"] = map[string]int{"0": 1}
+	if len(ss.InputPredictedCounts) != 0 || len(ps.InputOutputCounts) != len(ss.InputOutputCounts) {
+		t.Errorf("the parallel sim shares the predicted counts, or does not count the patterns")
+	}
+	if len(ps.Net.Layers) != len(ss.Net.Layers) || ps.TrainEnv.Trial().Max != ss.Pats.Rows {
+		t.Errorf("the parallel sim is not configured like the sim")
+	}
+}
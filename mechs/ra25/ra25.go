@@ -21,8 +21,8 @@ package main
 //	"github.com/goki/gi/gimain"
 //)
 //
-//var TestEnv = EnvRa25{}
-//var TrainEnv = EnvRa25{}
+//var TestEnv = sim.TableEnv{}
+//var TrainEnv = sim.TableEnv{}
 //
 //var programName = "RA25"
 //var sizeOfGrid = 6 // By default, 5 by 5 is 25
@@ -22,11 +22,9 @@ import (
 	"github.com/goki/gi/gi"
 	"github.com/goki/gi/gimain"
 	"log"
+	"os"
 )
 
-var TestEnv = EnvRa25{}
-var TrainEnv = EnvRa25{}
-
 var programName = "RA25"
 var sizeOfGrid = 6 // By default, 5 by 5 is 25
 var numOn = 6      // Number of bits set to 1 in each pattern
@@ -59,7 +57,10 @@ func main() {
 	Config(&TheSim)
 
 	if TheSim.CmdArgs.NoGui {
-		TheSim.RunFromArgs() // simple assumption is that any args = no gui -- could add explicit arg if you want
+		if err := TheSim.RunFromArgs(); err != nil { // simple assumption is that any args = no gui -- could add explicit arg if you want
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	} else {
 		gimain.Main(func() { // this starts gui -- requires valid OpenGL display connection (e.g., X11)
 			window := TheSim.ConfigGui(programName, "RA25", "random mapping")
@@ -73,8 +74,17 @@ func Config(ss *sim.Sim) {
 	ConfigPats(ss)
 	//OpenPats(ss)
 	ConfigParams(ss)
+	ss.Expect = "FirstZero < 100; LastZero < 100" // can be changed with -expect
 	// Parse arguments before configuring the network and env, in case parameters are set.
 	ss.ParseArgs()
+	ConfigSim(ss)
+	ss.NewSimFunc = func(args sim.CmdArgs) *sim.Sim {
+		return NewParallelSim(ss, args)
+	}
+}
+
+// ConfigSim configures everything that depends on the command line args.
+func ConfigSim(ss *sim.Sim) {
 	ConfigEnv(ss)
 	ConfigNet(ss, ss.Net)
 	ss.InitStats()
@@ -82,7 +92,18 @@ func Config(ss *sim.Sim) {
 	ss.ConfigLogs()
 	common.AddDefaultTrainCallbacks(ss)
 	common.AddSimpleCallbacks(ss)
+}
 
+// NewParallelSim makes a copy of ss, with its own network and environments,
+// for doing runs in parallel with the given args. The patterns are shared.
+func NewParallelSim(ss *sim.Sim, args sim.CmdArgs) *sim.Sim {
+	ps := &sim.Sim{}
+	ps.New()
+	ps.Pats = ss.Pats
+	ConfigParams(ps)
+	ps.ShareConfig(ss, args)
+	ConfigSim(ps)
+	return ps
 }
 
 // ConfigParams configure the parameters
@@ -206,34 +227,28 @@ func ApplyInputs(ss *sim.Sim, env envlp.Envs) {
 //// 		Configs
 
 func ConfigEnv(ss *sim.Sim) {
-
-	ss.TestEnv = &TestEnv
-	ss.TrainEnv = &TrainEnv
+	TrainEnv := &sim.TableEnv{}
+	TestEnv := &sim.TableEnv{}
+	ss.TestEnv = TestEnv
+	ss.TrainEnv = TrainEnv
 
 	ss.TrialStatsFunc = TrialStats
 
 	ss.NZeroStop = 5
 
-	TrainEnv.Nm = "TrainEnv"
-	TrainEnv.Dsc = "training params and state"
-	TrainEnv.Table = etable.NewIdxView(ss.Pats)
+	TrainEnv.Config("TrainEnv", "training params and state", etable.NewIdxView(ss.Pats), "Input", "Output")
 	ss.TrainEnv.Validate()
 	ss.Run.Max = ss.CmdArgs.MaxRuns // note: we are not setting epoch max -- do that manually
 	TrainEnv.Epoch().Max = ss.CmdArgs.MaxEpcs
 
-	TestEnv.Nm = "TestEnv"
-	TestEnv.Dsc = "testing params and state"
-	TestEnv.Table = etable.NewIdxView(ss.Pats)
+	TestEnv.Config("TestEnv", "testing params and state", etable.NewIdxView(ss.Pats), "Input", "Output")
 	TestEnv.SetSequential(true)
 	ss.TestEnv.Validate()
 	TestEnv.Epoch().Max = ss.CmdArgs.MaxEpcs
 	TestEnv.Run().Max = ss.CmdArgs.MaxRuns
 
-	// note: to create a train / test split of pats, do this:
-	// all := etable.NewIdxView(ss.Pats)
-	// splits, _ := split.Permuted(all, []float64{.8, .2}, []string{"Train", "Test"})
-	// ss.TrainEnv.Table = splits.Splits[0]
-	// ss.TestEnv.Table = splits.Splits[1]
+	// note: to hold out some of the pats from training, to test generalization,
+	// use the -split flag, or set ss.Split -- see sim.PatSplit
 
 	ss.TrainEnv.Init(0)
 	ss.TestEnv.Init(0)
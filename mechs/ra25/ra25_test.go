@@ -32,7 +32,7 @@ func TestConfigPats(t *testing.T) {
 }
 
 // In GoLand, right-click the play triangle by this method and select "Profile TestModelTraining with 'CPU Profiler'"s
-// TODO Modify this test to ensure that LastZero is achieved in under 100 epochs
+// It checks the expectations of the model, see Config.
 func TestModelTraining(t *testing.T) {
 	var TheSim sim.Sim
 	TheSim.New()
@@ -41,13 +41,10 @@ func TestModelTraining(t *testing.T) {
 	os.Args = append(os.Args, "-runs=1")
 	os.Args = append(os.Args, "-epochs=100")
 	Config(&TheSim)
-	TheSim.RunFromArgs()
+	err := TheSim.RunFromArgs()
 	runlog := TheSim.Logs.Table(etime.Train, etime.Run)
 	println(fmt.Sprintf("FirstZero: %.0f\tLastZero: %.0f", runlog.CellFloat("FirstZero", 0), runlog.CellFloat("LastZero", 0)))
-	if runlog.CellFloat("FirstZero", 0) < 0 {
-		t.Errorf("No FirstZero!")
-	}
-	if runlog.CellFloat("LastZero", 0) < 0 {
-		t.Errorf("No LastZero!")
+	if err != nil {
+		t.Error(err)
 	}
 }
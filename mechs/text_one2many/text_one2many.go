@@ -9,8 +9,11 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"github.com/Astera-org/models/library/common"
 	"log"
+	"os"
 	"strings"
 
 	"github.com/Astera-org/models/library/sim"
@@ -35,7 +38,10 @@ func main() {
 	Config(&TheSim)
 
 	if TheSim.CmdArgs.NoGui {
-		TheSim.RunFromArgs() // simple assumption is that any args = no gui -- could add explicit arg if you want
+		if err := TheSim.RunFromArgs(); err != nil { // simple assumption is that any args = no gui -- could add explicit arg if you want
+			fmt.Println(err)
+			os.Exit(1)
+		}
 	} else {
 		gimain.Main(func() { // this starts gui -- requires valid OpenGL display connection (e.g., X11)
 
@@ -45,8 +51,40 @@ func main() {
 	}
 }
 
-var TrainEnv = EnvText2Many{}
-var TestEnv = EnvText2Many{}
+// CorpusFile is the text the envs read, as plain text with one sentence per
+// line, or JSON with a Sentences list, either of them optionally gzipped.
+// It is set with the -corpus flag.
+var CorpusFile = "data/cbt_train_filt.json"
+
+// TestCorpusFile is the held-out text the test env reads, in the same formats
+// as the CorpusFile, on which the network and the n-gram baseline, which is
+// counted on the CorpusFile, are evaluated. It is set with the -testcorpus flag.
+// If it is empty, there is no held-out evaluation: the test env reads the
+// CorpusFile.
+var TestCorpusFile = ""
+
+// VocabFile is the vocabulary of the CorpusFile, which is made from it, and
+// saved, if the file does not exist. It is set with the -vocab flag.
+var VocabFile = "stored_vocab_cbt_train.json"
+
+// BPEFile, if set, is the file of the BPE merges that split the words of the
+// CorpusFile into subword tokens, which are learned from it if the file does
+// not exist. It is set with the -bpe flag.
+var BPEFile = ""
+
+// WordEncoding is how the words are encoded as input patterns, as a method of
+// sim.WordEncoding optionally followed by :Field=Value settings of it.
+// It is set with the -wordenc flag.
+var WordEncoding = "random"
+
+// Sequence is whether the envs present the words of the corpus in order, one
+// per trial, to predict the next word of the sentence, instead of a random walk
+// through the NGrams. It is set with the -sequence flag.
+var Sequence = false
+
+// NContext is the number of words in the Input: the current word and the
+// words before it. It is set with the -ncontext flag.
+var NContext = 1
 
 // TrialStats computes the trial-level statistics and adds them to the epoch accumulators if
 // accum is true.  Note that we're accumulating stats here on the Sim side so the
@@ -63,23 +101,43 @@ func TrialStats(ss *sim.Sim, accum bool) {
 	ss.Stats.SetString("TrlClosest", closestWord)
 	ss.Stats.SetFloat("TrlCorrel", float64(cor))
 
-	contextWords := strings.Join(TrainEnv.CurWords, " ")
+	trainEnv := ss.TrainEnv.(*sim.CorpusEnv)
+	contextWords := strings.Join(trainEnv.CurWords, " ")
 
 	//Check if the closest word that is found is one of the potential following words
-	_, ok := TrainEnv.NGrams[contextWords][closestWord]
+	_, ok := trainEnv.NGrams[contextWords][closestWord]
 	if ok {
 		ss.Stats.SetFloat("TrlErr", 1)
 	} else {
 		ss.Stats.SetFloat("TrlErr", 0)
 	}
+	if !accum { // testing
+		ss.NGramEvalRecord()
+	}
 }
 
 // Config configures all the elements using the standard functions
 func Config(ss *sim.Sim) {
 	ConfigParams(ss)
+	flag.StringVar(&CorpusFile, "corpus", CorpusFile, "corpus file, as plain text with one sentence per line, or JSON with a Sentences list of lists of words, optionally gzipped (.gz) -- it is read as a stream, so it can be larger than memory")
+	flag.StringVar(&TestCorpusFile, "testcorpus", TestCorpusFile, "held-out corpus file for testing, in the same formats as -corpus -- the n-gram baseline is counted on the -corpus and evaluated on it, like the network. If empty, testing is on the -corpus, with no held-out evaluation")
+	flag.StringVar(&VocabFile, "vocab", VocabFile, "vocabulary file of the corpus -- it is made from the corpus and saved if it does not exist, and otherwise read from instead of counting the words of the corpus")
+	flag.StringVar(&BPEFile, "bpe", BPEFile, "if set, use subword tokens instead of words, with the byte-pair encoding merges in this file, which are learned from the corpus and saved if it does not exist -- use a different -vocab file than for words")
+	flag.StringVar(&WordEncoding, "wordenc", WordEncoding, "how the words are encoded as input patterns: random, cooc for embeddings from their co-occurrence in the corpus, charhash for hashed character n-grams, or file for embeddings read from a file, optionally followed by :Field=Value,... settings of sim.WordEncoding, e.g., cooc:Window=3 or file:File=glove.6B.50d.txt")
+	flag.BoolVar(&Sequence, "sequence", Sequence, "present the words of the corpus in order, one per trial, with the next word of the sentence as the target, instead of a random walk through the ngrams -- an epoch is a pass through the corpus, and the activity of the network is cleared at the start of each sentence")
+	flag.IntVar(&NContext, "ncontext", NContext, "number of words in the input: the current word and the words before it, in the ngram or, with -sequence, in the sentence")
 	ss.ParseArgs()
-	ConfigEnv(ss)
+	ConfigSim(ss)
 	ConfigPats(ss)
+	ss.NewSimFunc = func(args sim.CmdArgs) *sim.Sim {
+		return NewParallelSim(ss, args)
+	}
+}
+
+// ConfigSim configures everything but the params and the patterns, which
+// depend on the vocabulary of the envs.
+func ConfigSim(ss *sim.Sim) {
+	ConfigEnv(ss)
 	ConfigNet(ss, ss.Net)
 	ss.InitStats()
 	ss.ConfigLogItems()
@@ -88,6 +146,19 @@ func Config(ss *sim.Sim) {
 	common.AddSimpleCallbacks(ss)
 }
 
+// NewParallelSim makes a copy of ss, with its own network and environments,
+// for doing runs in parallel with the given args. The patterns are shared, and
+// the envs read the vocabulary and word reps files that were saved for ss.
+func NewParallelSim(ss *sim.Sim, args sim.CmdArgs) *sim.Sim {
+	ps := &sim.Sim{}
+	ps.New()
+	ps.Pats = ss.Pats
+	ConfigParams(ps)
+	ps.ShareConfig(ss, args)
+	ConfigSim(ps)
+	return ps
+}
+
 func ConfigParams(ss *sim.Sim) {
 	ss.Params.AddNetwork(ss.Net)
 	ss.Params.AddSim(ss)
@@ -170,43 +241,70 @@ func ConfigParams(ss *sim.Sim) {
 
 func ConfigEnv(ss *sim.Sim) {
 
-	ss.TrainEnv = &TrainEnv
-	ss.TestEnv = &TestEnv
+	trainEnv := &sim.CorpusEnv{}
+	testEnv := &sim.CorpusEnv{}
+	ss.TrainEnv = trainEnv
+	ss.TestEnv = testEnv
 
 	ss.TrialStatsFunc = TrialStats
 
 	ss.NZeroStop = 5
 
-	TrainEnv.SetName("TrainEnv")
-	TrainEnv.SetDesc("training params and state")
-	//TrainEnv.Table = etable.NewIdxView(ss.Pats)
-	//TrainEnv.Con
-	TrainEnv.Validate()
+	trainEnv.SetName("TrainEnv")
+	trainEnv.SetDesc("training params and state")
+	//trainEnv.Table = etable.NewIdxView(ss.Pats)
+	//trainEnv.Con
 	ss.Run.Max = ss.CmdArgs.MaxRuns // note: we are not setting epoch max -- do that manually
 
-	// TODO if you run project using normal go tools, it runs in the text_one2many directory
-	path := ""
-	// path := "mechs/text_one2many/"
-
-	TrainEnv.Config(path+"data/cbt_train_filt.json", evec.Vec2i{5, 5}, false, 1, 3, 10)
-	TrainEnv.Trial().Max = len(TrainEnv.NGrams)
-	TrainEnv.Epoch().Max = ss.CmdArgs.MaxEpcs
-
-	TestEnv.Nm = "TestEnv"
-	TestEnv.Dsc = "testing params and state"
-	TestEnv.Validate()
-	TestEnv.Run().Max = ss.CmdArgs.MaxRuns // note: we are not setting epoch max -- do that manually
-	TestEnv.Config(path+"data/cbt_train_filt.json", evec.Vec2i{5, 5}, false, 1, 3, 10)
-	TestEnv.Trial().Max = len(TestEnv.NGrams)
-	TestEnv.Epoch().Max = ss.CmdArgs.MaxEpcs
+	// note: relative files are relative to the directory it runs in
+	trainEnv.VocabFile = VocabFile
+	trainEnv.BPEFile = BPEFile
+	trainEnv.Encoding.Defaults()
+	trainEnv.Sequence = Sequence
+	if err := trainEnv.Encoding.SetFromString(WordEncoding); err != nil {
+		fmt.Println(err)
+	}
+	trainEnv.Config(CorpusFile, evec.Vec2i{5, 5}, false, NContext, 3, 10)
+	if err := trainEnv.Validate(); err != nil {
+		fmt.Println(err)
+	}
+	trainEnv.Trial().Max = len(trainEnv.NGrams)
+	if Sequence {
+		trainEnv.Trial().Max = trainEnv.NSeqTrials
+	}
+	trainEnv.Epoch().Max = ss.CmdArgs.MaxEpcs
+
+	testEnv.Nm = "TestEnv"
+	testEnv.Dsc = "testing params and state"
+	testEnv.Run().Max = ss.CmdArgs.MaxRuns // note: we are not setting epoch max -- do that manually
+	testEnv.VocabFile = VocabFile
+	testEnv.BPEFile = BPEFile
+	testEnv.Encoding = trainEnv.Encoding
+	testEnv.Sequence = Sequence
+	testFile := TestCorpusFile
+	if testFile == "" {
+		testFile = CorpusFile
+	}
+	if testFile == CorpusFile {
+		fmt.Println("Warning: testing on the training corpus, so the n-gram baseline has seen the test sentences")
+	}
+	testEnv.Config(testFile, evec.Vec2i{5, 5}, false, NContext, 3, 10)
+	if err := testEnv.Validate(); err != nil {
+		fmt.Println(err)
+	}
+	testEnv.Trial().Max = len(testEnv.NGrams)
+	if Sequence {
+		testEnv.Trial().Max = testEnv.NSeqTrials
+	}
+	testEnv.Epoch().Max = ss.CmdArgs.MaxEpcs
 	// note: to create a train / test split of pats, do this:
 	// all := etable.NewIdxView(ss.Pats)
 	// splits, _ := split.Permuted(all, []float64{.8, .2}, []string{"Train", "Test"})
-	// TrainEnv.Table = splits.Splits[0]
-	// TestEnv.Table = splits.Splits[1]
+	// trainEnv.Table = splits.Splits[0]
+	// testEnv.Table = splits.Splits[1]
 
-	TrainEnv.Init(0)
-	TestEnv.Init(0)
+	trainEnv.Init(0)
+	testEnv.Init(0)
 }
 
 func ConfigPats(ss *sim.Sim) {
@@ -220,10 +318,11 @@ func ConfigPats(ss *sim.Sim) {
 	// TODO 50 is arbitrary and maybe incorrect
 	dt.SetFromSchema(sch, 50)
 
+	trainEnv := ss.TrainEnv.(*sim.CorpusEnv)
 	i := 0
-	for _, word := range TrainEnv.Words {
-		idx := TrainEnv.WordMap[word]
-		mytensor := TrainEnv.WordReps.SubSpace([]int{idx})
+	for _, word := range trainEnv.Words {
+		idx := trainEnv.WordMap[word]
+		mytensor := trainEnv.WordReps.SubSpace([]int{idx})
 		dt.SetCellString("Word", i, word)
 		dt.SetCellTensor("Pattern", i, mytensor)
 		i++
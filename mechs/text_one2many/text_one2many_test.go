@@ -21,6 +21,7 @@ func TestConfigNet(t *testing.T) {
 func TestConfigPats(t *testing.T) {
 	ss := sim.Sim{}
 	ss.Pats = &etable.Table{}
+	ss.TrainEnv = &sim.CorpusEnv{}
 	ConfigPats(&ss)
 	if ss.Pats.Rows < 10 {
 		t.Errorf("Expected more patterns than that!")
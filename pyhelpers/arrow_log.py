@@ -0,0 +1,24 @@
+import numpy as np
+import pyarrow as pa
+
+def read_arrow_log(path:str):
+    """Reads a log saved with -arrow into a dict of numpy arrays, one per column.
+    Tensor columns are reshaped to (rows, *shape) from the shape in their field metadata."""
+    with pa.memory_map(path, "r") as source:
+        table = pa.ipc.open_file(source).read_all()
+
+    columns = {}
+    for field, column in zip(table.schema, table.columns):
+        column = column.combine_chunks()
+        if pa.types.is_fixed_size_list(field.type):
+            values = column.flatten().to_numpy(zero_copy_only=False)
+            shape = [int(s) for s in field.metadata[b"shape"].decode().split(",")]
+            columns[field.name] = values.reshape([len(column)] + shape)
+        else:
+            columns[field.name] = column.to_numpy(zero_copy_only=False)
+    return columns
+
+def dims_of(path:str, name:str):
+    """Returns the names of the dimensions of the cells of tensor column name."""
+    schema = pa.ipc.open_file(pa.memory_map(path, "r")).schema
+    return schema.field(name).metadata[b"dims"].decode().split(",")